@@ -0,0 +1,81 @@
+package czds
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultCircuitBreakerCooldown is how long requests fail fast once the circuit breaker opens when Client.CircuitBreakerCooldown is not set
+const DefaultCircuitBreakerCooldown = time.Minute
+
+// ErrCircuitOpen is returned without making a request while the circuit breaker is open
+// after Client.CircuitBreakerThreshold consecutive requests failed
+var ErrCircuitOpen = errors.New("circuit breaker open after repeated failed requests")
+
+// circuitBreaker stops requests after too many consecutive failures
+// once the cooldown has passed a single probe request is allowed, which closes the circuit if it succeeds
+// or opens it for another cooldown if it fails
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns true if a request may be made
+func (b *circuitBreaker) allow(threshold int) bool {
+	if threshold <= 0 {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.failures < threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	// half open, let this request probe the server
+	b.probing = true
+	return true
+}
+
+// success records a successful request and closes the circuit
+func (b *circuitBreaker) success() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+// failure records a failed request and returns true if it opened the circuit
+func (b *circuitBreaker) failure(threshold int, cooldown time.Duration) bool {
+	if threshold <= 0 {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= threshold {
+		b.openUntil = time.Now().Add(cooldown)
+		return true
+	}
+	return false
+}
+
+// canceled records a request that was canceled by the caller, which is neither a success nor a failure
+func (b *circuitBreaker) canceled() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.probing = false
+}
+
+// circuitBreakerCooldown returns how long requests fail fast once the circuit breaker opens
+func (c *Client) circuitBreakerCooldown() time.Duration {
+	if c.CircuitBreakerCooldown > 0 {
+		return c.CircuitBreakerCooldown
+	}
+	return DefaultCircuitBreakerCooldown
+}
@@ -0,0 +1,153 @@
+package czds
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	// step is a request made after waiting for the cooldown if wait is set, to a server that is down or up
+	type step struct {
+		down     bool
+		wait     bool
+		wantOpen bool // the request fails fast with ErrCircuitOpen without reaching the server
+		wantErr  bool
+	}
+	var (
+		fails    = step{down: true, wantErr: true}
+		open     = step{down: true, wantOpen: true, wantErr: true}
+		openUp   = step{wantOpen: true, wantErr: true}
+		succeeds = step{}
+	)
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{"opens and recovers", 3, []step{
+			fails, fails, fails, open, openUp,
+			{wait: true}, // the probe succeeds and closes the circuit
+			succeeds, fails, fails, succeeds,
+		}},
+		{"probe fails", 2, []step{
+			fails, fails, open,
+			{down: true, wait: true, wantErr: true}, // the probe fails and opens the circuit again
+			open, openUp,
+			{wait: true},
+			succeeds,
+		}},
+		{"success resets", 3, []step{
+			fails, fails, succeeds, fails, fails, succeeds, fails, fails, fails, open,
+		}},
+		{"disabled", 0, []step{
+			fails, fails, fails, fails, fails, succeeds,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var down atomic.Bool
+			var hits atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				if down.Load() {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				writeJSON(t, w, []TLDStatus{})
+			})
+			_, c := newTestServer(t, mux)
+			c.CircuitBreakerThreshold = tt.threshold
+			c.CircuitBreakerCooldown = cooldown
+			err := c.Authenticate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range tt.steps {
+				if s.wait {
+					time.Sleep(cooldown)
+				}
+				down.Store(s.down)
+				before := hits.Load()
+				start := time.Now()
+				_, err := c.GetTLDStatus()
+				if (err != nil) != s.wantErr {
+					t.Fatalf("step %d: GetTLDStatus() error = %v, want error: %t", i, err, s.wantErr)
+				}
+				if open := errors.Is(err, ErrCircuitOpen); open != s.wantOpen {
+					t.Fatalf("step %d: GetTLDStatus() error = %v, want circuit open: %t", i, err, s.wantOpen)
+				}
+				if hit := hits.Load() != before; hit == s.wantOpen {
+					t.Errorf("step %d: request reached the server: %t, want %t", i, hit, !s.wantOpen)
+				}
+				if elapsed := time.Since(start); s.wantOpen && elapsed > cooldown/2 {
+					t.Errorf("step %d: failing fast took %s", i, elapsed)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	var down atomic.Bool
+	var hits atomic.Int32
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 2 {
+			// hold the probe until the other requests were made
+			close(probing)
+			<-release
+		}
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(t, w, []TLDStatus{})
+	})
+	_, c := newTestServer(t, mux)
+	c.CircuitBreakerThreshold = 1
+	c.CircuitBreakerCooldown = cooldown
+	err := c.Authenticate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	down.Store(true)
+	_, err = c.GetTLDStatus()
+	if err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GetTLDStatus() error = %v, want a server error", err)
+	}
+	time.Sleep(cooldown)
+	down.Store(false)
+	probe := make(chan error, 1)
+	go func() {
+		_, err := c.GetTLDStatus()
+		probe <- err
+	}()
+	<-probing
+	for i := 0; i < 3; i++ {
+		_, err = c.GetTLDStatus()
+		if !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("GetTLDStatus() during the probe error = %v, want %v", err, ErrCircuitOpen)
+		}
+	}
+	close(release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	_, err = c.GetTLDStatus()
+	if err != nil {
+		t.Errorf("GetTLDStatus() after the probe error = %v", err)
+	}
+	if got := hits.Load(); got != 3 {
+		t.Errorf("server got %d requests, want 3", got)
+	}
+}
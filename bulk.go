@@ -0,0 +1,372 @@
+package czds
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BulkDownloadOptions holds the optional settings for BulkDownloadWithContext()
+type BulkDownloadOptions struct {
+	OutDir      string        // directory to save the zones to, created if it does not exist, defaults to the current directory
+	Parallel    int           // number of zones to download at once, defaults to 1
+	Retries     int           // max attempts for each zone, defaults to 3
+	RetryDelay  time.Duration // base time to wait before retrying a failed zone, randomized by ±50%, defaults to Client.RetryDelay, negative for no delay
+	Force       bool          // download zones even if the local copy has the same size and is not older than the remote copy
+	Shuffle     bool          // download the zones in a random order to better distribute load on CZDS
+	MinSize     int64         // downloads smaller than this many bytes fail and are retried, empty downloads always fail
+	VerifyGzip  bool          // read gzip compressed zones to the end to check they are not corrupt or truncated before saving them
+	Fsync       bool          // sync each zone to disk before renaming it into place
+	KeepPartial bool          // keep the temporary file of failed downloads for debugging instead of removing it
+
+	// FileName returns the name to save the zone at url as, defaults to info.Filename
+	// names that could escape OutDir are rejected
+	FileName func(url string, info *DownloadInfo) (string, error)
+
+	// Unchanged reports whether the zone is known to be the same as the copy saved by an earlier run, such as from a manifest
+	// it is only called for zones that are not forced and have a local copy, or for every zone when Save is set
+	Unchanged func(url string, info *DownloadInfo) bool
+
+	// Writer returns a writer that every download of the zone is also copied to, such as to show its progress,
+	// and a function that is called once the download finishes
+	Writer func(url string, info *DownloadInfo) (io.Writer, func())
+
+	// Save replaces renaming the finished download into OutDir, for callers that store the zones elsewhere such as in an archive
+	// it is passed the zone's filename and the temporary file holding the download, which is removed afterwards,
+	// and returns the path to report for the zone
+	// without a local copy to compare with, zones are always downloaded when Save is set unless Unchanged reports them unchanged
+	Save func(name, tmpPath string, info *DownloadInfo) (string, error)
+
+	// Attempt replaces the default download attempt, for callers that save the zones somewhere other than OutDir
+	// or that wrap BulkDownloadAttempt, such as to give every attempt its own timeout
+	// it returns the path of the zone, the number of bytes downloaded, and true if the zone did not need to be downloaded
+	// the other options are only used by the default attempt
+	Attempt func(ctx context.Context, url string) (string, int64, bool, error)
+}
+
+// BulkDownload downloads all of the zones at urls as described in BulkDownloadWithContext
+// and waits for them to finish, opts may be nil
+func (c *Client) BulkDownload(urls []string, opts *BulkDownloadOptions) (*DownloadResult, error) {
+	start := time.Now()
+	results, err := c.BulkDownloadWithContext(context.Background(), urls, opts)
+	if err != nil {
+		return nil, err
+	}
+	result := &DownloadResult{
+		Zones: make([]ZoneResult, 0, len(urls)),
+	}
+	for zone := range results {
+		result.Zones = append(result.Zones, zone)
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// BulkDownloadWithContext downloads the zones at urls, as returned by GetLinks(), into opts.OutDir in parallel, opts may be nil
+// the result of every zone is sent on the returned channel, which is closed once all of the zones are finished.
+// Zones whose local copy matches the remote size and modification time are skipped.
+// Each zone is written to a temporary file that is renamed into place once the download succeeds,
+// so an existing copy is never replaced by a failed download.
+// The client is authenticated once before any downloads start.
+// Downloads that have not finished when ctx is done fail with the context's cause.
+func (c *Client) BulkDownloadWithContext(ctx context.Context, urls []string, opts *BulkDownloadOptions) (<-chan ZoneResult, error) {
+	if opts == nil {
+		opts = &BulkDownloadOptions{}
+	}
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	retries := opts.Retries
+	if retries < 1 {
+		retries = 3
+	}
+	retryDelay := opts.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = c.retryDelay()
+	}
+	attempt := opts.Attempt
+	if attempt == nil {
+		outDir := opts.outDir()
+		err := os.MkdirAll(outDir, 0770)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create output directory %q: %w", outDir, err)
+		}
+		attempt = func(ctx context.Context, url string) (string, int64, bool, error) {
+			return c.BulkDownloadAttempt(ctx, url, nil, opts)
+		}
+	}
+
+	// authenticate once up front instead of every worker blocking on the first request
+	err := c.EnsureAuthenticated()
+	if err != nil {
+		return nil, err
+	}
+
+	urls = append([]string(nil), urls...)
+	if opts.Shuffle {
+		rand.Shuffle(len(urls), func(i, j int) { urls[i], urls[j] = urls[j], urls[i] })
+	}
+
+	// buffered so that workers never block on a reader that stopped reading
+	results := make(chan ZoneResult, len(urls))
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range work {
+				results <- c.bulkDownloadZone(ctx, url, attempt, retries, retryDelay)
+			}
+		}()
+	}
+	go func() {
+		for _, url := range urls {
+			work <- url
+		}
+		close(work)
+		wg.Wait()
+		close(results)
+	}()
+	return results, nil
+}
+
+// bulkDownloadZone downloads a single zone for BulkDownloadWithContext, making up to retries attempts
+// failed attempts are retried after a randomized retryDelay
+func (c *Client) bulkDownloadZone(ctx context.Context, url string, attempt func(context.Context, string) (string, int64, bool, error), retries int, retryDelay time.Duration) ZoneResult {
+	start := time.Now()
+	result := ZoneResult{
+		Zone: strings.TrimSuffix(path.Base(url), ".zone"),
+		URL:  url,
+	}
+	for try := 1; try <= retries; try++ {
+		if ctx.Err() != nil {
+			result.Err = context.Cause(ctx)
+			break
+		}
+		var skipped bool
+		result.Path, result.Bytes, skipped, result.Err = attempt(ctx, url)
+		if result.Err == nil {
+			result.Status = ZoneDownloaded
+			if skipped {
+				result.Status = ZoneSkipped
+			}
+			break
+		}
+		c.v("[%s] download attempt [%d/%d] failed: %s", result.Zone, try, retries, result.Err)
+		if try < retries {
+			timer := time.NewTimer(Jitter(retryDelay))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}
+	if result.Err != nil {
+		result.Status = ZoneFailed
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// outDir returns the directory the zones are saved to
+func (opts *BulkDownloadOptions) outDir() string {
+	if len(opts.OutDir) == 0 {
+		return "."
+	}
+	return opts.OutDir
+}
+
+// bulkZone is the local state of a zone as found by checkBulkDownload
+type bulkZone struct {
+	name     string    // filename to save the zone as
+	fullPath string    // path the zone is saved to in OutDir, empty when opts.Save is set
+	since    time.Time // only download the zone if it was modified after this time, zero to always download
+	needed   bool      // the zone needs to be downloaded
+}
+
+// CheckBulkDownload reports whether BulkDownloadAttempt would download the zone at url described by info, opts may be nil
+// returns the path the zone is saved to, which is empty when opts.Save is set, and true if the zone needs to be downloaded
+func (c *Client) CheckBulkDownload(url string, info *DownloadInfo, opts *BulkDownloadOptions) (string, bool, error) {
+	if opts == nil {
+		opts = &BulkDownloadOptions{}
+	}
+	zone, err := c.checkBulkDownload(url, info, opts)
+	if err != nil {
+		return "", false, err
+	}
+	return zone.fullPath, zone.needed, nil
+}
+
+// checkBulkDownload compares the zone at url described by info with its local copy
+func (c *Client) checkBulkDownload(url string, info *DownloadInfo, opts *BulkDownloadOptions) (*bulkZone, error) {
+	name := info.Filename
+	if opts.FileName != nil {
+		var err error
+		name, err = opts.FileName(url, info)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the name is provided by the server, do not allow it to escape the output directory
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("unsafe filename %q for %s", name, url)
+	}
+	zone := &bulkZone{name: name, needed: true}
+	if opts.Save == nil {
+		zone.fullPath = filepath.Join(opts.outDir(), name)
+	}
+	if opts.Force {
+		c.v("forcing download of %q", url)
+		return zone, nil
+	}
+	if opts.Save != nil {
+		if opts.Unchanged != nil && opts.Unchanged(url, info) {
+			c.v("%q unchanged since it was saved, skipping", name)
+			zone.needed = false
+		}
+		return zone, nil
+	}
+
+	local, err := os.Stat(zone.fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		// download even if Unchanged reports the zone unchanged
+		return zone, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat %q: %w", zone.fullPath, err)
+	}
+	switch {
+	case opts.Unchanged != nil && opts.Unchanged(url, info):
+		c.v("%q unchanged since it was saved, skipping", zone.fullPath)
+		zone.needed = false
+	case info.ContentLength >= 0 && local.Size() != info.ContentLength:
+		c.v("size of local file %q (%d) differs from remote (%d), redownloading", zone.fullPath, local.Size(), info.ContentLength)
+	case info.LastModified.IsZero() && info.ContentLength < 0:
+		c.v("remote size and modification time of %q are unknown, redownloading", zone.fullPath)
+	case info.LastModified.IsZero():
+		c.v("remote modification time of %q is unknown but the size matches, skipping", zone.fullPath)
+		zone.needed = false
+	case local.ModTime().Before(info.LastModified):
+		c.v("remote copy is newer than %q, redownloading", zone.fullPath)
+		// let the server confirm the zone changed, in case the HEAD and GET responses disagree
+		zone.since = local.ModTime()
+	default:
+		c.v("local file %q matched remote, skipping", zone.fullPath)
+		zone.needed = false
+	}
+	return zone, nil
+}
+
+// syncFile flushes a file to disk for opts.Fsync, replaced by tests
+var syncFile = (*os.File).Sync
+
+// BulkDownloadAttempt makes a single attempt to download the zone at url as BulkDownloadWithContext does by default, opts may be nil
+// info is the zone's download info if it is already known, or nil to fetch it
+// returns the path of the zone, the number of bytes downloaded, and true if the local copy was up to date
+func (c *Client) BulkDownloadAttempt(ctx context.Context, url string, info *DownloadInfo, opts *BulkDownloadOptions) (string, int64, bool, error) {
+	if opts == nil {
+		opts = &BulkDownloadOptions{}
+	}
+	if info == nil {
+		var err error
+		info, err = c.GetDownloadInfoWithContext(ctx, url)
+		if err != nil {
+			return "", 0, false, err
+		}
+	}
+	zone, err := c.checkBulkDownload(url, info, opts)
+	if err != nil {
+		return "", 0, false, err
+	}
+	if !zone.needed {
+		return zone.fullPath, 0, true, nil
+	}
+
+	file, err := os.CreateTemp(opts.outDir(), zone.name+".*.tmp")
+	if err != nil {
+		return "", 0, false, err
+	}
+	tmpPath := file.Name()
+	var dest io.Writer = file
+	if opts.Writer != nil {
+		w, done := opts.Writer(url, info)
+		defer done()
+		dest = io.MultiWriter(file, w)
+	}
+	n, err := c.DownloadZoneToWriterWithOptions(ctx, url, dest, &DownloadOptions{ModifiedSince: zone.since})
+	if errors.Is(err, ErrNotModified) {
+		c.v("%s not modified, keeping %q", url, zone.fullPath)
+		file.Close()
+		os.Remove(tmpPath)
+		return zone.fullPath, 0, true, nil
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("%s was empty", url)
+	}
+	if err == nil && n < opts.MinSize {
+		err = fmt.Errorf("%s is only %d bytes, smaller than the minimum size %d", url, n, opts.MinSize)
+	}
+	if err == nil && opts.Fsync {
+		err = syncFile(file)
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && opts.VerifyGzip && strings.HasSuffix(zone.name, ".gz") {
+		err = CheckGzip(tmpPath)
+	}
+	if err == nil && opts.Save != nil {
+		var savedPath string
+		savedPath, err = opts.Save(zone.name, tmpPath, info)
+		if err == nil {
+			os.Remove(tmpPath)
+			return savedPath, n, false, nil
+		}
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, zone.fullPath)
+	}
+	if err != nil {
+		if opts.KeepPartial {
+			return "", n, false, fmt.Errorf("%w, keeping partial download %q", err, tmpPath)
+		}
+		os.Remove(tmpPath)
+		return "", n, false, err
+	}
+	return zone.fullPath, n, false, nil
+}
+
+// CheckGzip reads the entire gzip file at filePath to verify that it is not corrupt or truncated
+func CheckGzip(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("invalid gzip %q: %w", filePath, err)
+	}
+	defer gz.Close()
+	_, err = io.Copy(io.Discard, gz)
+	if err != nil {
+		return fmt.Errorf("invalid gzip %q: %w", filePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,1058 @@
+package czds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// zoneHandler serves zones at /czds/downloads/<zone>.zone as <zone>.txt.gz
+// fail is called on every GET and returns a status code to fail the request with, or 0 to serve the zone
+// conditional GETs are answered with 304 Not Modified when notModified is set
+type zoneHandler struct {
+	zones       map[string][]byte
+	fail        func(zone string, try int) int
+	notModified bool
+
+	mutex sync.Mutex
+	gets  map[string]int
+	since map[string]string // If-Modified-Since of the last GET of each zone
+}
+
+func (h *zoneHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	zone := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/czds/downloads/"), ".zone")
+	data, ok := h.zones[zone]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodGet {
+		h.mutex.Lock()
+		h.gets[zone]++
+		try := h.gets[zone]
+		h.since[zone] = r.Header.Get("If-Modified-Since")
+		h.mutex.Unlock()
+		if h.notModified && r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if h.fail != nil {
+			if status := h.fail(zone, try); status != 0 {
+				http.Error(w, "failed", status)
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.txt.gz", zone))
+	w.Header().Set("Last-Modified", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC1123))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// getCount returns the number of GET requests made for zone
+func (h *zoneHandler) getCount(zone string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.gets[zone]
+}
+
+// gzipZone returns s gzip compressed
+func gzipZone(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err := w.Write([]byte(s))
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// newZoneServer starts a test server for h and returns a client and the download links of its zones
+func newZoneServer(t *testing.T, h *zoneHandler) (*testServer, *Client, []string) {
+	t.Helper()
+	h.gets = make(map[string]int)
+	h.since = make(map[string]string)
+	mux := http.NewServeMux()
+	mux.Handle("/czds/downloads/", h)
+	ts, c := newTestServer(t, mux)
+	urls := make([]string, 0, len(h.zones))
+	for zone := range h.zones {
+		urls = append(urls, ts.URL+"/czds/downloads/"+zone+".zone")
+	}
+	return ts, c, urls
+}
+
+// resultsByZone collects the results from BulkDownloadWithContext keyed by zone
+func resultsByZone(results <-chan ZoneResult) map[string]ZoneResult {
+	out := make(map[string]ZoneResult)
+	for result := range results {
+		out[result.Zone] = result
+	}
+	return out
+}
+
+func TestBulkDownload(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    map[string]string // zone contents, gzip compressed unless raw is set
+		raw      bool
+		fail     func(zone string, try int) int
+		opts     BulkDownloadOptions
+		status   map[string]string // expected status of each zone
+		wantGets map[string]int
+	}{
+		{
+			name:   "downloads every zone",
+			zones:  map[string]string{"com": "com zone", "net": "net zone", "org": "org zone"},
+			opts:   BulkDownloadOptions{Parallel: 2},
+			status: map[string]string{"com": ZoneDownloaded, "net": ZoneDownloaded, "org": ZoneDownloaded},
+		},
+		{
+			name:  "retries a failed download",
+			zones: map[string]string{"com": "com zone", "net": "net zone"},
+			fail: func(zone string, try int) int {
+				if zone == "com" && try == 1 {
+					return http.StatusInternalServerError
+				}
+				return 0
+			},
+			opts:     BulkDownloadOptions{Retries: 3},
+			status:   map[string]string{"com": ZoneDownloaded, "net": ZoneDownloaded},
+			wantGets: map[string]int{"com": 2, "net": 1},
+		},
+		{
+			name:  "fails after the last retry",
+			zones: map[string]string{"com": "com zone"},
+			fail: func(zone string, try int) int {
+				return http.StatusInternalServerError
+			},
+			opts:     BulkDownloadOptions{Retries: 2},
+			status:   map[string]string{"com": ZoneFailed},
+			wantGets: map[string]int{"com": 2},
+		},
+		{
+			name:     "fails smaller than the minimum size",
+			zones:    map[string]string{"com": "com zone"},
+			opts:     BulkDownloadOptions{Retries: 1, MinSize: 1 << 20},
+			status:   map[string]string{"com": ZoneFailed},
+			wantGets: map[string]int{"com": 1},
+		},
+		{
+			name:   "fails corrupt gzip with VerifyGzip",
+			zones:  map[string]string{"com": "not gzip"},
+			raw:    true,
+			opts:   BulkDownloadOptions{Retries: 1, VerifyGzip: true, Fsync: true},
+			status: map[string]string{"com": ZoneFailed},
+		},
+		{
+			name:   "saves corrupt gzip without VerifyGzip",
+			zones:  map[string]string{"com": "not gzip"},
+			raw:    true,
+			opts:   BulkDownloadOptions{Retries: 1},
+			status: map[string]string{"com": ZoneDownloaded},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &zoneHandler{zones: make(map[string][]byte), fail: tt.fail}
+			for zone, s := range tt.zones {
+				if tt.raw {
+					h.zones[zone] = []byte(s)
+				} else {
+					h.zones[zone] = gzipZone(t, s)
+				}
+			}
+			ts, c, urls := newZoneServer(t, h)
+			opts := tt.opts
+			opts.OutDir = t.TempDir()
+			results, err := c.BulkDownloadWithContext(context.Background(), urls, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := resultsByZone(results)
+			if len(got) != len(tt.status) {
+				t.Fatalf("got %d results, want %d", len(got), len(tt.status))
+			}
+			for zone, want := range tt.status {
+				result := got[zone]
+				if result.Status != want {
+					t.Errorf("[%s] status = %q, want %q, err: %v", zone, result.Status, want, result.Err)
+				}
+				path := filepath.Join(opts.OutDir, zone+".txt.gz")
+				data, err := os.ReadFile(path)
+				if want == ZoneDownloaded {
+					if err != nil {
+						t.Errorf("[%s] %v", zone, err)
+					} else if !bytes.Equal(data, h.zones[zone]) {
+						t.Errorf("[%s] saved %q, want %q", zone, data, h.zones[zone])
+					}
+					if result.Path != path {
+						t.Errorf("[%s] path = %q, want %q", zone, result.Path, path)
+					}
+				} else if !errors.Is(err, os.ErrNotExist) {
+					t.Errorf("[%s] failed zone was saved, stat error: %v", zone, err)
+				}
+			}
+			for zone, want := range tt.wantGets {
+				if n := h.getCount(zone); n != want {
+					t.Errorf("[%s] downloaded %d times, want %d", zone, n, want)
+				}
+			}
+			if n := ts.auths.Load(); n != 1 {
+				t.Errorf("authenticated %d times, want 1", n)
+			}
+			// temporary files are never left behind
+			matches, _ := filepath.Glob(filepath.Join(opts.OutDir, "*.tmp"))
+			if len(matches) > 0 {
+				t.Errorf("temporary files left in the output directory: %v", matches)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadSkipsUnchanged(t *testing.T) {
+	h := &zoneHandler{zones: map[string][]byte{"com": gzipZone(t, "com zone")}}
+	_, c, urls := newZoneServer(t, h)
+	opts := &BulkDownloadOptions{OutDir: t.TempDir()}
+	for _, want := range []string{ZoneDownloaded, ZoneSkipped} {
+		result, err := c.BulkDownload(urls, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.Zones[0].Status; got != want {
+			t.Errorf("status = %q, want %q", got, want)
+		}
+	}
+	if n := h.getCount("com"); n != 1 {
+		t.Errorf("downloaded %d times, want 1", n)
+	}
+}
+
+func TestBulkDownloadParallel(t *testing.T) {
+	tests := []struct {
+		parallel int
+		zones    int
+	}{
+		{1, 3},
+		{3, 6},
+		{4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d parallel %d zones", tt.parallel, tt.zones), func(t *testing.T) {
+			want := tt.parallel
+			if tt.zones < want {
+				want = tt.zones
+			}
+			var inFlight, maxInFlight atomic.Int32
+			var calls atomic.Int32
+			urls := make([]string, 0, tt.zones)
+			for i := 0; i < tt.zones; i++ {
+				urls = append(urls, fmt.Sprintf("https://czds.example/czds/downloads/z%d.zone", i))
+			}
+			opts := &BulkDownloadOptions{
+				Parallel: tt.parallel,
+				Attempt: func(ctx context.Context, url string) (string, int64, bool, error) {
+					calls.Add(1)
+					n := inFlight.Add(1)
+					defer inFlight.Add(-1)
+					for {
+						max := maxInFlight.Load()
+						if n <= max || maxInFlight.CompareAndSwap(max, n) {
+							break
+						}
+					}
+					// wait until the expected number of workers ran at once, or give up if they never do
+					deadline := time.Now().Add(time.Second)
+					for maxInFlight.Load() < int32(want) && time.Now().Before(deadline) {
+						time.Sleep(time.Millisecond)
+					}
+					// stay in flight long enough for any worker over the limit to overlap
+					time.Sleep(10 * time.Millisecond)
+					return url, 1, false, nil
+				},
+			}
+			_, c := newTestServer(t, http.NewServeMux())
+			result, err := c.BulkDownload(urls, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Count(ZoneDownloaded); got != tt.zones {
+				t.Errorf("downloaded %d zones, want %d", got, tt.zones)
+			}
+			if got := calls.Load(); got != int32(tt.zones) {
+				t.Errorf("made %d attempts, want %d", got, tt.zones)
+			}
+			if got := maxInFlight.Load(); got != int32(want) {
+				t.Errorf("max %d downloads at once, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryDelay time.Duration
+		minElapsed time.Duration
+	}{
+		{"no delay", -1, 0},
+		{"delay", 40 * time.Millisecond, 20 * time.Millisecond}, // jitter waits at least half of the delay
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts []time.Time
+			opts := &BulkDownloadOptions{
+				Retries:    2,
+				RetryDelay: tt.retryDelay,
+				Attempt: func(ctx context.Context, url string) (string, int64, bool, error) {
+					attempts = append(attempts, time.Now())
+					if len(attempts) == 1 {
+						return "", 0, false, errors.New("first attempt fails")
+					}
+					return url, 1, false, nil
+				},
+			}
+			_, c := newTestServer(t, http.NewServeMux())
+			result, err := c.BulkDownload([]string{"https://czds.example/czds/downloads/com.zone"}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Zones[0].Status; got != ZoneDownloaded {
+				t.Fatalf("status = %q, want %q", got, ZoneDownloaded)
+			}
+			if len(attempts) != 2 {
+				t.Fatalf("made %d attempts, want 2", len(attempts))
+			}
+			if elapsed := attempts[1].Sub(attempts[0]); elapsed < tt.minElapsed {
+				t.Errorf("retried after %s, want at least %s", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadCancel(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration // the run times out instead of being cancelled once a download starts
+		wantErr error
+	}{
+		{"cancelled", 0, context.Canceled},
+		{"deadline", 50 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{}, 1)
+			h := &zoneHandler{
+				zones: map[string][]byte{"com": []byte("com"), "net": []byte("net"), "org": []byte("org")},
+				gets:  make(map[string]int),
+			}
+			// block every download until the client gives up
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					h.ServeHTTP(w, r)
+					return
+				}
+				select {
+				case started <- struct{}{}:
+				default:
+				}
+				<-r.Context().Done()
+			})
+			ts, c := newTestServer(t, mux)
+			urls := []string{ts.URL + "/czds/downloads/com.zone", ts.URL + "/czds/downloads/net.zone", ts.URL + "/czds/downloads/org.zone"}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			results, err := c.BulkDownloadWithContext(ctx, urls, &BulkDownloadOptions{OutDir: t.TempDir(), Retries: 5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-started:
+			case <-time.After(5 * time.Second):
+				t.Fatal("download never started")
+			}
+			if tt.timeout == 0 {
+				cancel()
+			}
+
+			done := make(chan map[string]ZoneResult)
+			go func() { done <- resultsByZone(results) }()
+			select {
+			case got := <-done:
+				if len(got) != len(urls) {
+					t.Fatalf("got %d results, want %d", len(got), len(urls))
+				}
+				for zone, result := range got {
+					if result.Status != ZoneFailed || !errors.Is(result.Err, tt.wantErr) {
+						t.Errorf("[%s] status = %q, err = %v, want failed with %v", zone, result.Status, result.Err, tt.wantErr)
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("downloads did not stop after the context was done")
+			}
+		})
+	}
+}
+
+func TestBulkDownloadParallelServer(t *testing.T) {
+	tests := []struct {
+		parallel int
+		zones    int
+	}{
+		{1, 4},
+		{3, 6},
+		{4, 2},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d parallel %d zones", tt.parallel, tt.zones), func(t *testing.T) {
+			want := min(tt.parallel, tt.zones)
+			h := &zoneHandler{zones: make(map[string][]byte, tt.zones)}
+			for i := 0; i < tt.zones; i++ {
+				zone := fmt.Sprintf("z%d", i)
+				h.zones[zone] = gzipZone(t, zone+" zone")
+			}
+			// count the GETs in flight at the server, each waits until the expected number ran at once
+			var inFlight, maxInFlight atomic.Int32
+			h.fail = func(zone string, try int) int {
+				n := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					max := maxInFlight.Load()
+					if n <= max || maxInFlight.CompareAndSwap(max, n) {
+						break
+					}
+				}
+				deadline := time.Now().Add(time.Second)
+				for maxInFlight.Load() < int32(want) && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond)
+				}
+				// stay in flight long enough for any download over the limit to overlap
+				time.Sleep(10 * time.Millisecond)
+				return 0
+			}
+			_, c, urls := newZoneServer(t, h)
+			result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: t.TempDir(), Parallel: tt.parallel})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Count(ZoneDownloaded); got != tt.zones {
+				t.Errorf("downloaded %d zones, want %d: %+v", got, tt.zones, result.Zones)
+			}
+			if got := maxInFlight.Load(); got != int32(want) {
+				t.Errorf("max %d downloads at the server at once, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadAuthError(t *testing.T) {
+	ts, c := newTestServer(t, http.NewServeMux())
+	ts.authStatus = http.StatusUnauthorized
+	var attempts atomic.Int32
+	opts := &BulkDownloadOptions{
+		Attempt: func(ctx context.Context, url string) (string, int64, bool, error) {
+			attempts.Add(1)
+			return url, 1, false, nil
+		},
+	}
+	_, err := c.BulkDownloadWithContext(context.Background(), []string{ts.URL + "/czds/downloads/com.zone"}, opts)
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("error = %v, want an AuthError", err)
+	}
+	if n := attempts.Load(); n != 0 {
+		t.Errorf("made %d download attempts after authentication failed, want 0", n)
+	}
+}
+
+func TestBulkDownloadResult(t *testing.T) {
+	h := &zoneHandler{
+		zones: map[string][]byte{
+			"com": gzipZone(t, "com zone"),
+			"net": gzipZone(t, "net zone"),
+			"org": gzipZone(t, "org zone"),
+		},
+		fail: func(zone string, try int) int {
+			if zone == "org" {
+				return http.StatusInternalServerError
+			}
+			return 0
+		},
+	}
+	ts, c, _ := newZoneServer(t, h)
+	url := func(zone string) string { return ts.URL + "/czds/downloads/" + zone + ".zone" }
+	opts := &BulkDownloadOptions{OutDir: t.TempDir(), Retries: 1}
+	// download com first so that it is skipped by the mixed run
+	_, err := c.BulkDownload([]string{url("com")}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.BulkDownload([]string{url("com"), url("net"), url("org")}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		zone    string
+		status  string
+		bytes   int64
+		path    string
+		wantErr bool
+	}{
+		{"com", ZoneSkipped, 0, filepath.Join(opts.OutDir, "com.txt.gz"), false},
+		{"net", ZoneDownloaded, int64(len(h.zones["net"])), filepath.Join(opts.OutDir, "net.txt.gz"), false},
+		{"org", ZoneFailed, 0, "", true},
+	}
+	if len(result.Zones) != len(tests) {
+		t.Fatalf("got %d zone results, want %d", len(result.Zones), len(tests))
+	}
+	got := make(map[string]ZoneResult)
+	for _, zone := range result.Zones {
+		got[zone.Zone] = zone
+	}
+	for _, tt := range tests {
+		zone, ok := got[tt.zone]
+		if !ok {
+			t.Errorf("[%s] missing from result", tt.zone)
+			continue
+		}
+		if zone.URL != url(tt.zone) {
+			t.Errorf("[%s] URL = %q, want %q", tt.zone, zone.URL, url(tt.zone))
+		}
+		if zone.Status != tt.status {
+			t.Errorf("[%s] status = %q, want %q", tt.zone, zone.Status, tt.status)
+		}
+		if zone.Bytes != tt.bytes {
+			t.Errorf("[%s] bytes = %d, want %d", tt.zone, zone.Bytes, tt.bytes)
+		}
+		if zone.Path != tt.path {
+			t.Errorf("[%s] path = %q, want %q", tt.zone, zone.Path, tt.path)
+		}
+		if (zone.Err != nil) != tt.wantErr {
+			t.Errorf("[%s] err = %v, want error: %t", tt.zone, zone.Err, tt.wantErr)
+		}
+		if zone.Duration <= 0 {
+			t.Errorf("[%s] duration not set", tt.zone)
+		}
+	}
+	for _, status := range []string{ZoneDownloaded, ZoneSkipped, ZoneFailed} {
+		if n := result.Count(status); n != 1 {
+			t.Errorf("Count(%q) = %d, want 1", status, n)
+		}
+	}
+	if result.Duration <= 0 {
+		t.Error("result duration not set")
+	}
+}
+
+func TestBulkDownloadNotModified(t *testing.T) {
+	data := gzipZone(t, "com zone")
+	h := &zoneHandler{zones: map[string][]byte{"com": data}, notModified: true}
+	_, c, urls := newZoneServer(t, h)
+	dir := t.TempDir()
+	local := filepath.Join(dir, "com.txt.gz")
+	// the same size as the remote copy but older, so the server is asked if it changed
+	old := bytes.Repeat([]byte{'x'}, len(data))
+	err := os.WriteFile(local, old, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(local, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Zones) != 1 || result.Zones[0].Status != ZoneSkipped || result.Zones[0].Bytes != 0 {
+		t.Fatalf("results = %+v, want com skipped without downloading", result.Zones)
+	}
+	if since := h.since["com"]; since != mtime.Format(http.TimeFormat) {
+		t.Errorf("If-Modified-Since = %q, want %q", since, mtime.Format(http.TimeFormat))
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, old) {
+		t.Error("local copy was rewritten")
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(mtime) {
+		t.Errorf("local copy modified at %s, want %s", info.ModTime(), mtime)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the output directory, want only the local copy", len(entries))
+	}
+}
+
+func TestBulkDownloadRetryJitter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryDelay time.Duration
+		minGap     time.Duration
+		maxGap     time.Duration
+	}{
+		{"jittered", 40 * time.Millisecond, 20 * time.Millisecond, 60 * time.Millisecond},
+		{"no delay", -1, 0, 20 * time.Millisecond},
+	}
+	// allowance for scheduling on a busy machine
+	const slack = 50 * time.Millisecond
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var gets []time.Time
+			h := &zoneHandler{
+				zones: map[string][]byte{"com": gzipZone(t, "com zone")},
+				fail: func(zone string, try int) int {
+					mutex.Lock()
+					gets = append(gets, time.Now())
+					mutex.Unlock()
+					if try <= 3 {
+						return http.StatusInternalServerError
+					}
+					return 0
+				},
+			}
+			_, c, urls := newZoneServer(t, h)
+
+			result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: t.TempDir(), Retries: 4, RetryDelay: tt.retryDelay})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Zones[0].Status; got != ZoneDownloaded {
+				t.Fatalf("status = %q, want %q", got, ZoneDownloaded)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			if len(gets) != 4 {
+				t.Fatalf("%d attempts, want 4", len(gets))
+			}
+			for i := 1; i < len(gets); i++ {
+				gap := gets[i].Sub(gets[i-1])
+				if gap < tt.minGap || gap > tt.maxGap+slack {
+					t.Errorf("retry %d after %s, want between %s and %s", i, gap, tt.minGap, tt.maxGap)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBulkDownload(t *testing.T) {
+	modified := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	unchanged := func(string, *DownloadInfo) bool { return true }
+	save := func(string, string, *DownloadInfo) (string, error) { return "", nil }
+	tests := []struct {
+		name         string
+		local        bool          // a local copy of "com zone" exists
+		age          time.Duration // how much older the local copy is than modified
+		size         int64
+		lastModified time.Time
+		opts         BulkDownloadOptions
+		want         bool
+	}{
+		{"missing", false, 0, 8, modified, BulkDownloadOptions{}, true},
+		{"matches", true, 0, 8, modified, BulkDownloadOptions{}, false},
+		{"size differs", true, 0, 9, modified, BulkDownloadOptions{}, true},
+		{"older", true, time.Hour, 8, modified, BulkDownloadOptions{}, true},
+		{"no date with the same size", true, 0, 8, time.Time{}, BulkDownloadOptions{}, false},
+		{"no size or date", true, 0, -1, time.Time{}, BulkDownloadOptions{}, true},
+		{"no size", true, 0, -1, modified, BulkDownloadOptions{}, false},
+		{"forced", true, 0, 8, modified, BulkDownloadOptions{Force: true}, true},
+		{"unchanged", true, time.Hour, 9, modified, BulkDownloadOptions{Unchanged: unchanged}, false},
+		{"unchanged but missing", false, 0, 8, modified, BulkDownloadOptions{Unchanged: unchanged}, true},
+		{"saved elsewhere", true, 0, 8, modified, BulkDownloadOptions{Save: save}, true},
+		{"saved elsewhere unchanged", false, 0, 8, modified, BulkDownloadOptions{Save: save, Unchanged: unchanged}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.OutDir = t.TempDir()
+			local := filepath.Join(opts.OutDir, "com.txt.gz")
+			if tt.local {
+				err := os.WriteFile(local, []byte("com zone"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.Chtimes(local, modified.Add(-tt.age), modified.Add(-tt.age))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			info := &DownloadInfo{Filename: "com.txt.gz", ContentLength: tt.size, LastModified: tt.lastModified}
+			got, needed, err := NewClient("user", "pass").CheckBulkDownload("https://czds.example/czds/downloads/com.zone", info, &opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if needed != tt.want {
+				t.Errorf("needed = %t, want %t", needed, tt.want)
+			}
+			want := local
+			if opts.Save != nil {
+				want = ""
+			}
+			if got != want {
+				t.Errorf("path = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName func(url string, info *DownloadInfo) (string, error)
+		want     string
+		wantErr  bool
+	}{
+		{"default", nil, "com.txt.gz", false},
+		{"renamed", func(url string, info *DownloadInfo) (string, error) {
+			return "com." + info.LastModified.Format("2006-01-02") + ".txt.gz", nil
+		}, "com.2024-06-01.txt.gz", false},
+		{"unsafe", func(string, *DownloadInfo) (string, error) { return "../com.txt.gz", nil }, "", true},
+		{"empty", func(string, *DownloadInfo) (string, error) { return "", nil }, "", true},
+		{"error", func(string, *DownloadInfo) (string, error) { return "", errors.New("bad template") }, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &zoneHandler{zones: map[string][]byte{"com": gzipZone(t, "com zone")}}
+			_, c, urls := newZoneServer(t, h)
+			dir := t.TempDir()
+			result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: dir, Retries: 1, FileName: tt.fileName})
+			if err != nil {
+				t.Fatal(err)
+			}
+			zone := result.Zones[0]
+			if tt.wantErr {
+				if zone.Status != ZoneFailed {
+					t.Errorf("status = %q, want %q", zone.Status, ZoneFailed)
+				}
+				if n := h.getCount("com"); n != 0 {
+					t.Errorf("downloaded %d times, want 0", n)
+				}
+				return
+			}
+			if want := filepath.Join(dir, tt.want); zone.Status != ZoneDownloaded || zone.Path != want {
+				t.Errorf("result = %+v, want downloaded to %q", zone, want)
+			}
+		})
+	}
+}
+
+func TestBulkDownloadSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		saveErr error
+		want    string
+	}{
+		{"saved", nil, ZoneDownloaded},
+		{"save fails", errors.New("archive closed"), ZoneFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := gzipZone(t, "com zone")
+			h := &zoneHandler{zones: map[string][]byte{"com": data}}
+			_, c, urls := newZoneServer(t, h)
+			dir := t.TempDir()
+			var saved []string
+			opts := &BulkDownloadOptions{
+				OutDir:  dir,
+				Retries: 1,
+				Save: func(name, tmpPath string, info *DownloadInfo) (string, error) {
+					got, err := os.ReadFile(tmpPath)
+					if err != nil {
+						t.Error(err)
+					} else if !bytes.Equal(got, data) {
+						t.Errorf("saved %q, want %q", got, data)
+					}
+					saved = append(saved, name)
+					return "zones.tar.gz", tt.saveErr
+				},
+			}
+			result, err := c.BulkDownload(urls, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			zone := result.Zones[0]
+			if zone.Status != tt.want {
+				t.Errorf("status = %q, want %q, err: %v", zone.Status, tt.want, zone.Err)
+			}
+			if tt.want == ZoneDownloaded && zone.Path != "zones.tar.gz" {
+				t.Errorf("path = %q, want the path returned by Save", zone.Path)
+			}
+			if want := []string{"com.txt.gz"}; !reflect.DeepEqual(saved, want) {
+				t.Errorf("Save called with %v, want %v", saved, want)
+			}
+			// the download is neither renamed into OutDir nor left behind
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("%d files left in the output directory, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestBulkDownloadWriter(t *testing.T) {
+	zones := map[string][]byte{"com": gzipZone(t, "com zone"), "net": gzipZone(t, "net zone")}
+	h := &zoneHandler{zones: zones}
+	_, c, urls := newZoneServer(t, h)
+	var mutex sync.Mutex
+	written := make(map[string]*bytes.Buffer)
+	done := make(map[string]int)
+	opts := &BulkDownloadOptions{
+		OutDir:   t.TempDir(),
+		Parallel: 2,
+		Writer: func(url string, info *DownloadInfo) (io.Writer, func()) {
+			zone := strings.TrimSuffix(path.Base(url), ".zone")
+			if info.ContentLength != int64(len(zones[zone])) {
+				t.Errorf("[%s] size = %d, want %d", zone, info.ContentLength, len(zones[zone]))
+			}
+			var b bytes.Buffer
+			mutex.Lock()
+			written[zone] = &b
+			mutex.Unlock()
+			return &b, func() {
+				mutex.Lock()
+				done[zone]++
+				mutex.Unlock()
+			}
+		},
+	}
+	_, err := c.BulkDownload(urls, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for zone, data := range zones {
+		if b := written[zone]; b == nil || !bytes.Equal(b.Bytes(), data) {
+			t.Errorf("[%s] writer did not get the zone", zone)
+		}
+		if done[zone] != 1 {
+			t.Errorf("[%s] done called %d times, want 1", zone, done[zone])
+		}
+	}
+}
+
+func TestBulkDownloadKeepPartial(t *testing.T) {
+	tests := []struct {
+		name string
+		keep bool
+	}{
+		{"removed", false},
+		{"kept", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := gzipZone(t, "com zone")
+			h := &zoneHandler{zones: map[string][]byte{"com": data}}
+			_, c, urls := newZoneServer(t, h)
+			dir := t.TempDir()
+			result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: dir, Retries: 1, MinSize: 1 << 20, KeepPartial: tt.keep})
+			if err != nil {
+				t.Fatal(err)
+			}
+			zone := result.Zones[0]
+			if zone.Status != ZoneFailed {
+				t.Fatalf("status = %q, want %q", zone.Status, ZoneFailed)
+			}
+			partials, err := filepath.Glob(filepath.Join(dir, "com.txt.gz.*.tmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.keep {
+				if len(partials) != 0 {
+					t.Errorf("partial downloads %v were not removed", partials)
+				}
+				return
+			}
+			if len(partials) != 1 {
+				t.Fatalf("got partial downloads %v, want 1", partials)
+			}
+			got, err := os.ReadFile(partials[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("partial download = %q, want %q", got, data)
+			}
+			if !strings.Contains(zone.Err.Error(), partials[0]) {
+				t.Errorf("error %q does not include the partial download %q", zone.Err, partials[0])
+			}
+		})
+	}
+}
+
+func TestBulkDownloadFsync(t *testing.T) {
+	tests := []struct {
+		name      string
+		fsync     bool
+		syncErr   bool
+		wantSyncs int
+		want      string
+	}{
+		{"off", false, false, 0, ZoneDownloaded},
+		{"on", true, false, 2, ZoneDownloaded},
+		{"sync fails", true, true, 2, ZoneFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mutex sync.Mutex
+			var syncs []string
+			syncFile = func(f *os.File) error {
+				// the file is synced while it still has its temporary name
+				if !strings.HasSuffix(f.Name(), ".tmp") {
+					t.Errorf("synced %q, want a temporary file", f.Name())
+				}
+				mutex.Lock()
+				syncs = append(syncs, f.Name())
+				mutex.Unlock()
+				if tt.syncErr {
+					return errors.New("sync: input/output error")
+				}
+				return f.Sync()
+			}
+			t.Cleanup(func() { syncFile = (*os.File).Sync })
+			h := &zoneHandler{zones: map[string][]byte{"com": gzipZone(t, "com zone"), "net": gzipZone(t, "net zone")}}
+			_, c, urls := newZoneServer(t, h)
+			dir := t.TempDir()
+			result, err := c.BulkDownload(urls, &BulkDownloadOptions{OutDir: dir, Parallel: 2, Retries: 1, Fsync: tt.fsync})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(syncs) != tt.wantSyncs {
+				t.Errorf("synced %v, want %d files", syncs, tt.wantSyncs)
+			}
+			if n := result.Count(tt.want); n != 2 {
+				t.Errorf("%d zones %s, want 2: %+v", n, tt.want, result.Zones)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == ZoneFailed {
+				if len(entries) != 0 {
+					t.Errorf("%d files saved after the sync failed, want none", len(entries))
+				}
+				return
+			}
+			for _, entry := range entries {
+				info, err := entry.Info()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if runtime.GOOS != "windows" && info.Mode().Perm() != 0644 {
+					t.Errorf("%s saved with mode %s, want %s", entry.Name(), info.Mode().Perm(), os.FileMode(0644))
+				}
+			}
+		})
+	}
+}
+
+func TestBulkDownloadAttemptConcurrent(t *testing.T) {
+	tests := []struct {
+		name    string
+		writers int
+		existed bool // the zone was already downloaded by an earlier run
+	}{
+		{"two writers", 2, false},
+		{"many writers", 8, false},
+		{"replacing an earlier copy", 4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// each writer downloads different contents to the same path, as runs of different dates would
+			h := &zoneHandler{zones: make(map[string][]byte, tt.writers)}
+			contents := make(map[string]bool, tt.writers)
+			for i := 0; i < tt.writers; i++ {
+				data := bytes.Repeat([]byte{byte('a' + i)}, 1<<20+i)
+				h.zones[fmt.Sprintf("z%d", i)] = data
+				contents[string(data)] = true
+			}
+			_, c, urls := newZoneServer(t, h)
+			dir := t.TempDir()
+			fullPath := filepath.Join(dir, "com.txt.gz")
+			if tt.existed {
+				err := os.WriteFile(fullPath, []byte("old copy"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := &BulkDownloadOptions{
+				OutDir:   dir,
+				Force:    true,
+				FileName: func(string, *DownloadInfo) (string, error) { return "com.txt.gz", nil },
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(urls))
+			for i, url := range urls {
+				wg.Add(1)
+				go func(i int, url string) {
+					defer wg.Done()
+					_, _, _, errs[i] = c.BulkDownloadAttempt(context.Background(), url, nil, opts)
+				}(i, url)
+			}
+			wg.Wait()
+			for i, err := range errs {
+				if err != nil {
+					t.Errorf("writer %d: %s", i, err)
+				}
+			}
+
+			// the zone is the complete download of one of the writers
+			data, err := os.ReadFile(fullPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !contents[string(data)] {
+				t.Errorf("zone is %d bytes that are not the download of any writer", len(data))
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Errorf("%d files in the output directory, want only the zone and no temporary files", len(entries))
+			}
+		})
+	}
+}
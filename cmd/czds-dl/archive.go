@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// zoneArchive writes the downloaded zones into a single tar.gz file
+// the archive is written to a temporary file and renamed into place by Close
+// so an interrupted run never leaves a truncated archive at path
+type zoneArchive struct {
+	mutex   sync.Mutex
+	path    string
+	tmpPath string
+	file    *os.File
+	gz      *gzip.Writer
+	tw      *tar.Writer
+}
+
+// newZoneArchive creates a new archive that will be saved to path
+func newZoneArchive(path string) (*zoneArchive, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create archive %q: %w", path, err)
+	}
+	tmpPath := file.Name()
+	gz := gzip.NewWriter(file)
+	return &zoneArchive{
+		path:    path,
+		tmpPath: tmpPath,
+		file:    file,
+		gz:      gz,
+		tw:      tar.NewWriter(gz),
+	}, nil
+}
+
+// add copies the file at src into the archive as name
+// the tar format requires the size before the content, so zones are first downloaded to src
+func (za *zoneArchive) add(name, src string, modTime time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+
+	za.mutex.Lock()
+	defer za.mutex.Unlock()
+	err = za.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     0644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add %q to archive: %w", name, err)
+	}
+	_, err = io.Copy(za.tw, f)
+	if err != nil {
+		return fmt.Errorf("unable to add %q to archive: %w", name, err)
+	}
+	return nil
+}
+
+// syncFile flushes the archive to disk for -fsync, replaced by tests
+var syncFile = (*os.File).Sync
+
+// Close finishes writing the archive and moves it into place
+func (za *zoneArchive) Close() error {
+	za.mutex.Lock()
+	defer za.mutex.Unlock()
+	err := za.tw.Close()
+	if err == nil {
+		err = za.gz.Close()
+	}
+	if err == nil && *fsync {
+		err = syncFile(za.file)
+	}
+	closeErr := za.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(za.tmpPath, 0644)
+	}
+	if err != nil {
+		os.Remove(za.tmpPath)
+		return fmt.Errorf("unable to write archive %q: %w", za.tmpPath, err)
+	}
+	return os.Rename(za.tmpPath, za.path)
+}
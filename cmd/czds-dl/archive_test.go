@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lanrat/czds"
+)
+
+// readArchive returns the contents of each file in the tar.gz archive at path
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(data)
+	}
+}
+
+func TestArchiveDownload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "zones.tar.gz")
+	setFlags(t, map[string]string{
+		"archive":  path,
+		"parallel": "2",
+		"quiet":    "true",
+	})
+	var err error
+	arc, err = newZoneArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { arc = nil })
+	s := newDownloadServer(t, []string{"com", "net"}, "", false)
+	runDownloads(t, s.links())
+	if n := results.Count(czds.ZoneDownloaded); n != 2 {
+		t.Fatalf("downloaded %d zones, want 2: %+v", n, results.Zones)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("archive exists before it was closed: %v", err)
+	}
+
+	err = arc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"com.txt": "com zone", "net.txt": "net zone"}
+	if got := readArchive(t, path); !reflect.DeepEqual(got, want) {
+		t.Errorf("archive contains %v, want %v", got, want)
+	}
+	// the temporary files of the archive and zones are removed
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory contains %v, want only the archive", names)
+	}
+}
@@ -1,51 +1,114 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
-	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
 )
 
 // flags
 var (
 	username    = flag.String("username", "", "username to authenticate with")
 	password    = flag.String("password", "", "password to authenticate with")
-	passin      = flag.String("passin", "", "password source (default: prompt on tty; other options: cmd:command, env:var, file:path, keychain:name, lpass:name, op:name)")
+	configFile  = flag.String("config", "", "JSON config file with the username and passin to use when they are not passed as flags or environment variables, defaults to ~/.czds.json")
+	passin      = flag.String("passin", "", "password source (default: prompt on tty; other options: bw:name, cmd:command, env:var, file:path, gopass:path, keychain:name, lpass:name, op:name, stdin)")
 	parallel    = flag.Uint("parallel", 5, "number of zones to download in parallel")
 	outDir      = flag.String("out", ".", "path to save downloaded zones to")
 	urlName     = flag.Bool("urlname", false, "use the filename from the url link as the saved filename instead of the file header")
+	onlyChanged = flag.String("only-changed", "", "JSON manifest of a previous run, only download zones whose remote size or modification date differ from it, the manifest is created or updated after the run")
+	manifestAge = flag.Duration("manifest-max-age", 0, "with -only-changed, skip zones checked within this duration without checking them again, 0 to always check")
 	force       = flag.Bool("force", false, "force redownloading the zone even if it already exists on local disk with same size and modification date")
-	redownload  = flag.Bool("redownload", false, "redownload zones that are newer on the remote server than local copy")
+	redownload  = flag.Bool("redownload", false, "deprecated, existing zones are always redownloaded when their size differs or the remote copy is newer")
 	exclude     = flag.String("exclude", "", "don't fetch these zones")
 	verbose     = flag.Bool("verbose", false, "enable verbose logging")
+	debugHTTP   = flag.Bool("debug-http", false, "log every HTTP request and response, credentials are redacted")
 	retries     = flag.Uint("retries", 3, "max retry attempts per zone file download")
-	zone        = flag.String("zone", "", "comma separated list of zones to download, defaults to all")
+	breaker     = flag.Uint("circuit-breaker", 0, "after this many consecutive failed requests, fail all requests for a minute instead of retrying them, 0 to disable")
+	retryDelay  = flag.Duration("retry-delay", 15*time.Second, "base time to wait before retrying a failed zone download, randomized by ±50%")
+	zoneTimeout = flag.Duration("zone-timeout", 0, "max time for a single zone download attempt before it fails and is retried, 0 for no limit")
+	listOnly    = flag.Bool("list", false, "print the zones that would be downloaded and exit")
+	verifyOnly  = flag.Bool("verify", false, "compare the local zones in -out with the remote size and modification date without downloading, exits non-zero on any mismatch")
+	zones       = flag.String("zones", "", "comma separated list of zones to download, zones may also be passed as arguments, defaults to all")
+	smallest    = flag.Uint("smallest", 0, "only download the N smallest zones")
+	largest     = flag.Uint("largest", 0, "only download the N largest zones")
+	zonesFile   = flag.String("zones-file", "", "file with a zone to download on each line, '#' starts a comment, '-' for stdin")
+	zone        = flag.String("zone", "", "deprecated alias for -zones")
 	quiet       = flag.Bool("quiet", false, "suppress progress printing")
+	skipMissing = flag.Bool("skip-missing", false, "download the available zones passed with -zones instead of failing when some are not available, exits with status 4")
+	failFast    = flag.Bool("fail-fast", false, "stop downloading new zones once any zone fails all retry attempts")
+	showProg    = flag.Bool("progress", false, "show the progress of each download, as a live updating line per zone on a terminal or every 10% otherwise")
+	progFormat  = flag.String("progress-format", "text", "format of the -progress output: text, or json for newline delimited events on stderr")
 	showVersion = flag.Bool("version", false, "print version and exit")
+	testEnv     = flag.Bool("test", false, "use the CZDS test environment instead of production")
+	authURL     = flag.String("authurl", "", "override the CZDS authentication URL")
+	baseURL     = flag.String("baseurl", "", "override the CZDS API base URL")
+	userAgent   = flag.String("user-agent", "", "override the User-Agent header sent to CZDS, defaults to czds-go/<version>")
+	caCert      = flag.String("cacert", "", "file with additional PEM encoded CA certificates to trust, for TLS inspecting proxies")
+	insecure    = flag.Bool("insecure", false, "disable TLS certificate verification, only for test environments")
+	archive     = flag.String("archive", "", "save all downloaded zones into this tar.gz file instead of individual files in -out")
+	minSize     = flag.Int64("min-size", 0, "treat downloads smaller than this many bytes as failed and retry them")
+	verifyGzip  = flag.Bool("verify-gzip", false, "check that downloaded .gz zones are complete gzip streams before saving them, failed checks are retried")
+	maxBytes    = flag.Int64("max-bytes", 0, "stop all downloads once more than this many bytes have been downloaded in total, 0 for no limit")
+	checkSpace  = flag.Bool("check-space", false, "before downloading, check that the output filesystem has enough free space for all of the zones that need to be downloaded")
+	fsync       = flag.Bool("fsync", false, "sync each downloaded zone to disk before renaming it into place, for durability after a crash")
+	keepPartial = flag.Bool("keep-partial", false, "keep the partial temporary file of failed downloads for debugging instead of deleting it")
+	datestamp   = flag.Bool("datestamp", false, "add the zone's last modified date to the saved filename, ex: com.2024-06-01.zone")
+	noShuffle   = flag.Bool("no-shuffle", false, "download zones in alphabetical order instead of a random order")
+	shuffleSeed = flag.Int64("shuffle-seed", 0, "seed for the random download order to make it reproducible, defaults to a new seed each run")
+	nameTmpl    = flag.String("name-template", "", "go text/template for the saved filename, fields: {{.Zone}} {{.Date}} {{.Ext}} {{.Filename}}, ex: {{.Zone}}-{{.Date}}.{{.Ext}}")
 )
 
 var (
-	version   = "unknown"
-	loadDone  = make(chan bool)
-	inputChan = make(chan *zoneInfo, 100)
-	work      sync.WaitGroup
-	client    *czds.Client
+	version      = "unknown"
+	client       *czds.Client
+	prog         *progress
+	fileZones    []string
+	nameTemplate *template.Template
+	arc          *zoneArchive
+	prior        *manifest            // loaded from -only-changed
+	progOutput   cli.OutputFormat     // parsed from -progress-format
+	planned      map[string]*zoneInfo // zones to download keyed by their link
+	totalBytes   int64                // bytes downloaded by all workers, accessed atomically
+	maxBytesOnce sync.Once
+	results      czds.DownloadResult
+	resultsMutex sync.Mutex
 )
 
+// runCtx is the parent of every zone context, cancelRun stops all in-flight downloads
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// stopCtx is cancelled by stopDownloads, zones that have not started downloading then fail with errStopped
+var stopCtx, stopRun = context.WithCancelCause(runCtx)
+
+// errStopped is the error of zones that were not downloaded because stopDownloads was called
+var errStopped = errors.New("stopped before downloading")
+
 type zoneInfo struct {
 	Name     string
 	Dl       string
+	Info     *czds.DownloadInfo
+	FileName string
 	FullPath string
-	Count    int
+	Bytes    int64
+	Duration time.Duration
+	Skipped  bool
 }
 
 func v(format string, v ...interface{}) {
@@ -54,13 +117,86 @@ func v(format string, v ...interface{}) {
 	}
 }
 
+// isFlagSet returns true if the named flag was passed on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func checkFlags() {
-	flag.Parse()
+	cli.ParseFlags()
 	if *showVersion {
-		fmt.Printf("Version: %s\n", version)
+		fmt.Printf("Version: %s\n%s\n", version, czds.BuildInfo())
 		os.Exit(0)
 	}
+	err := cli.ApplyConfig(*configFile, username, password, passin)
+	if err != nil {
+		log.Fatalf("unable to load config: %s", err)
+	}
 	flagError := false
+	if len(*zone) != 0 {
+		log.Printf("'-zone' is deprecated, use '-zones'")
+	}
+	if *passin == "stdin" && *zonesFile == "-" {
+		log.Printf("'-passin stdin' cannot be combined with '-zones-file -'")
+		flagError = true
+	} else if len(*zonesFile) != 0 {
+		var err error
+		fileZones, err = cli.ReadZonesFile(*zonesFile)
+		if err != nil {
+			log.Print(err)
+			flagError = true
+		}
+	}
+	if len(*nameTmpl) != 0 {
+		var err error
+		nameTemplate, err = template.New("name").Option("missingkey=error").Parse(*nameTmpl)
+		if err != nil {
+			log.Printf("invalid '-name-template': %s", err)
+			flagError = true
+		}
+		if *datestamp {
+			log.Printf("'-name-template' and '-datestamp' cannot be combined, use {{.Date}}")
+			flagError = true
+		}
+	}
+	if *manifestAge != 0 && len(*onlyChanged) == 0 {
+		log.Printf("'-manifest-max-age' requires '-only-changed'")
+		flagError = true
+	}
+	if *noShuffle && isFlagSet("shuffle-seed") {
+		log.Printf("'-no-shuffle' and '-shuffle-seed' cannot be combined")
+		flagError = true
+	}
+	progOutput, err = cli.ParseFormat(*progFormat, cli.FormatText, cli.FormatJSON)
+	if err != nil {
+		log.Printf("'-progress-format' %s", err)
+		flagError = true
+	}
+	if *verifyOnly && len(*archive) != 0 {
+		log.Printf("'-verify' and '-archive' cannot be combined")
+		flagError = true
+	}
+	if *smallest > 0 && *largest > 0 {
+		log.Printf("'-smallest' and '-largest' cannot be combined")
+		flagError = true
+	}
+	if (*smallest > 0 || *largest > 0) && (*listOnly || *verifyOnly) {
+		log.Printf("'-smallest' and '-largest' cannot be combined with '-list' or '-verify'")
+		flagError = true
+	}
+	if *redownload {
+		log.Printf("'-redownload' is deprecated, changed zones are always redownloaded")
+	}
+	if *minSize < 0 {
+		log.Printf("min-size must not be negative")
+		flagError = true
+	}
 	if *parallel < 1 {
 		log.Printf("parallel must be positive")
 		flagError = true
@@ -73,198 +209,767 @@ func checkFlags() {
 		log.Printf("must pass either 'password' or 'passin'")
 		flagError = true
 	}
-	if len(*zone) != 0 && len(*exclude) != 0 {
-		log.Printf("'-zone' and '-exclude' cannot be combined")
+	if len(requestedZones()) != 0 && len(*exclude) != 0 {
+		log.Printf("'-zones' and '-exclude' cannot be combined")
 		flagError = true
 	}
 	if flagError {
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 }
 
 func main() {
 	checkFlags()
 
-	p := *password
-	if len(p) == 0 {
-		pass, err := czds.Getpass(*passin)
-		if err != nil {
-			log.Fatal("Unable to get password from user: ", err)
-		}
-		p = pass
+	p, err := cli.Password(runCtx, *password, *passin)
+	if err != nil {
+		log.Fatal("Unable to get password from user: ", err)
 	}
 
-	client = czds.NewClient(*username, p)
+	client = cli.NewClient(*username, p, *testEnv, *authURL, *baseURL)
+	tlsConf, err := cli.TLSConfig(*caCert, *insecure)
+	if err != nil {
+		log.Fatalf("unable to load TLS config: %s", err)
+	}
+	httpOpts := &czds.HTTPClientOptions{
+		MaxConns:  int(*parallel),
+		TLSConfig: tlsConf,
+	}
+	if *debugHTTP {
+		httpOpts.DebugLogger = log.Default()
+	}
+	client.HTTPClient = czds.NewHTTPClient(httpOpts)
+	client.CircuitBreakerThreshold = int(*breaker)
+	if len(*userAgent) != 0 {
+		client.UserAgent = *userAgent
+	}
 	if *verbose {
 		client.SetLogger(log.Default())
+		cli.PrintConfig(client)
 	}
 
 	// validate credentials
 	v("Authenticating to %s", client.AuthURL)
-	err := client.Authenticate()
+	err = client.Authenticate()
 	if err != nil {
-		log.Fatal(err)
+		cli.Fatal(err)
 	}
 
-	// create output directory if it does not exist
-	_, err = os.Stat(*outDir)
+	// start the czds Client
+	downloads, missing, err := getDownloadLinks()
 	if err != nil {
-		if os.IsNotExist(err) {
-			v("'%s' does not exist, creating", *outDir)
-			err = os.MkdirAll(*outDir, 0770)
-			if err != nil {
-				log.Fatal(err)
+		cli.Fatal(err)
+	}
+	if len(missing) > 0 {
+		warnSFTP(missing)
+		if !*skipMissing {
+			log.Fatalf("requested zones are not available: %v", missing)
+		}
+		log.Printf("warning: skipping requested zones that are not available: %v", missing)
+	}
+
+	if *listOnly {
+		printZones(downloads)
+		return
+	}
+
+	if *verifyOnly {
+		mismatches := verifyZones(downloads)
+		if mismatches > 0 {
+			log.Fatalf("%d zones do not match the remote copy", mismatches)
+		}
+		return
+	}
+
+	if len(*archive) != 0 {
+		arc, err = newZoneArchive(*archive)
+		if err != nil {
+			cli.Fatal(err)
+		}
+	} else {
+		// create output directory if it does not exist
+		_, err = os.Stat(*outDir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				v("'%s' does not exist, creating", *outDir)
+				err = os.MkdirAll(*outDir, 0770)
+				if err != nil {
+					log.Fatalf("unable to create output directory %q: %s", *outDir, err)
+				}
+			} else {
+				log.Fatalf("unable to access output directory %q: %s", *outDir, err)
 			}
+		}
+		// fail once up front instead of for every zone
+		err = checkWritable(*outDir)
+		if err != nil {
+			log.Fatalf("output directory %q is not writable: %s", *outDir, err)
+		}
+	}
+
+	seed := time.Now().UTC().UnixNano()
+	if isFlagSet("shuffle-seed") {
+		seed = *shuffleSeed
+	}
+	downloads = orderDownloads(downloads, seed)
+
+	if *showProg && !*quiet {
+		if progOutput == cli.FormatJSON {
+			prog = newProgress(os.Stderr, true)
 		} else {
+			prog = newProgress(os.Stdout, false)
+		}
+	}
+
+	if len(*onlyChanged) != 0 {
+		prior, err = loadManifest(*onlyChanged)
+		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	// start the czds Client
-	var downloads []string
-	if *zone == "" {
-		v("requesting download links")
-		downloads, err = client.GetLinks()
+	// start workers
+	start := time.Now()
+	v("checking %d zones", len(downloads))
+	zis := planDownloads(downloads)
+	if *checkSpace {
+		err = checkDiskSpace(zis)
 		if err != nil {
 			log.Fatal(err)
 		}
+	}
+	downloadZones(zis)
+	if prog != nil {
+		prog.Close()
+	}
+	if arc != nil {
+		err = arc.Close()
+		if err != nil {
+			cli.Fatal(err)
+		}
+		v("saved zones to archive %q", *archive)
+	}
+	if prior != nil {
+		err = prior.save()
+		if err != nil {
+			log.Print(err)
+		}
+	}
+	results.Duration = time.Since(start)
+	v("%d downloaded, %d skipped, %d failed", results.Count(czds.ZoneDownloaded), results.Count(czds.ZoneSkipped), results.Count(czds.ZoneFailed))
+	if !*quiet {
+		fmt.Println(summary(&results))
+	}
+	if prog != nil && prog.json {
+		writeSummaryEvent(&results)
+	}
+	if failed := results.Count(czds.ZoneFailed); failed > 0 {
+		log.Printf("%d zones failed to download", failed)
+	}
+	if status := exitStatus(missing); status != 0 {
+		os.Exit(status)
+	}
+}
+
+// exitStatus returns the exit status for the results of the run, 0 if every zone was downloaded or skipped
+// and none of the zones passed with -zones were missing
+func exitStatus(missing []string) int {
+	failed := results.Count(czds.ZoneFailed)
+	switch {
+	case failed > 0 && failed == len(results.Zones):
+		return cli.ExitError
+	case failed > 0, len(missing) > 0:
+		return cli.ExitPartial
+	}
+	return 0
+}
+
+// getDownloadLinks returns the links of the zones to download
+// and the names of any zones passed with -zones that are not available to download
+func getDownloadLinks() ([]string, []string, error) {
+	v("requesting download links")
+	links, err := client.GetLinks()
+	if err != nil {
+		return nil, nil, err
+	}
+	v("received %d zone links", len(links))
+	requested := requestedZones()
+	if len(requested) == 0 {
 		if len(*exclude) != 0 {
-			downloads = pruneLinks(downloads)
+			links = pruneLinks(links)
 		}
-		v("received %d zone links", len(downloads))
-	} else {
-		// this url path is not known for sure to be constant and may break in the future
-		for _, zoneName := range strings.Split(*zone, ",") {
-			u, _ := url.Parse(czds.BaseURL)
-			u.Path = path.Join(u.Path, "/czds/downloads/", fmt.Sprintf("%s.zone", strings.ToLower(zoneName)))
-			downloads = append(downloads, u.String())
+		return links, nil, nil
+	}
+
+	available := make(map[string]string, len(links))
+	for _, link := range links {
+		available[strings.ToLower(path.Base(link))] = link
+	}
+	downloads := make([]string, 0)
+	missing := make([]string, 0)
+	for _, zoneName := range requested {
+		link, ok := available[fmt.Sprintf("%s.zone", zoneName)]
+		if !ok {
+			missing = append(missing, zoneName)
+			continue
 		}
+		downloads = append(downloads, link)
 	}
+	return downloads, missing, nil
+}
 
-	// shuffle download links to better distribute load on CZDS
-	downloads = shuffle(downloads)
+// warnSFTP warns about the missing zones that are approved but only delivered over SFTP, so have no download link
+// the TLD status is only fetched when zones are missing to keep it out of the normal run
+func warnSFTP(missing []string) {
+	allStatus, err := client.GetTLDStatus()
+	if err != nil {
+		// only used for the warning, not fatal
+		v("unable to check for SFTP zones: %s", err)
+		return
+	}
+	missingMap := make(map[string]bool, len(missing))
+	for _, zone := range missing {
+		missingMap[strings.ToLower(zone)] = true
+	}
+	sftp := make([]string, 0)
+	for _, status := range allStatus {
+		if status.SFTP && status.CurrentStatus == czds.StatusApproved && missingMap[strings.ToLower(status.TLD)] {
+			sftp = append(sftp, status.TLD)
+		}
+	}
+	if len(sftp) > 0 {
+		log.Printf("warning: %d approved zones are delivered over SFTP and can not be downloaded: %v", len(sftp), sftp)
+	}
+}
 
-	// start workers
-	go addLinks(downloads)
-	v("starting %d parallel downloads", *parallel)
-	for i := uint(0); i < *parallel; i++ {
-		go worker()
+// printZones prints the sorted zone names of the provided download links
+func printZones(links []string) {
+	names := make([]string, 0, len(links))
+	for _, link := range links {
+		names = append(names, strings.TrimSuffix(path.Base(link), ".zone"))
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+// requestedZones returns the deduplicated zones passed with -zones, -zone, -zones-file, and as arguments
+// zones are lowercased, unicode zones are encoded to punycode, and any ".zone" suffix is removed
+func requestedZones() []string {
+	names := make([]string, 0)
+	for _, list := range []string{*zones, *zone} {
+		if len(list) != 0 {
+			names = append(names, strings.Split(list, ",")...)
+		}
+	}
+	names = append(names, fileZones...)
+	names = append(names, flag.Args()...)
+	seen := make(map[string]bool, len(names))
+	zones := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".zone")
+		if ascii, err := czds.ToASCII(name); err == nil {
+			name = ascii
+		}
+		if len(name) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		zones = append(zones, name)
 	}
+	return zones
+}
 
-	// wait for workers to finish
-	<-loadDone
-	work.Wait()
+// stopDownloads prevents any new zone downloads from starting
+func stopDownloads() {
+	if !aborted() {
+		log.Printf("stopping remaining downloads")
+		stopRun(errStopped)
+	}
 }
 
-func addLinks(downloads []string) {
-	for _, dl := range downloads {
-		work.Add(1)
-		inputChan <- &zoneInfo{
-			Name:  path.Base(dl),
-			Dl:    dl,
-			Count: 1,
+// aborted returns true if stopDownloads has been called
+func aborted() bool {
+	return stopCtx.Err() != nil
+}
+
+// summary returns a single line describing the total downloads in results
+func summary(results *czds.DownloadResult) string {
+	var bytes int64
+	for _, zone := range results.Zones {
+		if zone.Status == czds.ZoneDownloaded {
+			bytes += zone.Bytes
 		}
 	}
-	loadDone <- true
+	rate := int64(0)
+	if results.Duration > 0 {
+		rate = int64(float64(bytes) / results.Duration.Seconds())
+	}
+	return fmt.Sprintf("Downloaded %s zones (%s) in %s (%s/s), %d failed",
+		formatCount(results.Count(czds.ZoneDownloaded)), formatBytes(bytes),
+		results.Duration.Round(time.Second), formatBytes(rate), results.Count(czds.ZoneFailed))
+}
+
+// summaryEvent is written at the end of the run with -progress-format json
+type summaryEvent struct {
+	Event      string `json:"event"`
+	Downloaded int    `json:"downloaded"`
+	Skipped    int    `json:"skipped"`
+	Failed     int    `json:"failed"`
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"duration_ms"`
 }
 
-func worker() {
-	for {
-		zi, more := <-inputChan
-		if more {
-			// do work
-			err := zoneDownload(zi)
+// writeSummaryEvent writes a summaryEvent for results to stderr
+func writeSummaryEvent(results *czds.DownloadResult) {
+	event := summaryEvent{
+		Event:      "summary",
+		Downloaded: results.Count(czds.ZoneDownloaded),
+		Skipped:    results.Count(czds.ZoneSkipped),
+		Failed:     results.Count(czds.ZoneFailed),
+		DurationMs: results.Duration.Milliseconds(),
+	}
+	for _, zone := range results.Zones {
+		if zone.Status == czds.ZoneDownloaded {
+			event.Bytes += zone.Bytes
+		}
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
+// addResult records the final outcome of the zone download
+func addResult(zi *zoneInfo, err error) {
+	result := czds.ZoneResult{
+		Zone:     strings.TrimSuffix(zi.Name, ".zone"),
+		URL:      zi.Dl,
+		Path:     zi.FullPath,
+		Bytes:    zi.Bytes,
+		Duration: zi.Duration,
+		Status:   czds.ZoneDownloaded,
+		Err:      err,
+	}
+	if err != nil {
+		result.Status = czds.ZoneFailed
+	} else if zi.Skipped {
+		result.Status = czds.ZoneSkipped
+	}
+	resultsMutex.Lock()
+	results.Zones = append(results.Zones, result)
+	resultsMutex.Unlock()
+	if prior != nil {
+		prior.record(zi, err)
+	}
+}
+
+// planDownloads checks all of the zones in parallel and returns the zones that need to be downloaded
+// unchanged zones are recorded as skipped, zones that could not be checked are left to the workers to retry
+func planDownloads(links []string) []*zoneInfo {
+	opts := bulkOptions()
+	zis := make([]*zoneInfo, len(links))
+	needed := make([]bool, len(links))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, dl := range links {
+		zis[i] = &zoneInfo{
+			Name: path.Base(dl),
+			Dl:   dl,
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(zi *zoneInfo, needed *bool) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if prior != nil && !*force && prior.fresh(zi) {
+				v("[%s] checked recently according to the manifest, skipping", zi.Name)
+				return
+			}
+			ctx, cancel := zoneContext()
+			defer cancel()
+			need, err := planZone(ctx, zi, opts)
 			if err != nil {
-				// don't stop on an error that only affects a single zone
-				// fixes occasional HTTP 500s from CZDS
-				v("[%s] err: %s", path.Base(zi.Dl), err)
-				zi.Count++
-				if uint(zi.Count) < *retries {
-					work.Add(1)
-					// requeue in another goroutine to prevent blocking
-					go func() {
-						inputChan <- zi
-					}()
-				} else {
-					log.Printf("[%s] Max fail count hit; not downloading.", path.Base(zi.Dl))
-					if _, err := os.Stat(zi.FullPath); !os.IsNotExist(err) {
-						err = os.Remove(zi.FullPath)
-						if err != nil {
-							// log but continue; not fatal
-							log.Printf("[%s] %s", zi.Dl, err)
-						}
-					}
-				}
+				v("[%s] unable to check zone, will retry: %s", zi.Name, err)
+				zi.Info = nil
+				need = true
 			}
-			work.Done()
+			*needed = need
+		}(zis[i], &needed[i])
+	}
+	wg.Wait()
+
+	if *smallest > 0 || *largest > 0 {
+		zis, needed = selectBySize(zis, needed)
+	}
+
+	out := make([]*zoneInfo, 0, len(zis))
+	for i, zi := range zis {
+		if needed[i] {
+			out = append(out, zi)
+			continue
+		}
+		zi.Skipped = true
+		addResult(zi, nil)
+	}
+	v("%d zones need to be downloaded", len(out))
+	return out
+}
+
+// selectBySize returns only the -smallest or -largest zones from zis and their matching needed values
+// zones of unknown size are never selected
+func selectBySize(zis []*zoneInfo, needed []bool) ([]*zoneInfo, []bool) {
+	idx := make([]int, 0, len(zis))
+	for i, zi := range zis {
+		if zi.Info != nil && zi.Info.ContentLength >= 0 {
+			idx = append(idx, i)
 		} else {
-			// done
-			return
+			v("[%s] size unknown, not selecting", zi.Name)
+		}
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		sizeA, sizeB := zis[idx[a]].Info.ContentLength, zis[idx[b]].Info.ContentLength
+		if *largest > 0 {
+			return sizeA > sizeB
+		}
+		return sizeA < sizeB
+	})
+	n := int(*smallest + *largest)
+	if n < len(idx) {
+		idx = idx[:n]
+	}
+	selected := make([]*zoneInfo, 0, len(idx))
+	selectedNeeded := make([]bool, 0, len(idx))
+	for _, i := range idx {
+		v("[%s] selected, %s", zis[i].Name, formatBytes(zis[i].Info.ContentLength))
+		selected = append(selected, zis[i])
+		selectedNeeded = append(selectedNeeded, needed[i])
+	}
+	return selected, selectedNeeded
+}
+
+// downloadZones downloads zis with BulkDownloadWithContext, which runs -parallel downloads and retries failed zones
+// -fail-fast and -max-bytes stop the zones that have not started yet
+func downloadZones(zis []*zoneInfo) {
+	planned = make(map[string]*zoneInfo, len(zis))
+	urls := make([]string, 0, len(zis))
+	for _, zi := range zis {
+		planned[zi.Dl] = zi
+		urls = append(urls, zi.Dl)
+	}
+	delay := *retryDelay
+	if delay == 0 {
+		// retry right away instead of using the library default
+		delay = -1
+	}
+	opts := bulkOptions()
+	opts.Parallel = int(*parallel)
+	opts.Retries = int(*retries)
+	opts.RetryDelay = delay
+	opts.Attempt = func(_ context.Context, url string) (string, int64, bool, error) {
+		return attemptZone(url, opts)
+	}
+	if opts.Retries < 1 {
+		opts.Retries = 1
+	}
+	v("starting %d parallel downloads", *parallel)
+	zoneResults, err := client.BulkDownloadWithContext(stopCtx, urls, opts)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	for result := range zoneResults {
+		zi := planned[result.URL]
+		zi.FullPath = result.Path
+		zi.Bytes = result.Bytes
+		zi.Duration = result.Duration
+		zi.Skipped = result.Status == czds.ZoneSkipped
+		if result.Err != nil {
+			if errors.Is(result.Err, errStopped) || errors.Is(result.Err, errMaxBytes) {
+				log.Printf("[%s] stopped: %s", zi.Name, result.Err)
+			} else {
+				log.Printf("[%s] Max fail count hit; not downloading.", zi.Name)
+			}
+		}
+		addResult(zi, result.Err)
+		if result.Err != nil && *failFast {
+			stopDownloads()
 		}
 	}
 }
 
-func zoneDownload(zi *zoneInfo) error {
+// attemptZone makes a single attempt to download the zone at url for BulkDownloadWithContext
+// the attempt runs under runCtx instead of the stop context, so -fail-fast lets the downloads in flight finish
+func attemptZone(url string, opts *czds.BulkDownloadOptions) (string, int64, bool, error) {
+	zi := planned[url]
+	ctx, cancel := zoneContext()
+	defer cancel()
 	v("downloading '%s'", zi.Dl)
-	info, err := client.GetDownloadInfo(zi.Dl)
+	if zi.Info == nil {
+		_, err := planZone(ctx, zi, opts)
+		if err != nil {
+			zi.Info = nil
+			return "", 0, false, err
+		}
+	}
+	start := time.Now()
+	fullPath, n, skipped, err := client.BulkDownloadAttempt(ctx, zi.Dl, zi.Info, opts)
+	if err != nil {
+		// check the zone again on the next attempt
+		zi.Info = nil
+		err = fmt.Errorf("[%s] %w", zi.Name, err)
+		if *keepPartial {
+			log.Print(err)
+		}
+		return "", n, false, err
+	}
+	if !*quiet && !skipped {
+		delta := time.Since(start).Round(time.Millisecond)
+		printf("downloaded %s in %s\n", zi.Name, delta)
+	}
+	return fullPath, n, skipped, nil
+}
+
+// zoneContext returns the context for a single zone download attempt, limited by -zone-timeout
+func zoneContext() (context.Context, context.CancelFunc) {
+	if *zoneTimeout > 0 {
+		return context.WithTimeout(runCtx, *zoneTimeout)
+	}
+	return context.WithCancel(runCtx)
+}
+
+// planZone fetches the zone's download info and returns true if BulkDownloadAttempt would download it
+func planZone(ctx context.Context, zi *zoneInfo, opts *czds.BulkDownloadOptions) (bool, error) {
+	info, err := client.GetDownloadInfoWithContext(ctx, zi.Dl)
 	if err != nil {
-		return fmt.Errorf("%s [%s]", err, zi.Dl)
+		return false, fmt.Errorf("%s [%s]", err, zi.Dl)
 	}
+	zi.Info = info
+	zi.Bytes = info.ContentLength
+	zi.FileName, err = localFilename(zi, info)
+	if err != nil {
+		return false, err
+	}
+	fullPath, needed, err := client.CheckBulkDownload(zi.Dl, info, opts)
+	if err != nil {
+		return false, fmt.Errorf("[%s] %w", zi.Name, err)
+	}
+	zi.FullPath = fullPath
+	return needed, nil
+}
+
+// bulkOptions returns the options to check and download the zones with, from the flags
+func bulkOptions() *czds.BulkDownloadOptions {
+	opts := &czds.BulkDownloadOptions{
+		OutDir:      *outDir,
+		Force:       *force,
+		MinSize:     *minSize,
+		VerifyGzip:  *verifyGzip,
+		Fsync:       *fsync,
+		KeepPartial: *keepPartial,
+		FileName: func(url string, info *czds.DownloadInfo) (string, error) {
+			return localFilename(&zoneInfo{Name: path.Base(url), Dl: url}, info)
+		},
+	}
+	if prior != nil {
+		opts.Unchanged = func(url string, info *czds.DownloadInfo) bool {
+			return prior.unchanged(&zoneInfo{Name: path.Base(url), Dl: url, Info: info})
+		}
+	}
+	if prog != nil || *maxBytes > 0 {
+		opts.Writer = zoneWriter
+	}
+	if arc != nil {
+		// the zones are downloaded next to the archive and added to it once complete
+		opts.OutDir = filepath.Dir(*archive)
+		// the zone is only a scratch file, the archive is synced when it is closed
+		opts.Fsync = false
+		opts.Save = func(name, tmpPath string, info *czds.DownloadInfo) (string, error) {
+			err := arc.add(name, tmpPath, info.LastModified)
+			if err != nil {
+				return "", err
+			}
+			return *archive, nil
+		}
+	}
+	return opts
+}
+
+// zoneWriter returns the writer for the progress of the zone at url and -max-bytes
+func zoneWriter(url string, info *czds.DownloadInfo) (io.Writer, func()) {
+	var writers []io.Writer
+	done := func() {}
+	if prog != nil {
+		pw := prog.add(path.Base(url), info.ContentLength)
+		writers = append(writers, pw)
+		done = func() { prog.remove(pw) }
+	}
+	if *maxBytes > 0 {
+		writers = append(writers, byteLimiter{})
+	}
+	return io.MultiWriter(writers...), done
+}
+
+// localFilename returns the name to save the zone as
+func localFilename(zi *zoneInfo, info *czds.DownloadInfo) (string, error) {
 	// use filename from url or header?
-	localFileName := info.Filename
+	name := info.Filename
 	if *urlName {
-		localFileName = path.Base(zi.Dl)
+		name = path.Base(zi.Dl)
 	}
-	zi.FullPath = path.Join(*outDir, localFileName)
-	localFileInfo, err := os.Stat(zi.FullPath)
-	if *force {
-		v("forcing download of '%s'", zi.Dl)
-		return downloadTime(zi)
+	if *datestamp {
+		name = addDatestamp(name, info.LastModified)
 	}
-	// check if local file already exists
-	if err == nil && *redownload {
-		// check local file size
-		if localFileInfo.Size() != info.ContentLength {
-			// size differs, redownload
-			v("size of local file (%d) differs from remote (%d), redownloading %s", localFileInfo.Size(), info.ContentLength, localFileName)
-			return downloadTime(zi)
+	if nameTemplate != nil {
+		var err error
+		name, err = executeNameTemplate(zi, name, info.LastModified)
+		if err != nil {
+			return "", err
 		}
-		// check local file modification date
-		if localFileInfo.ModTime().Before(info.LastModified) {
-			// remote file is newer, redownload
-			v("remote file is newer than local, redownloading")
-			return downloadTime(zi)
+	}
+	// the name is provided by the server, do not allow it to escape the output directory
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("[%s] unsafe filename %q", zi.Name, name)
+	}
+	return name, nil
+}
+
+// addDatestamp inserts the date into name before its extension
+// ex: com.txt.gz becomes com.2024-06-01.txt.gz
+func addDatestamp(name string, date time.Time) string {
+	stamp := zoneDate(date)
+	base, ext, found := strings.Cut(name, ".")
+	if !found {
+		return name + "." + stamp
+	}
+	return base + "." + stamp + "." + ext
+}
+
+// zoneDate formats the zone's last modified date for filenames
+// the current date is used if the server did not send a Last-Modified header
+func zoneDate(date time.Time) string {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return date.UTC().Format("2006-01-02")
+}
+
+// nameFields are the fields available to -name-template
+type nameFields struct {
+	Zone     string // ex: com
+	Date     string // last modified date, or the current date if unknown, ex: 2024-06-01
+	Ext      string // extension of Filename, ex: txt.gz
+	Filename string // the name the zone would be saved as without a template
+}
+
+// executeNameTemplate returns the filename produced by -name-template for the zone
+func executeNameTemplate(zi *zoneInfo, filename string, date time.Time) (string, error) {
+	fields := nameFields{
+		Zone:     strings.TrimSuffix(zi.Name, ".zone"),
+		Date:     zoneDate(date),
+		Filename: filename,
+	}
+	_, fields.Ext, _ = strings.Cut(filename, ".")
+	var b strings.Builder
+	err := nameTemplate.Execute(&b, fields)
+	if err != nil {
+		return "", fmt.Errorf("[%s] unable to execute '-name-template': %w", zi.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// spaceAvailable returns the bytes available on the filesystem containing a directory, replaced by tests
+var spaceAvailable = availableSpace
+
+// checkDiskSpace returns an error if the filesystem the zones are saved to does not have enough free space for zis
+// zones with an unknown size are not counted
+func checkDiskSpace(zis []*zoneInfo) error {
+	var needed uint64
+	unknown := 0
+	for _, zi := range zis {
+		if zi.Info == nil || zi.Info.ContentLength < 0 {
+			unknown++
+			continue
 		}
-		// local copy is good, skip download
-		v("local file '%s' matched remote, skipping", localFileName)
+		needed += uint64(zi.Info.ContentLength)
 	}
-	if os.IsNotExist(err) {
-		// file does not exist, download
-		return downloadTime(zi)
+	dir := *outDir
+	if arc != nil {
+		dir = filepath.Dir(*archive)
 	}
-	return err
+	available, err := spaceAvailable(dir)
+	if err != nil {
+		log.Printf("unable to check available disk space, continuing: %s", err)
+		return nil
+	}
+	v("%s needed for %d zones (%d zones of unknown size), %s available in %q",
+		formatBytes(int64(needed)), len(zis)-unknown, unknown, formatBytes(int64(available)), dir)
+	if needed > available {
+		return fmt.Errorf("not enough disk space in %q: %s needed for %d zones, only %s available",
+			dir, formatBytes(int64(needed)), len(zis)-unknown, formatBytes(int64(available)))
+	}
+	return nil
 }
 
-// downloadTime downloads the zoneInfo and prints the time taken
-func downloadTime(zi *zoneInfo) error {
-	// file does not exist, download
-	start := time.Now()
-	err := client.DownloadZone(zi.Dl, zi.FullPath)
+// checkWritable creates and removes a file in dir to check that downloads can be saved there
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".czds-dl-probe-*")
 	if err != nil {
 		return err
 	}
-	if !*quiet {
-		delta := time.Since(start).Round(time.Millisecond)
-		fmt.Printf("downloaded %s in %s\n", zi.Name, delta)
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// errMaxBytes is returned by downloads stopped by -max-bytes
+var errMaxBytes = errors.New("stopped by -max-bytes")
+
+// byteLimiter is an io.Writer that counts the bytes downloaded by all workers
+// and stops all downloads once -max-bytes is exceeded
+type byteLimiter struct{}
+
+// Write counts the bytes written and returns errMaxBytes once -max-bytes is exceeded
+func (byteLimiter) Write(b []byte) (int, error) {
+	total := atomic.AddInt64(&totalBytes, int64(len(b)))
+	if total <= *maxBytes {
+		return len(b), nil
 	}
-	return nil
+	maxBytesOnce.Do(func() {
+		log.Printf("downloaded more than -max-bytes %s", formatBytes(*maxBytes))
+		stopDownloads()
+		cancelRun()
+	})
+	return 0, errMaxBytes
+}
+
+// printf prints to stdout without interfering with the progress output
+func printf(format string, a ...interface{}) {
+	if prog != nil {
+		prog.Printf(format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+// orderDownloads returns the download links in the order they are downloaded
+// they are sorted with -no-shuffle, otherwise shuffled with seed to better distribute load on CZDS
+func orderDownloads(downloads []string, seed int64) []string {
+	// sort first so that the shuffled order only depends on the seed
+	sort.Strings(downloads)
+	if *noShuffle {
+		return downloads
+	}
+	v("shuffling zones with seed %d", seed)
+	return shuffle(downloads, seed)
 }
 
-func shuffle(src []string) []string {
+// shuffle returns src in a random order, the same seed always results in the same order
+func shuffle(src []string, seed int64) []string {
 	final := make([]string, len(src))
-	rand.Seed(time.Now().UTC().UnixNano())
-	perm := rand.Perm(len(src))
+	perm := rand.New(rand.NewSource(seed)).Perm(len(src))
 
 	for i, v := range perm {
 		final[v] = src[i]
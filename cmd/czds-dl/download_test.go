@@ -0,0 +1,1601 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+func TestAttemptZoneErrorContext(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "blocker")
+	err := os.WriteFile(blocker, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"missing directory", filepath.Join(dir, "missing")},
+		{"parent is a file", blocker},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"out": tt.out, "quiet": "true"})
+			s := newDownloadServer(t, []string{"com"}, "", false)
+			link := s.links()[0]
+			planned = map[string]*zoneInfo{link: {Name: "com.zone", Dl: link}}
+			_, _, _, err := attemptZone(link, bulkOptions())
+			if err == nil {
+				t.Fatal("attemptZone() succeeded, want error")
+			}
+			for _, want := range []string{"[com.zone]", tt.out} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not include %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		downloaded int
+		skipped    int
+		failed     int
+		bytes      int64 // of each downloaded zone
+		duration   time.Duration
+		want       string
+	}{
+		{"empty", 0, 0, 0, 0, 0, "Downloaded 0 zones (0 B) in 0s (0 B/s), 0 failed"},
+		{"mixed", 1234, 10, 2, 1000, 2 * time.Second, "Downloaded 1,234 zones (1.2 MB) in 2s (617.0 kB/s), 2 failed"},
+		{"skipped bytes are not counted", 1, 5, 0, 45600000000, 12*time.Minute + 3*time.Second, "Downloaded 1 zones (45.6 GB) in 12m3s (63.1 MB/s), 0 failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+			// record the results concurrently as the downloads do
+			var wg sync.WaitGroup
+			add := func(n int, bytes int64, skipped bool, err error) {
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						addResult(&zoneInfo{Name: fmt.Sprintf("z%d.zone", i), Bytes: bytes, Skipped: skipped}, err)
+					}(i)
+				}
+			}
+			add(tt.downloaded, tt.bytes, false, nil)
+			add(tt.skipped, tt.bytes, true, nil)
+			add(tt.failed, 0, false, errors.New("failed"))
+			wg.Wait()
+			results.Duration = tt.duration
+
+			if n := len(results.Zones); n != tt.downloaded+tt.skipped+tt.failed {
+				t.Fatalf("recorded %d results, want %d", n, tt.downloaded+tt.skipped+tt.failed)
+			}
+			if got := summary(&results); got != tt.want {
+				t.Errorf("summary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{1234567, "1,234,567"},
+	}
+	for _, tt := range tests {
+		if got := formatCount(tt.n); got != tt.want {
+			t.Errorf("formatCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+// setFlags sets the command line flags for the test and restores them after
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	for name, value := range values {
+		name := name
+		old := flag.Lookup(name).Value.String()
+		err := flag.Set(name, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { flag.Set(name, old) })
+	}
+}
+
+// zoneModified is the last modified date of the zones served by downloadServer
+var zoneModified = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// downloadServer is a fake CZDS server with download links for zones
+// GETs of the fail zone always fail, and the GETs of the other zones wait for stopDownloads when block is set
+type downloadServer struct {
+	*httptest.Server
+	token   string
+	zones   []string
+	fail    string
+	block   bool
+	tlds    []czds.TLDStatus  // served by /czds/tlds
+	slow    string            // GETs of this zone stall after the first half of the zone until the client gives up
+	bare    bool              // omit the Content-Length and Last-Modified headers
+	undated bool              // omit the Last-Modified header
+	gz      map[string][]byte // zones served as <zone>.txt.gz with these contents
+
+	mutex sync.Mutex
+	gets  map[string]int
+	heads map[string]int
+
+	headDelay time.Duration // time each HEAD takes
+	inHead    atomic.Int32  // HEADs in progress
+	headPeak  atomic.Int32  // most HEADs in progress at once
+
+	tldRequests atomic.Int32 // requests for /czds/tlds
+}
+
+func (s *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/authenticate" {
+		json.NewEncoder(w).Encode(map[string]string{"accessToken": s.token, "message": "ok"})
+		return
+	}
+	if r.URL.Path == "/czds/downloads/links" {
+		json.NewEncoder(w).Encode(s.links())
+		return
+	}
+	if r.URL.Path == "/czds/tlds" {
+		s.tldRequests.Add(1)
+		tlds := s.tlds
+		if tlds == nil {
+			tlds = []czds.TLDStatus{}
+		}
+		json.NewEncoder(w).Encode(tlds)
+		return
+	}
+	zone := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/czds/downloads/"), ".zone")
+	if r.Method == http.MethodHead && s.headDelay > 0 {
+		n := s.inHead.Add(1)
+		for {
+			peak := s.headPeak.Load()
+			if n <= peak || s.headPeak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(s.headDelay)
+		s.inHead.Add(-1)
+	}
+	if r.Method == http.MethodHead {
+		s.mutex.Lock()
+		s.heads[zone]++
+		s.mutex.Unlock()
+	}
+	if r.Method == http.MethodGet {
+		s.mutex.Lock()
+		s.gets[zone]++
+		s.mutex.Unlock()
+		if zone == s.fail {
+			http.Error(w, "failed", http.StatusInternalServerError)
+			return
+		}
+		if s.block {
+			select {
+			case <-stopCtx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+	data := []byte(zone + " zone")
+	filename := zone + ".txt"
+	if gz, ok := s.gz[zone]; ok {
+		data = gz
+		filename += ".gz"
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	if s.bare {
+		w.Header().Set("Transfer-Encoding", "chunked")
+	} else {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if !s.undated {
+			w.Header().Set("Last-Modified", zoneModified.Format(http.TimeFormat))
+		}
+	}
+	if r.Method == http.MethodGet && zone == s.slow {
+		w.Write(data[:len(data)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+// links returns the download links of the zones
+func (s *downloadServer) links() []string {
+	links := make([]string, 0, len(s.zones))
+	for _, zone := range s.zones {
+		links = append(links, s.URL+"/czds/downloads/"+zone+".zone")
+	}
+	return links
+}
+
+// newDownloadServer starts a downloadServer and points the client at it
+func newDownloadServer(t *testing.T, zones []string, fail string, block bool) *downloadServer {
+	t.Helper()
+	s := &downloadServer{token: clitest.JWT(t), zones: zones, fail: fail, block: block, gets: make(map[string]int), heads: make(map[string]int)}
+	// the server is only started once s.Server is set, as the handler reads s.URL
+	s.Server = httptest.NewUnstartedServer(s)
+	s.Start()
+	t.Cleanup(s.Close)
+	client = czds.NewClient("user", "pass")
+	client.AuthURL = s.URL + "/api/authenticate"
+	client.BaseURL = s.URL
+	t.Cleanup(func() { client = nil })
+	return s
+}
+
+// runDownloads downloads links with downloadZones as a new run, the results are cleared after the test
+func runDownloads(t *testing.T, links []string) {
+	t.Helper()
+	stopCtx, stopRun = context.WithCancelCause(runCtx)
+	results = czds.DownloadResult{}
+	t.Cleanup(func() { results = czds.DownloadResult{} })
+	zis := make([]*zoneInfo, 0, len(links))
+	for _, dl := range links {
+		zis = append(zis, &zoneInfo{Name: path.Base(dl), Dl: dl})
+	}
+	downloadZones(zis)
+}
+
+func TestDownloadZonesFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		status   map[string]string // expected status of the zones that are not in stopped
+		stopped  []string          // zones that must not be downloaded
+		wantExit []int             // allowed exit statuses
+	}{
+		{
+			name:     "continue",
+			status:   map[string]string{"bad": czds.ZoneFailed, "com": czds.ZoneDownloaded, "net": czds.ZoneDownloaded, "org": czds.ZoneDownloaded},
+			wantExit: []int{cli.ExitPartial},
+		},
+		{
+			name:     "fail fast",
+			failFast: true,
+			status:   map[string]string{"bad": czds.ZoneFailed},
+			// com may start before the failure stops the run, the zones after it can not
+			stopped:  []string{"net", "org"},
+			wantExit: []int{cli.ExitPartial, cli.ExitError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{
+				"out":         t.TempDir(),
+				"parallel":    "1",
+				"retries":     "2",
+				"retry-delay": "1ms",
+				"quiet":       "true",
+				"fail-fast":   strconv.FormatBool(tt.failFast),
+			})
+			s := newDownloadServer(t, []string{"bad", "com", "net", "org"}, "bad", tt.failFast)
+			runDownloads(t, s.links())
+
+			got := make(map[string]czds.ZoneResult)
+			for _, result := range results.Zones {
+				got[result.Zone] = result
+			}
+			if len(got) != len(s.zones) {
+				t.Fatalf("got %d results, want %d", len(got), len(s.zones))
+			}
+			for zone, want := range tt.status {
+				if got[zone].Status != want {
+					t.Errorf("[%s] status = %q, want %q, err: %v", zone, got[zone].Status, want, got[zone].Err)
+				}
+			}
+			if n := s.gets["bad"]; n != 2 {
+				t.Errorf("bad zone downloaded %d times, want 2", n)
+			}
+			for _, zone := range tt.stopped {
+				if !errors.Is(got[zone].Err, errStopped) {
+					t.Errorf("[%s] err = %v, want %v", zone, got[zone].Err, errStopped)
+				}
+				if n := s.gets[zone]; n != 0 {
+					t.Errorf("[%s] downloaded %d times after the run was stopped", zone, n)
+				}
+			}
+			status := exitStatus(nil)
+			if !slices.Contains(tt.wantExit, status) {
+				t.Errorf("exitStatus() = %d, want one of %v", status, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		missing  []string
+		want     int
+	}{
+		{"all downloaded", []string{czds.ZoneDownloaded, czds.ZoneSkipped}, nil, 0},
+		{"some failed", []string{czds.ZoneDownloaded, czds.ZoneFailed}, nil, cli.ExitPartial},
+		{"all failed", []string{czds.ZoneFailed, czds.ZoneFailed}, nil, cli.ExitError},
+		{"missing zones", []string{czds.ZoneDownloaded}, []string{"example"}, cli.ExitPartial},
+		{"nothing to download", nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+			for _, status := range tt.statuses {
+				results.Zones = append(results.Zones, czds.ZoneResult{Status: status})
+			}
+			if got := exitStatus(tt.missing); got != tt.want {
+				t.Errorf("exitStatus() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// linkZones returns the zone names of links
+func linkZones(links []string) []string {
+	zones := make([]string, 0, len(links))
+	for _, link := range links {
+		zones = append(zones, strings.TrimSuffix(path.Base(link), ".zone"))
+	}
+	return zones
+}
+
+func TestGetDownloadLinksMissing(t *testing.T) {
+	tests := []struct {
+		name        string
+		zones       string
+		want        []string
+		wantMissing []string
+		wantExit    int
+	}{
+		{"all available", "com,net", []string{"com", "net"}, []string{}, 0},
+		{"some missing", "com,notazone,net", []string{"com", "net"}, []string{"notazone"}, cli.ExitPartial},
+		{"all missing", "notazone", []string{}, []string{"notazone"}, cli.ExitPartial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"zones": tt.zones})
+			newDownloadServer(t, []string{"com", "net", "org"}, "", false)
+
+			downloads, missing, err := getDownloadLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linkZones(downloads); !slices.Equal(got, tt.want) {
+				t.Errorf("getDownloadLinks() downloads = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(missing, tt.wantMissing) {
+				t.Errorf("getDownloadLinks() missing = %v, want %v", missing, tt.wantMissing)
+			}
+			// the available zones downloaded, the missing ones are still reported by the exit status
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+			for _, zone := range downloads {
+				results.Zones = append(results.Zones, czds.ZoneResult{Zone: zone, Status: czds.ZoneDownloaded})
+			}
+			if got := exitStatus(missing); got != tt.wantExit {
+				t.Errorf("exitStatus() = %d, want %d", got, tt.wantExit)
+			}
+		})
+	}
+}
+
+// setArgs sets the positional command line arguments for the test and restores them after
+func setArgs(t *testing.T, args []string) {
+	t.Helper()
+	old := flag.Args()
+	err := flag.CommandLine.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.CommandLine.Parse(old) })
+}
+
+func TestGetDownloadLinksDeduplicated(t *testing.T) {
+	tests := []struct {
+		name  string
+		zones string
+		args  []string
+		want  []string
+	}{
+		{"flag", "com,COM,com.zone", nil, []string{"com"}},
+		{"arguments", "", []string{"com", "COM", "com.zone"}, []string{"com"}},
+		{"flag and arguments", "com, net", []string{"COM", "NET.zone", "org"}, []string{"com", "net", "org"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"zones": tt.zones})
+			setArgs(t, tt.args)
+			newDownloadServer(t, []string{"com", "net", "org"}, "", false)
+
+			downloads, missing, err := getDownloadLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linkZones(downloads); !slices.Equal(got, tt.want) {
+				t.Errorf("getDownloadLinks() downloads = %v, want %v", got, tt.want)
+			}
+			if len(missing) != 0 {
+				t.Errorf("getDownloadLinks() missing = %v, want none", missing)
+			}
+		})
+	}
+}
+
+func TestGetDownloadLinksUnicode(t *testing.T) {
+	tests := []struct {
+		name        string
+		zones       string
+		want        []string
+		wantMissing []string
+	}{
+		{"unicode", "рф", []string{"xn--p1ai"}, []string{}},
+		{"uppercase with suffix", "РФ.zone", []string{"xn--p1ai"}, []string{}},
+		{"unicode and punycode", "рф,xn--p1ai,XN--P1AI", []string{"xn--p1ai"}, []string{}},
+		{"mixed with ascii", "бел,com", []string{"xn--90ais", "com"}, []string{}},
+		{"ascii unchanged", "com,net", []string{"com", "net"}, []string{}},
+		{"missing unicode", "café,com", []string{"com"}, []string{"xn--caf-dma"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"zones": tt.zones})
+			newDownloadServer(t, []string{"com", "net", "xn--p1ai", "xn--90ais"}, "", false)
+
+			downloads, missing, err := getDownloadLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linkZones(downloads); !slices.Equal(got, tt.want) {
+				t.Errorf("getDownloadLinks() downloads = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(missing, tt.wantMissing) {
+				t.Errorf("getDownloadLinks() missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestZonesFlagSpellings(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		args  []string
+	}{
+		{"-zones", map[string]string{"zones": "com,net"}, nil},
+		{"-zone alias", map[string]string{"zone": "com,net"}, nil},
+		{"arguments", nil, []string{"com", "net"}},
+		{"both flags", map[string]string{"zones": "com", "zone": "net"}, nil},
+	}
+	want := []string{"com", "net"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+			setArgs(t, tt.args)
+			if got := requestedZones(); !slices.Equal(got, want) {
+				t.Errorf("requestedZones() = %v, want %v", got, want)
+			}
+			newDownloadServer(t, []string{"com", "net", "org"}, "", false)
+			downloads, _, err := getDownloadLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := linkZones(downloads); !slices.Equal(got, want) {
+				t.Errorf("getDownloadLinks() downloads = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestListZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		want  string
+	}{
+		{"all sorted", nil, "com\nnet\norg\nxyz\n"},
+		{"excluded", map[string]string{"exclude": "net,xyz"}, "com\norg\n"},
+		{"selected", map[string]string{"zones": "xyz,com"}, "com\nxyz\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+			newDownloadServer(t, []string{"xyz", "org", "com", "net"}, "", false)
+			downloads, _, err := getDownloadLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := clitest.CaptureStdout(t, func() { printZones(downloads) }); got != tt.want {
+				t.Errorf("printZones() printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalFilename(t *testing.T) {
+	today := time.Now().UTC().Format("2006-01-02")
+	tests := []struct {
+		name      string
+		flags     map[string]string
+		filename  string
+		modified  time.Time
+		want      string
+		wantError bool
+	}{
+		{"server filename", nil, "com.txt.gz", zoneModified, "com.txt.gz", false},
+		{"url filename", map[string]string{"urlname": "true"}, "com.txt.gz", zoneModified, "com.zone", false},
+		{"datestamp", map[string]string{"datestamp": "true"}, "com.txt.gz", zoneModified, "com.2024-06-01.txt.gz", false},
+		{"datestamp without extension", map[string]string{"datestamp": "true"}, "com", zoneModified, "com.2024-06-01", false},
+		{"datestamp without last modified", map[string]string{"datestamp": "true"}, "com.txt.gz", time.Time{}, "com." + today + ".txt.gz", false},
+		{"datestamp of url filename", map[string]string{"datestamp": "true", "urlname": "true"}, "com.txt.gz", zoneModified, "com.2024-06-01.zone", false},
+		{"unsafe", nil, "../com.txt.gz", zoneModified, "", true},
+		{"unsafe with datestamp", map[string]string{"datestamp": "true"}, "../com.txt.gz", zoneModified, "", true},
+		{"empty", nil, "", zoneModified, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.flags)
+			zi := &zoneInfo{Name: "com.zone", Dl: "https://czds.example/czds/downloads/com.zone"}
+			got, err := localFilename(zi, &czds.DownloadInfo{Filename: tt.filename, LastModified: tt.modified})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("localFilename() error = %v, want error: %t", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("localFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatestampDownload(t *testing.T) {
+	dir := t.TempDir()
+	setFlags(t, map[string]string{"out": dir, "datestamp": "true", "quiet": "true"})
+	s := newDownloadServer(t, []string{"com"}, "", false)
+	runDownloads(t, s.links())
+	data, err := os.ReadFile(filepath.Join(dir, "com.2024-06-01.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "com zone" {
+		t.Errorf("saved %q, want %q", data, "com zone")
+	}
+}
+
+func TestMinSize(t *testing.T) {
+	// the zones served are 8 bytes, "com zone"
+	tests := []struct {
+		name     string
+		minSize  string
+		wantGets int
+		want     string
+	}{
+		{"disabled", "0", 1, czds.ZoneDownloaded},
+		{"at the minimum", "8", 1, czds.ZoneDownloaded},
+		{"below the minimum is retried", "9", 3, czds.ZoneFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{
+				"out":         dir,
+				"retries":     "3",
+				"retry-delay": "1ms",
+				"min-size":    tt.minSize,
+				"quiet":       "true",
+			})
+			s := newDownloadServer(t, []string{"com"}, "", false)
+			runDownloads(t, s.links())
+			if len(results.Zones) != 1 {
+				t.Fatalf("got %d results, want 1", len(results.Zones))
+			}
+			result := results.Zones[0]
+			if result.Status != tt.want {
+				t.Errorf("status = %q, want %q, err: %v", result.Status, tt.want, result.Err)
+			}
+			if n := s.gets["com"]; n != tt.wantGets {
+				t.Errorf("downloaded %d times, want %d", n, tt.wantGets)
+			}
+			_, err := os.Stat(filepath.Join(dir, "com.txt"))
+			if saved := err == nil; saved != (tt.want == czds.ZoneDownloaded) {
+				t.Errorf("zone saved: %t, want %t", saved, !saved)
+			}
+		})
+	}
+}
+
+func TestPlanDownloadsSkipsUnchanged(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string    // local copy of the com zone, served as "com zone"
+		modified time.Time // modification time of the local copy
+		force    bool
+		want     bool // the zone needs to be downloaded
+	}{
+		{"unchanged", "com zone", zoneModified, false, false},
+		{"newer local copy", "com zone", zoneModified.Add(time.Hour), false, false},
+		{"size changed", "com zone, old", zoneModified, false, true},
+		{"modification time changed", "com zone", zoneModified.Add(-time.Hour), false, true},
+		{"forced", "com zone", zoneModified, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir, "force": strconv.FormatBool(tt.force)})
+			local := filepath.Join(dir, "com.txt")
+			err := os.WriteFile(local, []byte(tt.data), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Chtimes(local, tt.modified, tt.modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newDownloadServer(t, []string{"com"}, "", false)
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+
+			zis := planDownloads(s.links())
+			if got := len(zis) == 1; got != tt.want {
+				t.Errorf("planDownloads() needs download: %t, want %t", got, tt.want)
+			}
+			if n := s.gets["com"]; n != 0 {
+				t.Errorf("zone downloaded %d times while planning, want only a HEAD", n)
+			}
+			if !tt.want && (len(results.Zones) != 1 || results.Zones[0].Status != czds.ZoneSkipped) {
+				t.Errorf("results = %+v, want com skipped", results.Zones)
+			}
+		})
+	}
+}
+
+func TestPlanDownloadsConcurrent(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel int
+	}{
+		{"serial", 1},
+		{"parallel", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir, "parallel": strconv.Itoa(tt.parallel)})
+			// com is already up to date
+			local := filepath.Join(dir, "com.txt")
+			err := os.WriteFile(local, []byte("com zone"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Chtimes(local, zoneModified, zoneModified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newDownloadServer(t, []string{"com", "net", "org", "info", "biz", "xyz"}, "", false)
+			s.headDelay = 20 * time.Millisecond
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+
+			zis := planDownloads(s.links())
+			got := make([]string, 0, len(zis))
+			for _, zi := range zis {
+				got = append(got, strings.TrimSuffix(zi.Name, ".zone"))
+			}
+			want := []string{"net", "org", "info", "biz", "xyz"}
+			if !slices.Equal(got, want) {
+				t.Errorf("planDownloads() = %v, want %v", got, want)
+			}
+			peak := int(s.headPeak.Load())
+			if peak > tt.parallel {
+				t.Errorf("%d HEADs at once, want at most %d", peak, tt.parallel)
+			}
+			if tt.parallel > 1 && peak < 2 {
+				t.Errorf("%d HEADs at once, want them to run concurrently", peak)
+			}
+			for _, zi := range zis {
+				if zi.Info == nil {
+					t.Errorf("[%s] download info was not kept for the download", zi.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		want      string
+		wantError bool
+	}{
+		{"zone and date", "{{.Zone}}-{{.Date}}.{{.Ext}}", "com-2024-06-01.txt.gz", false},
+		{"filename", "czds-{{.Filename}}", "czds-com.txt.gz", false},
+		{"surrounding space is trimmed", " {{.Zone}}.zone \n", "com.zone", false},
+		{"empty", "{{if false}}{{.Zone}}{{end}}", "", true},
+		{"parent directory", "..", "", true},
+		{"path traversal", "../{{.Zone}}", "", true},
+		{"subdirectory", "{{.Date}}/{{.Filename}}", "", true},
+		{"unknown field", "{{.Missing}}", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("name").Option("missingkey=error").Parse(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nameTemplate = tmpl
+			t.Cleanup(func() { nameTemplate = nil })
+			zi := &zoneInfo{Name: "com.zone", Dl: "https://czds.example/czds/downloads/com.zone"}
+			got, err := localFilename(zi, &czds.DownloadInfo{Filename: "com.txt.gz", LastModified: zoneModified})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("localFilename() error = %v, want error: %t", err, tt.wantError)
+			}
+			if got != tt.want {
+				t.Errorf("localFilename() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// captureLog returns the output of the log package while f runs
+func captureLog(t *testing.T, f func()) string {
+	t.Helper()
+	var b strings.Builder
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stderr)
+	f()
+	return b.String()
+}
+
+func TestWarnSFTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		tlds    []czds.TLDStatus
+		missing []string
+		want    []string // zones in the warning, nil for no warning
+	}{
+		{
+			name:    "no sftp zones",
+			tlds:    []czds.TLDStatus{{TLD: "com", CurrentStatus: czds.StatusApproved}},
+			missing: []string{"com"},
+		},
+		{
+			name: "approved sftp zone missing",
+			tlds: []czds.TLDStatus{
+				{TLD: "com", CurrentStatus: czds.StatusApproved},
+				{TLD: "example", CurrentStatus: czds.StatusApproved, SFTP: true},
+				{TLD: "pending", CurrentStatus: czds.StatusPending, SFTP: true},
+			},
+			missing: []string{"example", "pending"},
+			want:    []string{"example"},
+		},
+		{
+			name:    "sftp zone not missing",
+			tlds:    []czds.TLDStatus{{TLD: "COM", CurrentStatus: czds.StatusApproved, SFTP: true}},
+			missing: []string{"net"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDownloadServer(t, []string{"com"}, "", false)
+			s.tlds = tt.tlds
+			out := captureLog(t, func() { warnSFTP(tt.missing) })
+			if tt.want == nil {
+				if out != "" {
+					t.Errorf("unexpected warning: %s", out)
+				}
+				return
+			}
+			if !strings.Contains(out, fmt.Sprintf("%d approved zones are delivered over SFTP", len(tt.want))) {
+				t.Errorf("warning = %q, want %d SFTP zones", out, len(tt.want))
+			}
+			if !strings.Contains(out, fmt.Sprint(tt.want)) {
+				t.Errorf("warning = %q, want the zones %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDownloadLinksNoTLDStatus(t *testing.T) {
+	s := newDownloadServer(t, []string{"com", "net"}, "", false)
+	s.tlds = []czds.TLDStatus{{TLD: "example", CurrentStatus: czds.StatusApproved, SFTP: true}}
+	setArgs(t, nil)
+	_, _, err := getDownloadLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the TLD status is only needed to explain missing zones
+	if n := s.tldRequests.Load(); n != 0 {
+		t.Errorf("requested the TLD status %d times, want 0", n)
+	}
+}
+
+func TestOrderDownloads(t *testing.T) {
+	links := []string{"net", "com", "xyz", "org", "biz", "info", "app", "dev"}
+	sorted := slices.Clone(links)
+	slices.Sort(sorted)
+	tests := []struct {
+		name      string
+		noShuffle bool
+		want      []string // nil if the order is random
+	}{
+		{"no shuffle", true, sorted},
+		{"shuffle", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"no-shuffle": strconv.FormatBool(tt.noShuffle)})
+			got := orderDownloads(slices.Clone(links), 1)
+			if tt.want != nil && !slices.Equal(got, tt.want) {
+				t.Errorf("orderDownloads() = %v, want %v", got, tt.want)
+			}
+			if tt.want == nil {
+				// shuffled with a fixed seed, the zones are all there but not sorted
+				if slices.Equal(got, sorted) {
+					t.Errorf("orderDownloads() = %v, want a shuffled order", got)
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, sorted) {
+					t.Errorf("orderDownloads() has zones %v, want %v", got, sorted)
+				}
+			}
+		})
+	}
+}
+
+func TestShuffleSeed(t *testing.T) {
+	links := []string{"net", "com", "xyz", "org", "biz", "info", "app", "dev"}
+	reversed := slices.Clone(links)
+	slices.Reverse(reversed)
+	tests := []struct {
+		name  string
+		a, b  []string // links to order with seed a and seed b
+		seeds [2]int64
+		same  bool
+	}{
+		{"same seed", links, links, [2]int64{42, 42}, true},
+		{"same seed with links in another order", links, reversed, [2]int64{42, 42}, true},
+		{"different seeds", links, links, [2]int64{42, 43}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, map[string]string{"no-shuffle": "false"})
+			a := orderDownloads(slices.Clone(tt.a), tt.seeds[0])
+			b := orderDownloads(slices.Clone(tt.b), tt.seeds[1])
+			if slices.Equal(a, b) != tt.same {
+				t.Errorf("orders %v and %v, want same: %t", a, b, tt.same)
+			}
+		})
+	}
+}
+
+func TestZonesFile(t *testing.T) {
+	content := "# curated zones\ncom\n\nNET.zone  # trailing comment\r\n  org\ncom\n#net\n"
+	tests := []struct {
+		name  string
+		stdin bool
+		zones string // -zones
+		want  []string
+	}{
+		{"file", false, "", []string{"com", "net", "org"}},
+		{"stdin", true, "", []string{"com", "net", "org"}},
+		{"merged with -zones", false, "xyz,org", []string{"xyz", "org", "com", "net"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "zones.txt")
+			err := os.WriteFile(path, []byte(content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stdin {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+				path = "-"
+			}
+			fileZones, err = cli.ReadZonesFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { fileZones = nil })
+			setFlags(t, map[string]string{"zones": tt.zones})
+			setArgs(t, nil)
+			if got := requestedZones(); !slices.Equal(got, tt.want) {
+				t.Errorf("requestedZones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoneTimeout(t *testing.T) {
+	dir := t.TempDir()
+	setFlags(t, map[string]string{
+		"out":          dir,
+		"parallel":     "3",
+		"retries":      "2",
+		"retry-delay":  "1ms",
+		"zone-timeout": "100ms",
+		"quiet":        "true",
+	})
+	s := newDownloadServer(t, []string{"com", "net", "slow"}, "", false)
+	s.slow = "slow"
+	start := time.Now()
+	runDownloads(t, s.links())
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("downloads took %s, want the slow zone to time out", elapsed)
+	}
+
+	got := make(map[string]czds.ZoneResult)
+	for _, result := range results.Zones {
+		got[result.Zone] = result
+	}
+	for _, zone := range []string{"com", "net"} {
+		if got[zone].Status != czds.ZoneDownloaded {
+			t.Errorf("[%s] status = %q, want %q, err: %v", zone, got[zone].Status, czds.ZoneDownloaded, got[zone].Err)
+		}
+	}
+	if got["slow"].Status != czds.ZoneFailed || !errors.Is(got["slow"].Err, context.DeadlineExceeded) {
+		t.Errorf("[slow] status = %q, err: %v, want it to time out", got["slow"].Status, got["slow"].Err)
+	}
+	if n := s.gets["slow"]; n != 2 {
+		t.Errorf("slow zone downloaded %d times, want 2", n)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"com.txt", "net.txt"}; !slices.Equal(names, want) {
+		t.Errorf("output directory has %v, want %v without partial or temporary files", names, want)
+	}
+}
+
+func TestDownloadMissingHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		bare        bool
+		undated     bool
+		wantPlanned []int // downloads planned by each run
+	}{
+		// without a size or modification date the local copies can not be trusted, so they are always downloaded
+		{"no size or date", true, false, []int{2, 2}},
+		// without a modification date the local copies are kept when their size matches
+		{"no date", false, true, []int{2, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir, "retries": "1", "quiet": "true"})
+			s := newDownloadServer(t, []string{"com", "net"}, "", false)
+			s.bare = tt.bare
+			s.undated = tt.undated
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+			for run, want := range tt.wantPlanned {
+				stopCtx, stopRun = context.WithCancelCause(runCtx)
+				results = czds.DownloadResult{}
+				zis := planDownloads(s.links())
+				if len(zis) != want {
+					t.Fatalf("run %d: planned %d downloads, want %d", run+1, len(zis), want)
+				}
+				for _, zi := range zis {
+					if tt.bare && zi.Bytes != -1 {
+						t.Errorf("run %d: [%s] size = %d, want unknown", run+1, zi.Name, zi.Bytes)
+					}
+				}
+				downloadZones(zis)
+				for _, result := range results.Zones {
+					if want > 0 && result.Status != czds.ZoneDownloaded {
+						t.Errorf("run %d: [%s] status = %q, want %q, err: %v", run+1, result.Zone, result.Status, czds.ZoneDownloaded, result.Err)
+					}
+				}
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "com.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "com zone" {
+				t.Errorf("saved %q, want %q", data, "com zone")
+			}
+		})
+	}
+}
+
+func TestKeepPartial(t *testing.T) {
+	tests := []struct {
+		name string
+		keep bool
+	}{
+		{"removed", false},
+		{"kept", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{
+				"out":          dir,
+				"retries":      "1",
+				"zone-timeout": "100ms",
+				"keep-partial": strconv.FormatBool(tt.keep),
+				"quiet":        "true",
+			})
+			s := newDownloadServer(t, []string{"slow"}, "", false)
+			s.slow = "slow"
+			out := captureLog(t, func() { runDownloads(t, s.links()) })
+			if len(results.Zones) != 1 || results.Zones[0].Status != czds.ZoneFailed {
+				t.Fatalf("results = %+v, want the zone to fail", results.Zones)
+			}
+
+			partials, err := filepath.Glob(filepath.Join(dir, "slow.txt.*.tmp"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.keep {
+				if len(partials) != 0 {
+					t.Errorf("partial downloads %v were not removed", partials)
+				}
+				return
+			}
+			if len(partials) != 1 {
+				t.Fatalf("got partial downloads %v, want 1", partials)
+			}
+			data, err := os.ReadFile(partials[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != "slow" {
+				t.Errorf("partial download = %q, want the first half of the zone", data)
+			}
+			if !strings.Contains(out, "keeping partial download") || !strings.Contains(out, partials[0]) {
+				t.Errorf("no warning about the partial download %q in %q", partials[0], out)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "slow.txt")); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("partial download was renamed into place: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyGzip(t *testing.T) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write([]byte(strings.Repeat("com. 3600 IN NS a.gtld-servers.net.\n", 100)))
+	gz.Close()
+	valid := b.Bytes()
+	truncated := valid[:len(valid)-10]
+
+	tests := []struct {
+		name     string
+		data     []byte
+		verify   bool
+		want     string
+		wantGets int
+	}{
+		{"valid", valid, true, czds.ZoneDownloaded, 1},
+		{"truncated", truncated, true, czds.ZoneFailed, 2},
+		{"truncated without -verify-gzip", truncated, false, czds.ZoneDownloaded, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{
+				"out":         dir,
+				"retries":     "2",
+				"retry-delay": "1ms",
+				"verify-gzip": strconv.FormatBool(tt.verify),
+				"quiet":       "true",
+			})
+			s := newDownloadServer(t, []string{"com"}, "", false)
+			s.gz = map[string][]byte{"com": tt.data}
+			runDownloads(t, s.links())
+			if len(results.Zones) != 1 || results.Zones[0].Status != tt.want {
+				t.Fatalf("results = %+v, want com %s", results.Zones, tt.want)
+			}
+			if n := s.gets["com"]; n != tt.wantGets {
+				t.Errorf("downloaded %d times, want %d", n, tt.wantGets)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := len(entries) == 1 && entries[0].Name() == "com.txt.gz"
+			if want := tt.want == czds.ZoneDownloaded; saved != want || (!want && len(entries) != 0) {
+				t.Errorf("output directory has %d files, want the zone saved: %t", len(entries), want)
+			}
+		})
+	}
+}
+
+// TestMain runs main with the arguments in CZDS_TEST_MAIN_ARGS when it is set, so that fatal errors can be tested
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("CZDS_TEST_MAIN_ARGS"); ok {
+		os.Args = append([]string{"czds-dl"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestOutDirNotWritable(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     func(t *testing.T) string // returns the -out directory
+		wantErr bool
+	}{
+		{"writable", func(t *testing.T) string { return t.TempDir() }, false},
+		{"created", func(t *testing.T) string { return filepath.Join(t.TempDir(), "zones") }, false},
+		{"read-only", func(t *testing.T) string {
+			if os.Geteuid() == 0 {
+				t.Skip("root can write to read-only directories")
+			}
+			dir := t.TempDir()
+			err := os.Chmod(dir, 0555)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { os.Chmod(dir, 0755) })
+			return dir
+		}, true},
+		{"not a directory", func(t *testing.T) string {
+			file := filepath.Join(t.TempDir(), "zones")
+			err := os.WriteFile(file, nil, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return file
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := tt.out(t)
+			s := newDownloadServer(t, []string{"com", "net", "org"}, "", false)
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), "CZDS_TEST_MAIN_ARGS=-username user -password pass -quiet -parallel 3"+
+				" -authurl "+s.URL+"/api/authenticate -baseurl "+s.URL+" -out "+out)
+			output, err := cmd.CombinedOutput()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("czds-dl error = %v, want error: %t, output:\n%s", err, tt.wantErr, output)
+			}
+			if !tt.wantErr {
+				if len(s.gets) != 3 {
+					t.Errorf("downloaded %v, want all 3 zones", s.gets)
+				}
+				entries, err := os.ReadDir(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(entries) != 3 {
+					t.Errorf("%d files in -out, want the 3 zones and no probe file", len(entries))
+				}
+				return
+			}
+			if n := strings.Count(string(output), "is not writable"); n != 1 {
+				t.Errorf("output has %d not writable errors, want 1:\n%s", n, output)
+			}
+			if len(s.gets) != 0 {
+				t.Errorf("zones were downloaded: %v", s.gets)
+			}
+		})
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	tests := []struct {
+		name      string
+		local     bool   // com is already downloaded and unchanged
+		bare      bool   // sizes are unknown
+		available uint64 // free space reported for -out, the zones are 8 bytes each
+		spaceErr  bool   // the free space can not be checked
+		wantErr   bool
+	}{
+		{"enough", false, false, 100, false, false},
+		{"exactly enough", false, false, 16, false, false},
+		{"not enough", false, false, 15, false, true},
+		{"unchanged zones are not counted", true, false, 8, false, false},
+		{"unknown sizes are not counted", false, true, 0, false, false},
+		{"unable to check", false, false, 0, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir})
+			if tt.local {
+				local := filepath.Join(dir, "com.txt")
+				err := os.WriteFile(local, []byte("com zone"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.Chtimes(local, zoneModified, zoneModified)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			var checked string
+			spaceAvailable = func(dir string) (uint64, error) {
+				checked = dir
+				if tt.spaceErr {
+					return 0, errors.New("statfs: not supported")
+				}
+				return tt.available, nil
+			}
+			t.Cleanup(func() { spaceAvailable = availableSpace })
+			s := newDownloadServer(t, []string{"com", "net"}, "", false)
+			s.bare = tt.bare
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+
+			var err error
+			captureLog(t, func() { err = checkDiskSpace(planDownloads(s.links())) })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkDiskSpace() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "16 B needed for 2 zones") {
+				t.Errorf("checkDiskSpace() error = %q, want the space needed", err)
+			}
+			if checked != dir {
+				t.Errorf("checked the space of %q, want %q", checked, dir)
+			}
+			if len(s.gets) != 0 {
+				t.Errorf("zones were downloaded: %v", s.gets)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	zones := []string{"aa", "bb", "cc", "dd", "ee", "ff", "gg", "hh"} // 7 bytes each
+	tests := []struct {
+		name      string
+		maxBytes  int
+		wantZones int // zones saved
+		wantErr   bool
+	}{
+		{"no limit", 0, 8, false},
+		{"under the limit", 56, 8, false},
+		{"stops early", 20, 2, true},
+		{"first zone", 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			s := newDownloadServer(t, zones, "", false)
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), "CZDS_TEST_MAIN_ARGS=-username user -password pass -quiet -no-shuffle -parallel 1 -retries 3"+
+				" -max-bytes "+strconv.Itoa(tt.maxBytes)+" -authurl "+s.URL+"/api/authenticate -baseurl "+s.URL+" -out "+out)
+			output, err := cmd.CombinedOutput()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("czds-dl error = %v, want error: %t, output:\n%s", err, tt.wantErr, output)
+			}
+			entries, err := os.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.wantZones {
+				names := make([]string, 0, len(entries))
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("saved %v, want %d zones and no partial files", names, tt.wantZones)
+			}
+			gets := 0
+			for _, n := range s.gets {
+				gets += n
+			}
+			if tt.wantErr {
+				// the zone that went over the limit is not retried and the rest are not started
+				if gets != tt.wantZones+1 {
+					t.Errorf("downloaded %v, want %d GETs", s.gets, tt.wantZones+1)
+				}
+				if n := strings.Count(string(output), "downloaded more than -max-bytes"); n != 1 {
+					t.Errorf("output has %d -max-bytes messages, want 1:\n%s", n, output)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectBySize(t *testing.T) {
+	// each zone is served as "<zone> zone", so longer names are larger zones
+	zones := []string{"ccc", "a", "eeeee", "bb", "dddd"}
+	tests := []struct {
+		name      string
+		flags     map[string]string
+		unchanged string // zone already downloaded and unchanged
+		want      []string
+	}{
+		{"smallest", map[string]string{"smallest": "2"}, "", []string{"a", "bb"}},
+		{"largest", map[string]string{"largest": "2"}, "", []string{"eeeee", "dddd"}},
+		{"more than available", map[string]string{"smallest": "10"}, "", []string{"a", "bb", "ccc", "dddd", "eeeee"}},
+		{"unchanged zones count toward the selection", map[string]string{"largest": "2"}, "eeeee", []string{"dddd"}},
+		{"no selection", nil, "", zones},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			flags := map[string]string{"out": dir}
+			for name, value := range tt.flags {
+				flags[name] = value
+			}
+			setFlags(t, flags)
+			if len(tt.unchanged) > 0 {
+				local := filepath.Join(dir, tt.unchanged+".txt")
+				err := os.WriteFile(local, []byte(tt.unchanged+" zone"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.Chtimes(local, zoneModified, zoneModified)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := newDownloadServer(t, zones, "", false)
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+
+			var got []string
+			for _, zi := range planDownloads(s.links()) {
+				got = append(got, strings.TrimSuffix(zi.Name, ".zone"))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("planDownloads() = %v, want %v", got, tt.want)
+			}
+			if len(s.gets) != 0 {
+				t.Errorf("zones were downloaded while planning: %v", s.gets)
+			}
+		})
+	}
+}
+
+func TestFsync(t *testing.T) {
+	tests := []struct {
+		name      string
+		fsync     bool
+		archive   bool
+		syncErr   bool
+		wantSyncs int // of the archive
+	}{
+		{"off", false, false, false, 0},
+		{"zones", true, false, false, 0},
+		{"archive", true, true, false, 1},
+		{"archive off", false, true, false, 0},
+		{"archive sync fails", true, true, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "zones.tar.gz")
+			flags := map[string]string{"out": dir, "fsync": strconv.FormatBool(tt.fsync), "parallel": "1", "retries": "1", "quiet": "true"}
+			if tt.archive {
+				flags["archive"] = archivePath
+			}
+			setFlags(t, flags)
+			var syncs []string
+			syncFile = func(f *os.File) error {
+				// the archive is synced while it still has its temporary name
+				if !strings.HasSuffix(f.Name(), ".tmp") {
+					t.Errorf("synced %q, want a temporary file", f.Name())
+				}
+				syncs = append(syncs, f.Name())
+				if tt.syncErr {
+					return errors.New("sync: input/output error")
+				}
+				return f.Sync()
+			}
+			t.Cleanup(func() { syncFile = (*os.File).Sync })
+			if tt.archive {
+				var err error
+				arc, err = newZoneArchive(archivePath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { arc = nil })
+			}
+			// the zones are synced by the library, except with -archive where they are only scratch files
+			if got, want := bulkOptions().Fsync, tt.fsync && !tt.archive; got != want {
+				t.Errorf("zones synced: %t, want %t", got, want)
+			}
+			s := newDownloadServer(t, []string{"com", "net"}, "", false)
+			captureLog(t, func() { runDownloads(t, s.links()) })
+			if n := results.Count(czds.ZoneDownloaded); n != 2 {
+				t.Errorf("%d zones downloaded, want 2: %+v", n, results.Zones)
+			}
+			if tt.archive {
+				err := arc.Close()
+				if (err != nil) != tt.syncErr {
+					t.Errorf("arc.Close() error = %v, want error: %t", err, tt.syncErr)
+				}
+				if _, err := os.Stat(archivePath); tt.syncErr != errors.Is(err, os.ErrNotExist) {
+					t.Errorf("archive saved: %t, want %t", err == nil, !tt.syncErr)
+				}
+			}
+			if len(syncs) != tt.wantSyncs {
+				t.Errorf("synced %v, want %d files", syncs, tt.wantSyncs)
+			}
+		})
+	}
+}
+
+func TestOnlyChanged(t *testing.T) {
+	// how the manifest entry of a zone differs from the zone served
+	const (
+		same     = "same"
+		modified = "modified" // the remote zone was modified since the manifest
+		resized  = "resized"  // the remote zone changed size since the manifest
+		checked  = "checked"  // the zone was checked two days ago
+		moved    = "moved"    // the zone was checked at another URL
+		deleted  = "deleted"  // the entry is the same but the local file was removed
+	)
+	tests := []struct {
+		name      string
+		prior     map[string]string // state of the manifest entry of each zone, nil for no manifest
+		maxAge    time.Duration
+		force     bool
+		wantHeads []string
+		wantGets  []string
+	}{
+		{"compared", map[string]string{"com": same, "net": modified, "org": resized}, 0, false, []string{"com", "net", "org"}, []string{"net", "org"}},
+		{"new zone", map[string]string{"com": same, "org": same}, 0, false, []string{"com", "net", "org"}, []string{"net"}},
+		{"no manifest", nil, 0, false, []string{"com", "net", "org"}, []string{"com", "net", "org"}},
+		{"checked recently", map[string]string{"com": same, "net": checked, "org": moved}, time.Hour, false, []string{"net", "org"}, []string{}},
+		{"modified but checked recently", map[string]string{"com": modified, "net": same, "org": same}, time.Hour, false, []string{}, []string{}},
+		{"forced", map[string]string{"com": same, "net": same, "org": same}, time.Hour, true, []string{"com", "net", "org"}, []string{"com", "net", "org"}},
+		{"local file deleted", map[string]string{"com": same, "net": deleted, "org": same}, 0, false, []string{"com", "net", "org"}, []string{"net"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir, "force": strconv.FormatBool(tt.force), "manifest-max-age": tt.maxAge.String(), "quiet": "true"})
+			s := newDownloadServer(t, []string{"com", "net", "org"}, "", false)
+			start := time.Now().UTC()
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			if tt.prior != nil {
+				m := &manifest{path: path, Zones: make(map[string]manifestEntry)}
+				for zone, state := range tt.prior {
+					entry := manifestEntry{
+						URL:          s.URL + "/czds/downloads/" + zone + ".zone",
+						Filename:     zone + ".txt",
+						Size:         int64(len(zone + " zone")),
+						LastModified: zoneModified,
+						Checked:      start.Add(-time.Minute),
+					}
+					switch state {
+					case modified:
+						entry.LastModified = zoneModified.Add(-24 * time.Hour)
+					case resized:
+						entry.Size++
+					case checked:
+						entry.Checked = start.Add(-48 * time.Hour)
+					case moved:
+						entry.URL = "https://czds.example/czds/downloads/" + zone + ".zone"
+					}
+					m.Zones[zone+".zone"] = entry
+					if state == deleted {
+						continue
+					}
+					// the local copy is older than the remote zone, so only the manifest keeps it from being downloaded
+					local := filepath.Join(dir, zone+".txt")
+					err := os.WriteFile(local, []byte(zone+" zone"), 0600)
+					if err != nil {
+						t.Fatal(err)
+					}
+					err = os.Chtimes(local, zoneModified.Add(-48*time.Hour), zoneModified.Add(-48*time.Hour))
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				err := m.save()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var err error
+			prior, err = loadManifest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { prior = nil })
+			stopCtx, stopRun = context.WithCancelCause(runCtx)
+			results = czds.DownloadResult{}
+			t.Cleanup(func() { results = czds.DownloadResult{} })
+			downloadZones(planDownloads(s.links()))
+			err = prior.save()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, counts := range map[string]map[string]int{"checked": s.heads, "downloaded": s.gets} {
+				want := tt.wantHeads
+				if name == "downloaded" {
+					want = tt.wantGets
+				}
+				got := make([]string, 0, len(counts))
+				for zone := range counts {
+					got = append(got, zone)
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, want) {
+					t.Errorf("%s %v, want %v", name, got, want)
+				}
+			}
+			if failed := results.Count(czds.ZoneFailed); failed != 0 {
+				t.Errorf("%d zones failed", failed)
+			}
+
+			// every zone checked is saved with its remote state, the others keep their previous entry
+			saved, err := loadManifest(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, zone := range []string{"com", "net", "org"} {
+				entry, ok := saved.Zones[zone+".zone"]
+				if !ok {
+					t.Errorf("%s missing from the saved manifest", zone)
+					continue
+				}
+				if !slices.Contains(tt.wantHeads, zone) {
+					if !entry.Checked.Before(start) {
+						t.Errorf("%s entry changed without the zone being checked: %+v", zone, entry)
+					}
+					continue
+				}
+				if entry.Size != int64(len(zone+" zone")) || !entry.LastModified.Equal(zoneModified) || entry.Checked.Before(start) {
+					t.Errorf("%s saved as %+v, want the remote state checked after %s", zone, entry, start)
+				}
+				if want := s.URL + "/czds/downloads/" + zone + ".zone"; entry.URL != want {
+					t.Errorf("%s saved with URL %q, want %q", zone, entry.URL, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// manifestEntry is the remote state of a zone recorded by a previous run
+type manifestEntry struct {
+	URL          string    `json:"url"`
+	Filename     string    `json:"filename"`
+	Size         int64     `json:"size"` // -1 if unknown
+	LastModified time.Time `json:"lastModified"`
+	Checked      time.Time `json:"checked"` // when the remote zone was last checked
+}
+
+// manifest records the remote state of each zone for -only-changed, keyed by the zone's link name such as "com.zone"
+type manifest struct {
+	mutex sync.Mutex
+	path  string
+	Zones map[string]manifestEntry `json:"zones"`
+}
+
+// loadManifest reads the manifest at path, a missing file is an empty manifest
+func loadManifest(path string) (*manifest, error) {
+	m := &manifest{
+		path:  path,
+		Zones: make(map[string]manifestEntry),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		v("manifest %q does not exist, checking all zones", path)
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest %q: %w", path, err)
+	}
+	if m.Zones == nil {
+		m.Zones = make(map[string]manifestEntry)
+	}
+	v("loaded %d zones from manifest %q", len(m.Zones), path)
+	return m, nil
+}
+
+// fresh returns true if the zone was checked within -manifest-max-age, so it can be skipped without checking it again
+func (m *manifest) fresh(zi *zoneInfo) bool {
+	if *manifestAge <= 0 {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.Zones[zi.Name]
+	return ok && entry.URL == zi.Dl && time.Since(entry.Checked) < *manifestAge
+}
+
+// unchanged returns true if the remote size and modification date of the zone match the manifest
+func (m *manifest) unchanged(zi *zoneInfo) bool {
+	if zi.Info == nil || zi.Info.LastModified.IsZero() {
+		return false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	entry, ok := m.Zones[zi.Name]
+	return ok && entry.Size == zi.Info.ContentLength && entry.LastModified.Equal(zi.Info.LastModified)
+}
+
+// record saves the remote state of a zone that was downloaded or checked
+// zones that failed, or were skipped without being checked, keep their previous entry
+func (m *manifest) record(zi *zoneInfo, err error) {
+	if err != nil || zi.Info == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Zones[zi.Name] = manifestEntry{
+		URL:          zi.Dl,
+		Filename:     zi.FileName,
+		Size:         zi.Info.ContentLength,
+		LastModified: zi.Info.LastModified,
+		Checked:      time.Now().UTC(),
+	}
+}
+
+// save writes the manifest to a temporary file and renames it into place
+func (m *manifest) save() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	_, err = file.Write(append(data, '\n'))
+	if err == nil && *fsync {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, m.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("unable to save manifest %q: %w", m.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often the interactive progress bars are redrawn
+const progressRefresh = 250 * time.Millisecond
+
+// progress tracks the active downloads and renders their progress.
+// When out is a terminal a single updating line is drawn for each active download,
+// otherwise a new line is printed for every 10% of a download completed.
+// In json mode each line is a progressEvent instead.
+type progress struct {
+	mutex  sync.Mutex
+	out    io.Writer
+	tty    bool
+	json   bool
+	active []*progressWriter
+	drawn  int // number of lines drawn by the last render
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// progressWriter is an io.Writer that counts the bytes of a single download
+type progressWriter struct {
+	p       *progress
+	name    string
+	total   int64
+	written int64
+	lastPct int64
+	start   time.Time
+}
+
+// progressEvent is written for each progress update in json mode
+type progressEvent struct {
+	Event   string `json:"event"`
+	Zone    string `json:"zone"`
+	Written int64  `json:"written"`
+	Total   int64  `json:"total"`
+	Pct     int64  `json:"pct"`
+}
+
+// newProgress creates a new progress renderer writing to out
+// json mode writes newline delimited progressEvents instead of human readable lines
+func newProgress(out *os.File, json bool) *progress {
+	p := &progress{
+		out:  out,
+		tty:  !json && isTerminal(out),
+		json: json,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if p.tty {
+		go p.renderLoop()
+	} else {
+		close(p.done)
+	}
+	return p
+}
+
+// isTerminal returns true if f is a character device such as a TTY
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// add starts tracking a new download of total bytes
+func (p *progress) add(name string, total int64) *progressWriter {
+	pw := &progressWriter{
+		p:     p,
+		name:  name,
+		total: total,
+		start: time.Now(),
+	}
+	p.mutex.Lock()
+	p.active = append(p.active, pw)
+	p.mutex.Unlock()
+	return pw
+}
+
+// remove stops tracking the download
+func (p *progress) remove(pw *progressWriter) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := range p.active {
+		if p.active[i] == pw {
+			p.active = append(p.active[:i], p.active[i+1:]...)
+			break
+		}
+	}
+}
+
+// Printf prints a message without corrupting the progress bars
+func (p *progress) Printf(format string, a ...interface{}) {
+	if p.json {
+		// messages are not part of the event stream
+		fmt.Printf(format, a...)
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, format, a...)
+	p.draw()
+}
+
+// Close stops rendering and removes any progress bars from the terminal
+func (p *progress) Close() {
+	if p.tty {
+		close(p.stop)
+	}
+	<-p.done
+}
+
+func (p *progress) renderLoop() {
+	ticker := time.NewTicker(progressRefresh)
+	defer ticker.Stop()
+	defer close(p.done)
+	for {
+		select {
+		case <-p.stop:
+			p.mutex.Lock()
+			p.clear()
+			p.mutex.Unlock()
+			return
+		case <-ticker.C:
+			p.mutex.Lock()
+			p.clear()
+			p.draw()
+			p.mutex.Unlock()
+		}
+	}
+}
+
+// clear erases the lines drawn by the last call to draw, must hold mutex
+func (p *progress) clear() {
+	if !p.tty {
+		return
+	}
+	// move the cursor up and erase each line
+	fmt.Fprint(p.out, strings.Repeat("\033[1A\033[2K", p.drawn))
+	p.drawn = 0
+}
+
+// draw renders a line for each active download, must hold mutex
+func (p *progress) draw() {
+	if !p.tty {
+		return
+	}
+	for _, pw := range p.active {
+		fmt.Fprintln(p.out, pw.String())
+	}
+	p.drawn = len(p.active)
+}
+
+// Write counts the bytes written
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	pw.p.mutex.Lock()
+	defer pw.p.mutex.Unlock()
+	pw.written += int64(len(b))
+	if !pw.p.tty && pw.total > 0 {
+		pct := pw.written * 100 / pw.total
+		if pct/10 > pw.lastPct/10 {
+			pw.lastPct = pct
+			if pw.p.json {
+				pw.writeEvent(pct)
+			} else {
+				fmt.Fprintln(pw.p.out, pw.String())
+			}
+		}
+	}
+	return len(b), nil
+}
+
+// writeEvent writes the progress of the download as a progressEvent, must hold mutex
+func (pw *progressWriter) writeEvent(pct int64) {
+	event := progressEvent{
+		Event:   "progress",
+		Zone:    strings.TrimSuffix(pw.name, ".zone"),
+		Written: pw.written,
+		Total:   pw.total,
+		Pct:     pct,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(pw.p.out, string(data))
+}
+
+// String returns the progress line for the download, must hold mutex
+func (pw *progressWriter) String() string {
+	elapsed := time.Since(pw.start)
+	rate := float64(0)
+	if elapsed > 0 {
+		rate = float64(pw.written) / elapsed.Seconds()
+	}
+	if pw.total <= 0 {
+		return fmt.Sprintf("%s %s %s/s", pw.name, formatBytes(pw.written), formatBytes(int64(rate)))
+	}
+	pct := pw.written * 100 / pw.total
+	eta := "?"
+	if rate > 0 {
+		eta = time.Duration(float64(pw.total-pw.written) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s %3d%% %s/%s %s/s ETA %s", pw.name, pct,
+		formatBytes(pw.written), formatBytes(pw.total), formatBytes(int64(rate)), eta)
+}
+
+// formatBytes returns a human readable representation of n bytes
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
+
+// formatCount returns n with comma thousands separators
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	start := len(s) % 3
+	if start == 0 {
+		start = 3
+	}
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := start; i < len(s); i += 3 {
+		b.WriteByte(',')
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
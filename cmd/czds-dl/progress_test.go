@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+// writeProgress writes total bytes to a new progress writer in chunks of size and returns the lines written to out
+func writeProgress(t *testing.T, jsonMode bool, total, size int64) []string {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "progress"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	p := newProgress(out, jsonMode)
+	if p.tty {
+		t.Fatal("a regular file was detected as a terminal")
+	}
+	pw := p.add("com.zone", total)
+	for written := int64(0); written < total; written += size {
+		_, err = pw.Write(make([]byte, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.remove(pw)
+	p.Close()
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestProgressFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int64
+		size     int64
+		wantPcts []int
+	}{
+		{"every 10%", 100, 5, []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}},
+		{"large writes print the actual percent", 100, 25, []int{25, 50, 75, 100}},
+		{"single write", 100, 100, []int{100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := writeProgress(t, false, tt.total, tt.size)
+			if len(lines) != len(tt.wantPcts) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(tt.wantPcts), strings.Join(lines, "\n"))
+			}
+			for i, line := range lines {
+				want := fmt.Sprintf("com.zone %3d%% ", tt.wantPcts[i])
+				if !strings.HasPrefix(line, want) {
+					t.Errorf("line %d = %q, want prefix %q", i, line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProgressJSON(t *testing.T) {
+	lines := writeProgress(t, true, 100, 50)
+	want := []progressEvent{
+		{Event: "progress", Zone: "com", Written: 50, Total: 100, Pct: 50},
+		{Event: "progress", Zone: "com", Written: 100, Total: 100, Pct: 100},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d events, want %d:\n%s", len(lines), len(want), strings.Join(lines, "\n"))
+	}
+	for i, line := range lines {
+		var event progressEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("line %d %q: %v", i, line, err)
+		}
+		if event != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1000, "1.0 kB"},
+		{1500000, "1.5 MB"},
+		{45600000000, "45.6 GB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestProgressJSONDownload(t *testing.T) {
+	setFlags(t, map[string]string{"out": t.TempDir(), "parallel": "2", "retries": "1", "quiet": "true"})
+	s := newDownloadServer(t, []string{"com", "net", "bad"}, "bad", false)
+	stopCtx, stopRun = context.WithCancelCause(runCtx)
+	results = czds.DownloadResult{}
+	t.Cleanup(func() { results = czds.DownloadResult{} })
+
+	out := clitest.CaptureStderr(t, func() {
+		prog = newProgress(os.Stderr, true)
+		defer func() { prog = nil }()
+		downloadZones(planDownloads(s.links()))
+		prog.Close()
+		writeSummaryEvent(&results)
+	})
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	final := make(map[string]progressEvent)
+	for i, line := range lines[:len(lines)-1] {
+		var event progressEvent
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			t.Fatalf("line %d %q: %v", i, line, err)
+		}
+		if event.Event != "progress" {
+			t.Errorf("line %d event = %q, want progress", i, event.Event)
+		}
+		final[event.Zone] = event
+	}
+	for _, zone := range []string{"com", "net"} {
+		size := int64(len(zone + " zone"))
+		want := progressEvent{Event: "progress", Zone: zone, Written: size, Total: size, Pct: 100}
+		if final[zone] != want {
+			t.Errorf("[%s] last event = %+v, want %+v", zone, final[zone], want)
+		}
+	}
+
+	var summary summaryEvent
+	err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary)
+	if err != nil {
+		t.Fatalf("summary %q: %v", lines[len(lines)-1], err)
+	}
+	summary.DurationMs = 0
+	want := summaryEvent{Event: "summary", Downloaded: 2, Failed: 1, Bytes: int64(len("com zone") + len("net zone"))}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+}
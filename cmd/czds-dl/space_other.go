@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+// availableSpace is not supported on this platform
+func availableSpace(dir string) (uint64, error) {
+	return 0, errors.New("checking available disk space is not supported on this platform")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+// verifyZones compares the local copy of each zone in links with the remote size and modification date
+// without downloading, prints a line for every zone with a local copy and returns the number of mismatches
+func verifyZones(links []string) int {
+	lines := make([]string, 0, len(links))
+	mismatches := 0
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, *parallel)
+	for _, dl := range links {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(dl string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			line, ok := verifyZone(dl)
+			if len(line) == 0 {
+				return
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			lines = append(lines, line)
+			if !ok {
+				mismatches++
+			}
+		}(dl)
+	}
+	wg.Wait()
+
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return mismatches
+}
+
+// verifyZone returns the verification result line for the zone at dl and true if the local copy matches
+// an empty line is returned for zones without a local copy
+func verifyZone(dl string) (string, bool) {
+	zi := &zoneInfo{
+		Name: path.Base(dl),
+		Dl:   dl,
+	}
+	ctx, cancel := zoneContext()
+	defer cancel()
+	info, err := client.GetDownloadInfoWithContext(ctx, dl)
+	if err != nil {
+		return fmt.Sprintf("%s\terror: %s", zi.Name, err), false
+	}
+	name, err := localFilename(zi, info)
+	if err != nil {
+		return fmt.Sprintf("%s\terror: %s", zi.Name, err), false
+	}
+	fullPath := path.Join(*outDir, name)
+	local, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		v("[%s] no local copy at %q", zi.Name, fullPath)
+		return "", true
+	}
+	if err != nil {
+		return fmt.Sprintf("%s\terror: %s", zi.Name, err), false
+	}
+	if info.ContentLength >= 0 && local.Size() != info.ContentLength {
+		return fmt.Sprintf("%s\tsize mismatch: local %d, remote %d", name, local.Size(), info.ContentLength), false
+	}
+	if info.ContentLength < 0 && info.LastModified.IsZero() {
+		return fmt.Sprintf("%s\tunknown: remote size and modification date not provided", name), false
+	}
+	if local.ModTime().Before(info.LastModified) {
+		return fmt.Sprintf("%s\tremote is newer: local %s, remote %s", name, local.ModTime().UTC(), info.LastModified.UTC()), false
+	}
+	return fmt.Sprintf("%s\tok", name), true
+}
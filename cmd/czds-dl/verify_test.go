@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/lanrat/czds/internal/clitest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyZones(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           string    // local copy of the com zone, served as "com zone"
+		modified       time.Time // modification time of the local copy
+		want           string
+		wantMismatches int
+	}{
+		{"match", "com zone", zoneModified, "com.txt\tok", 0},
+		{"newer local copy", "com zone", zoneModified.Add(time.Hour), "com.txt\tok", 0},
+		{"size mismatch", "com", zoneModified, "com.txt\tsize mismatch: local 3, remote 8", 1},
+		{"remote is newer", "com zone", zoneModified.Add(-time.Hour), "com.txt\tremote is newer", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			setFlags(t, map[string]string{"out": dir})
+			local := filepath.Join(dir, "com.txt")
+			err := os.WriteFile(local, []byte(tt.data), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.Chtimes(local, tt.modified, tt.modified)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// net has no local copy and is not reported
+			s := newDownloadServer(t, []string{"com", "net"}, "", false)
+
+			var mismatches int
+			out := clitest.CaptureStdout(t, func() { mismatches = verifyZones(s.links()) })
+			if mismatches != tt.wantMismatches {
+				t.Errorf("verifyZones() = %d mismatches, want %d", mismatches, tt.wantMismatches)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			if len(lines) != 1 || !strings.HasPrefix(lines[0], tt.want) {
+				t.Errorf("verifyZones() printed %q, want a single line starting with %q", out, tt.want)
+			}
+			if len(s.gets) != 0 {
+				t.Errorf("zones were downloaded while verifying: %v", s.gets)
+			}
+			data, err := os.ReadFile(local)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.data {
+				t.Errorf("local copy changed to %q", data)
+			}
+		})
+	}
+}
@@ -1,36 +1,69 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
 )
 
 // flags
 var (
-	username    = flag.String("username", "", "username to authenticate with")
-	password    = flag.String("password", "", "password to authenticate with")
-	passin      = flag.String("passin", "", "password source (default: prompt on tty; other options: cmd:command, env:var, file:path, keychain:name, lpass:name, op:name)")
-	verbose     = flag.Bool("verbose", false, "enable verbose logging")
-	reason      = flag.String("reason", "", "reason to request zone access")
-	printTerms  = flag.Bool("terms", false, "print CZDS Terms & Conditions")
-	requestTLDs = flag.String("request", "", "comma separated list of zones to request")
-	requestAll  = flag.Bool("request-all", false, "request all available zones")
-	status      = flag.Bool("status", false, "print status of zones")
-	extendTLDs  = flag.String("extend", "", "comma separated list of zones to request extensions")
-	extendAll   = flag.Bool("extend-all", false, "extend all possible zones")
-	exclude     = flag.String("exclude", "", "comma separated list of zones to exclude from request-all or extend-all")
-	cancelTLDs  = flag.String("cancel", "", "comma separated list of zones to cancel outstanding requests for")
-	showVersion = flag.Bool("version", false, "print version and exit")
+	username      = flag.String("username", "", "username to authenticate with")
+	password      = flag.String("password", "", "password to authenticate with")
+	configFile    = flag.String("config", "", "JSON config file with the username and passin to use when they are not passed as flags or environment variables, defaults to ~/.czds.json")
+	passin        = flag.String("passin", "", "password source (default: prompt on tty; other options: bw:name, cmd:command, env:var, file:path, gopass:path, keychain:name, lpass:name, op:name, stdin)")
+	verbose       = flag.Bool("verbose", false, "enable verbose logging")
+	debugHTTP     = flag.Bool("debug-http", false, "log every HTTP request and response, credentials are redacted")
+	quiet         = flag.Bool("quiet", false, "suppress informational output such as the requested, extended, and canceled zones, only errors are printed")
+	reason        = flag.String("reason", "", "reason to request zone access")
+	reasonFile    = flag.String("reason-file", "", "file to read the reason to request zone access from, '-' for stdin")
+	printTerms    = flag.Bool("terms", false, "print CZDS Terms & Conditions")
+	requestTLDs   = flag.String("request", "", "comma separated list of zones to request")
+	zonesFile     = flag.String("zones-file", "", "file with a zone to request on each line, added to -request, '#' starts a comment, '-' for stdin")
+	requestAll    = flag.Bool("request-all", false, "request all available zones")
+	reRequest     = flag.Bool("rerequest-expired", false, "request the zones that are expired, revoked, denied, or canceled again")
+	force         = flag.Bool("force", false, "with -request, request zones even if they are already approved, pending, or submitted")
+	status        = flag.Bool("status", false, "print status of zones")
+	format        = flag.String("format", "text", "output format of -status: text, json, or csv")
+	extendTLDs    = flag.String("extend", "", "comma separated list of zones to request extensions")
+	extendAll     = flag.Bool("extend-all", false, "extend all possible zones")
+	watch         = flag.Duration("watch", 0, "with -extend-all, keep running and extend all possible zones at this interval until interrupted")
+	exclude       = flag.String("exclude", "", "comma separated list of zones to exclude from request-all, rerequest-expired, extend-all, or cancel-pending")
+	cancelTLDs    = flag.String("cancel", "", "comma separated list of zones to cancel outstanding requests for")
+	cancelPending = flag.Bool("cancel-pending", false, "cancel all pending requests")
+	autoRenew     = flag.String("autorenew", "", "comma separated list of zones to enable auto-renew for")
+	noAutoRenew   = flag.String("no-autorenew", "", "comma separated list of zones to disable auto-renew for")
+	ftpIPs        = flag.String("ftp-ips", "", "comma separated list of additional IPs to allow FTP access from for new requests")
+	showVersion   = flag.Bool("version", false, "print version and exit")
+	testEnv       = flag.Bool("test", false, "use the CZDS test environment instead of production")
+	authURL       = flag.String("authurl", "", "override the CZDS authentication URL")
+	baseURL       = flag.String("baseurl", "", "override the CZDS API base URL")
+	userAgent     = flag.String("user-agent", "", "override the User-Agent header sent to CZDS, defaults to czds-go/<version>")
+	caCert        = flag.String("cacert", "", "file with additional PEM encoded CA certificates to trust, for TLS inspecting proxies")
+	insecure      = flag.Bool("insecure", false, "disable TLS certificate verification, only for test environments")
 )
 
 var (
-	version = "unknown"
-	client  *czds.Client
+	version   = "unknown"
+	client    *czds.Client
+	fileZones []string
+	ftpIPList []string         // parsed from -ftp-ips
+	outFormat cli.OutputFormat // parsed from -format
 )
 
 func v(format string, v ...interface{}) {
@@ -39,12 +72,23 @@ func v(format string, v ...interface{}) {
 	}
 }
 
+// info prints informational output unless -quiet is set
+func info(format string, a ...interface{}) {
+	if !*quiet {
+		fmt.Printf(format, a...)
+	}
+}
+
 func checkFlags() {
-	flag.Parse()
+	cli.ParseFlags()
 	if *showVersion {
-		fmt.Printf("Version: %s\n", version)
+		fmt.Printf("Version: %s\n%s\n", version, czds.BuildInfo())
 		os.Exit(0)
 	}
+	err := cli.ApplyConfig(*configFile, username, password, passin)
+	if err != nil {
+		log.Fatalf("unable to load config: %s", err)
+	}
 	flagError := false
 	if len(*username) == 0 {
 		log.Printf("must pass username")
@@ -54,50 +98,113 @@ func checkFlags() {
 		log.Printf("must pass either 'password' or 'passin'")
 		flagError = true
 	}
+	if len(*zonesFile) != 0 {
+		var err error
+		fileZones, err = cli.ReadZonesFile(*zonesFile)
+		if err != nil {
+			log.Print(err)
+			flagError = true
+		}
+		if *zonesFile == "-" && *reasonFile == "-" {
+			log.Printf("'-zones-file' and '-reason-file' cannot both read from stdin")
+			flagError = true
+		}
+	}
+	if *reRequest && (*requestAll || len(*requestTLDs) != 0 || len(*zonesFile) != 0) {
+		log.Printf("'-rerequest-expired' cannot be combined with '-request-all', '-request', or '-zones-file'")
+		flagError = true
+	}
+	if *passin == "stdin" && (*zonesFile == "-" || *reasonFile == "-") {
+		log.Printf("'-passin stdin' cannot be combined with '-zones-file -' or '-reason-file -'")
+		flagError = true
+	}
+	outFormat, err = cli.ParseFormat(*format, cli.FormatText, cli.FormatJSON, cli.FormatCSV)
+	if err != nil {
+		log.Printf("'-format' %s", err)
+		flagError = true
+	}
+	if len(*reason) != 0 && len(*reasonFile) != 0 {
+		log.Printf("'-reason' and '-reason-file' cannot be combined")
+		flagError = true
+	}
+	if *watch < 0 || (*watch > 0 && !*extendAll) {
+		log.Printf("'-watch' must be a positive duration used with '-extend-all'")
+		flagError = true
+	}
+	if len(*ftpIPs) != 0 {
+		var err error
+		ftpIPList, err = parseIPs(*ftpIPs)
+		if err != nil {
+			log.Printf("'-ftp-ips': %s", err)
+			flagError = true
+		}
+	}
 	if flagError {
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 }
 
 func main() {
 	checkFlags()
 
-	p := *password
-	if len(p) == 0 {
-		pass, err := czds.Getpass(*passin)
-		if err != nil {
-			log.Fatal("Unable to get password from user: ", err)
-		}
-		p = pass
+	// an interrupt stops the password prompt and any wait for a rate limit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p, err := cli.Password(ctx, *password, *passin)
+	if err != nil {
+		log.Fatal("Unable to get password from user: ", err)
 	}
 
-	doRequest := (*requestAll || len(*requestTLDs) > 0)
+	doRequest := (*requestAll || *reRequest || len(*requestTLDs) > 0 || len(fileZones) > 0)
 	doExtend := (*extendAll || len(*extendTLDs) > 0)
-	doCancel := len(*extendTLDs) > 0
-	if !*printTerms && !*status && !(doRequest || doExtend) && !doCancel {
-		log.Fatal("Nothing to do!")
+	doCancel := (*cancelPending || len(*cancelTLDs) > 0)
+	doAutoRenew := (len(*autoRenew) > 0 || len(*noAutoRenew) > 0)
+	if !*printTerms && !*status && !(doRequest || doExtend) && !doCancel && !doAutoRenew {
+		log.Print("Nothing to do!")
+		os.Exit(cli.ExitUsage)
 	}
 
 	excludeList := strings.Split(*exclude, ",")
 
-	client = czds.NewClient(*username, p)
+	client = cli.NewClient(*username, p, *testEnv, *authURL, *baseURL)
+	tlsConf, err := cli.TLSConfig(*caCert, *insecure)
+	if err != nil {
+		log.Fatalf("unable to load TLS config: %s", err)
+	}
+	if tlsConf != nil || *debugHTTP {
+		httpOpts := &czds.HTTPClientOptions{
+			TLSConfig: tlsConf,
+		}
+		if *debugHTTP {
+			httpOpts.DebugLogger = log.Default()
+		}
+		client.HTTPClient = czds.NewHTTPClient(httpOpts)
+	}
+	if len(*userAgent) != 0 {
+		client.UserAgent = *userAgent
+	}
+	// the TLD status is fetched by several of the actions, reuse it within a run
+	client.TLDStatusCacheTTL = time.Minute
+	client.TermsCacheTTL = time.Minute
 	if *verbose {
 		client.SetLogger(log.Default())
+		cli.PrintConfig(client)
 	}
 
 	// validate credentials
 	v("Authenticating to %s", client.AuthURL)
-	err := client.Authenticate()
+	err = client.Authenticate()
 	if err != nil {
-		log.Fatal(err)
+		cli.Fatal(err)
 	}
 
 	// print terms
 	if *printTerms {
 		terms, err := client.GetTerms()
 		if err != nil {
-			log.Fatal(err)
+			cli.Fatal(err)
 		}
 		v("Terms Version %s", terms.Version)
 		fmt.Println("Terms and Conditions:")
@@ -108,98 +215,314 @@ func main() {
 	if *status {
 		allTLDStatus, err := client.GetTLDStatus()
 		if err != nil {
-			log.Fatal(err)
+			cli.Fatal(err)
 		}
-		for _, tldStatus := range allTLDStatus {
-			printTLDStatus(tldStatus)
+		err = printAllTLDStatus(allTLDStatus)
+		if err != nil {
+			cli.Fatal(err)
 		}
 	}
 
 	// request
 	if doRequest {
+		if len(*reasonFile) != 0 {
+			*reason, err = readReason(*reasonFile)
+			if err != nil {
+				cli.Fatal(err)
+			}
+		}
 		if len(*reason) == 0 {
-			log.Fatal("Must pass a reason to request TLDs")
+			log.Print("Must pass a reason to request TLDs")
+			os.Exit(cli.ExitUsage)
+		}
+		opts := &czds.RequestOptions{
+			Force: *force,
+		}
+		if len(ftpIPList) != 0 {
+			opts.AdditionalFTPIps = ftpIPList
 		}
 		var requestedTLDs []string
 		if *requestAll {
 			v("Requesting all TLDs")
-			requestedTLDs, err = client.RequestAllTLDsExcept(*reason, excludeList)
+			var result *czds.RequestAllResult
+			result, err = client.RequestAllTLDsExceptWithResult(*reason, excludeList, opts)
+			if result != nil {
+				requestedTLDs = result.Requested
+				v("Skipped %d zones that are already approved, pending, or can not be requested", len(result.Skipped))
+				v("Excluded %d zones: %v", len(result.Excluded), result.Excluded)
+			}
+		} else if *reRequest {
+			v("Requesting expired, revoked, denied, and canceled TLDs again")
+			requestedTLDs, err = client.ReRequestExpiredWithContext(ctx, *reason, excludeList, opts)
 		} else {
-			tlds := strings.Split(*requestTLDs, ",")
+			tlds := append(strings.Split(*requestTLDs, ","), fileZones...)
 			v("Requesting %v", tlds)
-			err = client.RequestTLDs(tlds, *reason)
-			requestedTLDs = tlds
+			requestedTLDs, err = client.RequestTLDsWithOptions(tlds, *reason, opts)
+			if skipped := skippedTLDs(tlds, requestedTLDs); err == nil && len(skipped) > 0 {
+				if !*quiet {
+					log.Printf("skipped zones that are already approved, pending, or submitted, use -force to request them anyway: %v", skipped)
+				}
+			}
 		}
 
-		if err != nil {
-			log.Fatal(err)
-		}
 		if len(requestedTLDs) > 0 {
-			fmt.Printf("Requested: %v\n", requestedTLDs)
+			info("Requested: %v\n", requestedTLDs)
+		}
+		if err != nil {
+			cli.FatalPartial(err, len(requestedTLDs))
 		}
 	}
 	// extend
 	if doExtend {
 		var extendedTLDs []string
-		if *extendAll {
+		if *watch > 0 {
+			extendLoop(ctx, excludeList, *watch)
+		} else if *extendAll {
 			v("Requesting extension for all TLDs")
-			extendedTLDs, err = client.ExtendAllTLDsExcept(excludeList)
+			extendedTLDs, err = client.ExtendAllTLDsExceptWithContext(ctx, excludeList)
 		} else {
 			tlds := strings.Split(*extendTLDs, ",")
-			for _, tld := range tlds {
-				v("Requesting extension %v", tld)
-				err = client.ExtendTLD(tld)
-				if err != nil {
-					// stop on first error
-					break
-				}
-			}
-			extendedTLDs = tlds
+			v("Requesting extension %v", tlds)
+			extendedTLDs, err = client.ExtendTLDsWithContext(ctx, tlds)
 		}
 
-		if err != nil {
-			log.Fatal(err)
-		}
 		if len(extendedTLDs) > 0 {
-			fmt.Printf("Extended: %v\n", extendedTLDs)
+			info("Extended: %v\n", extendedTLDs)
+		}
+		if err != nil {
+			cli.FatalPartial(err, len(extendedTLDs))
 		}
 	}
 	// cancel
 	if doCancel {
-		tlds := strings.Split(*cancelTLDs, ",")
-		for _, tld := range tlds {
-			v("Requesting cancellation %v", tld)
-			err = cancelRequest(tld)
+		var canceledTLDs []string
+		if *cancelPending {
+			v("Requesting cancellation for all pending requests")
+			canceledTLDs, err = client.CancelAllPendingWithContext(ctx, excludeList)
+		} else {
+			tlds := strings.Split(*cancelTLDs, ",")
+			v("Requesting cancellation %v", tlds)
+			var canceled []*czds.RequestsInfo
+			canceled, err = client.CancelTLDsWithContext(ctx, tlds)
+			for _, request := range canceled {
+				if request.TLD != nil {
+					canceledTLDs = append(canceledTLDs, request.TLD.TLD)
+				}
+			}
+		}
+
+		if len(canceledTLDs) > 0 {
+			info("Canceled: %v\n", canceledTLDs)
+		}
+		if err != nil {
+			cli.FatalPartial(err, len(canceledTLDs))
+		}
+	}
+	// auto-renew
+	if doAutoRenew {
+		var errs []error
+		updatedCount := 0
+		for _, setting := range []struct {
+			tlds    string
+			enabled bool
+		}{{*autoRenew, true}, {*noAutoRenew, false}} {
+			if len(setting.tlds) == 0 {
+				continue
+			}
+			updated, err := setAutoRenew(strings.Split(setting.tlds, ","), setting.enabled)
+			updatedCount += len(updated)
+			if len(updated) > 0 {
+				if setting.enabled {
+					info("Enabled auto-renew: %v\n", updated)
+				} else {
+					info("Disabled auto-renew: %v\n", updated)
+				}
+			}
 			if err != nil {
-				// stop on first error
-				break
+				errs = append(errs, err)
 			}
 		}
+		if err := errors.Join(errs...); err != nil {
+			cli.FatalPartial(err, updatedCount)
+		}
+	}
+}
+
+// setAutoRenew enables or disables auto-renew for the most recent request of each of the tlds
+// returns the TLDs that were updated
+func setAutoRenew(tlds []string, enabled bool) ([]string, error) {
+	updated := make([]string, 0, len(tlds))
+	var errs []error
+	for _, tld := range tlds {
+		tld = strings.TrimSpace(tld)
+		requestID, err := client.GetZoneRequestID(tld)
 		if err != nil {
-			log.Fatal(err)
+			errs = append(errs, err)
+			continue
 		}
-		if len(tlds) > 0 {
-			fmt.Printf("Canceled: %v\n", tlds)
+		v("Setting auto-renew for %s (%s) to %t", tld, requestID, enabled)
+		_, err = client.SetAutoRenew(requestID, enabled)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tld, err))
+			continue
 		}
+		updated = append(updated, tld)
 	}
+	return updated, errors.Join(errs...)
+}
+
+// tldStatusJSON is a TLD in the -format json output of -status
+// it is czds.TLDStatus with the ulabel key spelled correctly, unlike the API
+type tldStatusJSON struct {
+	TLD           string `json:"tld"`
+	ULabel        string `json:"ulabel"`
+	CurrentStatus string `json:"currentStatus"`
+	SFTP          bool   `json:"sftp"`
+}
+
+// printAllTLDStatus prints the status of all TLDs in the -format format
+func printAllTLDStatus(allTLDStatus []czds.TLDStatus) error {
+	switch outFormat {
+	case cli.FormatJSON:
+		out := make([]tldStatusJSON, 0, len(allTLDStatus))
+		for _, tldStatus := range allTLDStatus {
+			out = append(out, tldStatusJSON{
+				TLD:           tldStatus.TLD,
+				ULabel:        tldStatus.UnicodeTLD(),
+				CurrentStatus: tldStatus.CurrentStatus,
+				SFTP:          tldStatus.SFTP,
+			})
+		}
+		return cli.PrintJSON(out)
+	case cli.FormatCSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"tld", "ulabel", "status", "sftp"})
+		for _, tldStatus := range allTLDStatus {
+			w.Write([]string{tldStatus.TLD, tldStatus.UnicodeTLD(), tldStatus.CurrentStatus, strconv.FormatBool(tldStatus.SFTP)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	for _, tldStatus := range allTLDStatus {
+		printTLDStatus(tldStatus)
+	}
+	printStatusSummary(allTLDStatus)
+	return nil
 }
 
 func printTLDStatus(tldStatus czds.TLDStatus) {
 	fmt.Printf("%s\t%s\n", tldStatus.TLD, tldStatus.CurrentStatus)
 }
 
-func cancelRequest(zone string) error {
-	zoneID, err := client.GetZoneRequestID(zone)
+// printStatusSummary prints the number of TLDs in each status, most common first
+func printStatusSummary(allTLDStatus []czds.TLDStatus) {
+	counts := make(map[string]int)
+	for _, tldStatus := range allTLDStatus {
+		counts[tldStatus.CurrentStatus]++
+	}
+	statuses := make([]string, 0, len(counts))
+	for status := range counts {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if counts[statuses[i]] != counts[statuses[j]] {
+			return counts[statuses[i]] > counts[statuses[j]]
+		}
+		return statuses[i] < statuses[j]
+	})
+	summary := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		summary = append(summary, fmt.Sprintf("%s: %d", status, counts[status]))
+	}
+	fmt.Printf("Total %d: %s\n", len(allTLDStatus), strings.Join(summary, ", "))
+}
+
+// parseIPs parses a comma separated list of IPs, spaces around each IP and empty entries are ignored
+func parseIPs(list string) ([]string, error) {
+	ips := make([]string, 0)
+	var errs []error
+	for _, ip := range strings.Split(list, ",") {
+		ip = strings.TrimSpace(ip)
+		if len(ip) == 0 {
+			continue
+		}
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("invalid IP %q", ip))
+			continue
+		}
+		ips = append(ips, ip)
+	}
+	return ips, errors.Join(errs...)
+}
+
+// skippedTLDs returns the tlds that are not in requested
+// both are compared in their punycode form, as returned by RequestTLDsWithOptions
+func skippedTLDs(tlds, requested []string) []string {
+	requestedMap := make(map[string]bool, len(requested))
+	for _, tld := range requested {
+		requestedMap[asciiTLD(tld)] = true
+	}
+	skipped := make([]string, 0)
+	for _, tld := range tlds {
+		tld = strings.TrimSpace(tld)
+		if len(tld) != 0 && !requestedMap[asciiTLD(tld)] {
+			skipped = append(skipped, tld)
+		}
+	}
+	return skipped
+}
+
+// asciiTLD returns the lowercase punycode form of tld, or tld lowercased if it can not be encoded
+func asciiTLD(tld string) string {
+	ascii, err := czds.ToASCII(tld)
 	if err != nil {
-		return err
+		return strings.ToLower(tld)
 	}
-	cancelRequest := &czds.CancelRequestSubmission{
-		RequestID: zoneID,
-		TLDName:   zone,
+	return ascii
+}
+
+// extendLoop extends all possible zones every interval until ctx is done
+func extendLoop(ctx context.Context, excludeList []string, interval time.Duration) {
+	for cycle := 1; ; cycle++ {
+		v("Requesting extension for all TLDs, cycle %d", cycle)
+		extendedTLDs, err := client.ExtendAllTLDsExceptWithContext(ctx, excludeList)
+		if err != nil {
+			// keep watching, the next cycle may succeed
+			log.Printf("extend cycle %d: %s", cycle, err)
+		}
+		if !*quiet {
+			log.Printf("extend cycle %d: extended %d TLDs %v", cycle, len(extendedTLDs), extendedTLDs)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if !*quiet {
+				log.Printf("interrupted, stopping")
+			}
+			return
+		}
+	}
+}
+
+// readReason reads the request reason from the file at path, or stdin if path is "-"
+// a single trailing newline is removed, all other formatting is preserved
+func readReason(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		v("Reading reason from stdin")
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		v("Reading reason from %s", path)
+		data, err = os.ReadFile(path)
 	}
-	_, err = client.CancelRequest(cancelRequest)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("unable to read reason from %q: %w", path, err)
 	}
-	return nil
+	reason := strings.TrimSuffix(string(data), "\n")
+	reason = strings.TrimSuffix(reason, "\r")
+	return reason, nil
 }
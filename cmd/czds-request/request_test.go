@@ -0,0 +1,571 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+func TestReadReason(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		stdin   bool
+		want    string
+	}{
+		{"single line", "research\n", false, "research"},
+		{"no trailing newline", "research", false, "research"},
+		{"crlf", "research\r\n", false, "research"},
+		{"only one trailing newline is removed", "research\n\n", false, "research\n"},
+		{"internal formatting is preserved", "  line one\n\tline two\n", false, "  line one\n\tline two"},
+		{"stdin", "from stdin\n", true, "from stdin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "reason.txt")
+			err := os.WriteFile(path, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stdin {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+				path = "-"
+			}
+			got, err := readReason(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReasonMissing(t *testing.T) {
+	_, err := readReason(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("readReason() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestPrintStatusSummary(t *testing.T) {
+	status := func(statuses ...string) []czds.TLDStatus {
+		out := make([]czds.TLDStatus, 0, len(statuses))
+		for _, s := range statuses {
+			out = append(out, czds.TLDStatus{CurrentStatus: s})
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		status []czds.TLDStatus
+		want   string
+	}{
+		{"empty", nil, "Total 0: \n"},
+		{
+			"grouped by count",
+			status(czds.StatusApproved, czds.StatusAvailable, czds.StatusApproved, czds.StatusPending, czds.StatusApproved, czds.StatusAvailable),
+			"Total 6: approved: 3, available: 2, pending: 1\n",
+		},
+		{
+			"ties sorted by name",
+			status(czds.StatusPending, czds.StatusExpired, czds.StatusApproved),
+			"Total 3: approved: 1, expired: 1, pending: 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clitest.CaptureStdout(t, func() { printStatusSummary(tt.status) }); got != tt.want {
+				t.Errorf("printStatusSummary() printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendLoop(t *testing.T) {
+	tests := []struct {
+		name   string
+		cycles int32
+		fail   bool // every extension fails
+	}{
+		{"single cycle", 1, false},
+		{"multiple cycles", 3, false},
+		{"keeps watching after errors", 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var extensions atomic.Int32
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter czds.RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				resp := czds.RequestsResponse{}
+				if filter.Pagination.Page == 0 {
+					resp.Requests = []czds.Request{{RequestID: "1", TLD: "com", Status: czds.RequestApproved, Expired: time.Now().Add(time.Hour)}}
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+			mux.HandleFunc("/czds/requests/1", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", Extensible: true})
+			})
+			mux.HandleFunc("/czds/requests/extension/", func(w http.ResponseWriter, r *http.Request) {
+				// stop the loop once enough cycles have run
+				if extensions.Add(1) == tt.cycles {
+					cancel()
+				}
+				if tt.fail {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: strings.TrimPrefix(r.URL.Path, "/czds/requests/extension/"), ExtensionInProcess: true})
+			})
+			clitest.NewClient(t, mux, &client)
+
+			done := make(chan struct{})
+			go func() {
+				extendLoop(ctx, nil, time.Millisecond)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("extendLoop did not stop after the context was canceled")
+			}
+			if n := extensions.Load(); n != tt.cycles {
+				t.Errorf("extended %d times, want %d", n, tt.cycles)
+			}
+		})
+	}
+}
+
+func TestSetAutoRenew(t *testing.T) {
+	requests := []czds.Request{
+		{RequestID: "id-com", TLD: "com", Status: czds.RequestApproved},
+		{RequestID: "id-net", TLD: "net", Status: czds.RequestApproved},
+	}
+	tests := []struct {
+		name    string
+		tlds    []string
+		enabled bool
+		want    []string // TLDs updated
+		wantIDs []string // request IDs sent to the autorenew endpoint
+		wantErr string
+	}{
+		{"enable", []string{"com", " net"}, true, []string{"com", "net"}, []string{"id-com", "id-net"}, ""},
+		{"disable", []string{"com"}, false, []string{"com"}, []string{"id-com"}, ""},
+		{"unknown zone", []string{"org", "com"}, true, []string{"com"}, []string{"id-com"}, "no request found for zone org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter czds.RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				var resp czds.RequestsResponse
+				for _, request := range requests {
+					if filter.Pagination.Page == 0 && strings.Contains(request.TLD, filter.Filter) {
+						resp.Requests = append(resp.Requests, request)
+						resp.TotalRequests++
+					}
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+			mux.HandleFunc("/czds/requests/autorenew/", func(w http.ResponseWriter, r *http.Request) {
+				var payload struct {
+					AutoRenew bool `json:"autoRenew"`
+				}
+				json.NewDecoder(r.Body).Decode(&payload)
+				if payload.AutoRenew != tt.enabled {
+					t.Errorf("autoRenew = %t, want %t", payload.AutoRenew, tt.enabled)
+				}
+				id := strings.TrimPrefix(r.URL.Path, "/czds/requests/autorenew/")
+				ids = append(ids, id)
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: id, AutoRenew: payload.AutoRenew})
+			})
+			clitest.NewClient(t, mux, &client)
+
+			got, err := setAutoRenew(tt.tlds, tt.enabled)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("setAutoRenew() error = %v, want %q", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("setAutoRenew() = %v, want %v", got, tt.want)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("auto-renew set for %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestPrintAllTLDStatus(t *testing.T) {
+	tests := []struct {
+		format cli.OutputFormat
+		golden string
+	}{
+		{cli.FormatText, "status.txt"},
+		{cli.FormatJSON, "status.json"},
+		{cli.FormatCSV, "status.csv"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		// ulable is the API's spelling, the ULabel of рф is left empty to be decoded from the TLD
+		w.Write([]byte(`[
+			{"tld": "com", "ulable": "com", "currentStatus": "approved", "sftp": false},
+			{"tld": "net", "ulable": "net", "currentStatus": "pending", "sftp": true},
+			{"tld": "xn--p1ai", "ulable": "", "currentStatus": "available", "sftp": false}
+		]`))
+	})
+	clitest.NewClient(t, mux, &client)
+	allTLDStatus, err := client.GetTLDStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			format := outFormat
+			outFormat = tt.format
+			defer func() { outFormat = format }()
+			var printErr error
+			got := clitest.CaptureStdout(t, func() { printErr = printAllTLDStatus(allTLDStatus) })
+			if printErr != nil {
+				t.Fatal(printErr)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("printAllTLDStatus() output does not match testdata/%s:\n%s", tt.golden, got)
+			}
+		})
+	}
+}
+
+// runMain runs main with the command line args, the flags and the values parsed from them are reset afterwards
+func runMain(t *testing.T, args ...string) {
+	t.Helper()
+	defer func() { fileZones, ftpIPList = nil, nil }()
+	clitest.RunMain(t, main, "czds-request", args...)
+}
+
+func TestQuiet(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		quiet   bool
+		wantOut string
+	}{
+		{"request", []string{"-request", "com", "-reason", "research"}, false, "Requested: [com]\n"},
+		{"request quiet", []string{"-request", "com", "-reason", "research"}, true, ""},
+		{"extend", []string{"-extend", "com"}, false, "Extended: [com]\n"},
+		{"extend quiet", []string{"-extend", "com"}, true, ""},
+		{"cancel", []string{"-cancel", "com"}, false, "Canceled: [com]\n"},
+		{"cancel quiet", []string{"-cancel", "com"}, true, ""},
+		{"auto-renew", []string{"-autorenew", "com"}, false, "Enabled auto-renew: [com]\n"},
+		{"auto-renew quiet", []string{"-autorenew", "com"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode([]czds.TLDStatus{{TLD: "com", CurrentStatus: czds.StatusAvailable}})
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {})
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter czds.RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				resp := czds.RequestsResponse{}
+				if filter.Pagination.Page == 0 {
+					resp.Requests = []czds.Request{{RequestID: "1", TLD: "com", Status: czds.RequestApproved, Expired: time.Now().Add(time.Hour)}}
+					resp.TotalRequests = 1
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+			mux.HandleFunc("/czds/requests/1", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", TLD: &czds.TLDStatus{TLD: "com"}, Status: czds.RequestApproved, Extensible: true})
+			})
+			mux.HandleFunc("/czds/requests/extension/1", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", ExtensionInProcess: true})
+			})
+			mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", TLD: &czds.TLDStatus{TLD: "com"}, Status: czds.RequestCanceled})
+			})
+			mux.HandleFunc("/czds/requests/autorenew/1", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", AutoRenew: true})
+			})
+			url := clitest.NewClient(t, mux, &client)
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			args := append([]string{"-username", "user", "-password", "pass", "-authurl", url + "/api/authenticate", "-baseurl", url}, tt.args...)
+			if tt.quiet {
+				args = append(args, "-quiet")
+			}
+			out := clitest.CaptureStdout(t, func() { runMain(t, args...) })
+			if out != tt.wantOut {
+				t.Errorf("stdout = %q, want %q", out, tt.wantOut)
+			}
+			if tt.quiet && logs.Len() > 0 {
+				t.Errorf("logged %q with -quiet", logs.String())
+			}
+		})
+	}
+}
+
+// TestMain runs main with the arguments in CZDS_TEST_MAIN_ARGS when it is set, so that exit statuses can be tested
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("CZDS_TEST_MAIN_ARGS"); ok {
+		os.Args = append([]string{"czds-request"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       string
+		authStatus int // status of the authentication, 0 for success
+		tldStatus  int // status of /czds/tlds, 0 for success
+		want       int
+	}{
+		{"success", "-status", 0, 0, 0},
+		{"nothing to do", "", 0, 0, cli.ExitUsage},
+		{"invalid flag", "-no-such-flag", 0, 0, cli.ExitUsage},
+		{"authentication rejected", "-status", http.StatusUnauthorized, 0, cli.ExitAuth},
+		{"server error", "-status", 0, http.StatusBadGateway, cli.ExitNetwork},
+		{"not found", "-status", 0, http.StatusNotFound, cli.ExitError},
+		{"partial", "-cancel com,net", 0, 0, cli.ExitPartial},
+		{"all failed", "-cancel net,org", 0, 0, cli.ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := clitest.JWT(t)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/authenticate", func(w http.ResponseWriter, r *http.Request) {
+				if tt.authStatus != 0 {
+					http.Error(w, "authentication failed", tt.authStatus)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]string{"accessToken": token, "message": "ok"})
+			})
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				if tt.tldStatus != 0 {
+					http.Error(w, http.StatusText(tt.tldStatus), tt.tldStatus)
+					return
+				}
+				json.NewEncoder(w).Encode([]czds.TLDStatus{{TLD: "com", CurrentStatus: czds.StatusPending}})
+			})
+			// only com has a request to cancel
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter czds.RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				resp := czds.RequestsResponse{}
+				if filter.Pagination.Page == 0 && filter.Filter == "com" {
+					resp.Requests = []czds.Request{{RequestID: "1", TLD: "com", Status: czds.RequestPending}}
+					resp.TotalRequests = 1
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+			mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "1", TLD: &czds.TLDStatus{TLD: "com"}, Status: czds.RequestCanceled})
+			})
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), "CZDS_TEST_MAIN_ARGS=-username user -password pass -authurl "+ts.URL+"/api/authenticate -baseurl "+ts.URL+" "+tt.args)
+			out, err := cmd.CombinedOutput()
+			status := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Errorf("exit status %d, want %d, output:\n%s", status, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "CZDS_TEST_MAIN_ARGS=-version")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Version: " + version + "\n" + czds.BuildInfo() + "\n"; string(out) != want {
+		t.Errorf("-version printed %q, want %q", out, want)
+	}
+}
+
+func TestUserAgentFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"default", nil, czds.DefaultUserAgent()},
+		{"override", []string{"-user-agent", "zone-sync/1.0"}, "zone-sync/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("User-Agent")
+				w.Write([]byte("[]"))
+			})
+			url := clitest.NewClient(t, mux, &client)
+			args := append([]string{"-username", "user", "-password", "pass", "-authurl", url + "/api/authenticate", "-baseurl", url, "-status"}, tt.args...)
+			clitest.CaptureStdout(t, func() { runMain(t, args...) })
+			if got != tt.want {
+				t.Errorf("User-Agent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReRequestExpiredFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string // TLDs submitted
+		wantOut string
+	}{
+		{"previously held", nil, []string{"net", "org", "xyz", "app"}, "Requested: [net org xyz app]\n"},
+		{"exclude", []string{"-exclude", "net,APP"}, []string{"org", "xyz"}, "Requested: [org xyz]\n"},
+		{"nothing to request", []string{"-exclude", "net,org,xyz,app"}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submitted []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode([]czds.TLDStatus{
+					{TLD: "com", CurrentStatus: czds.StatusApproved},
+					{TLD: "net", CurrentStatus: czds.StatusExpired},
+					{TLD: "org", CurrentStatus: czds.StatusRevoked},
+					{TLD: "xyz", CurrentStatus: czds.StatusDenied},
+					{TLD: "app", CurrentStatus: czds.StatusCanceled},
+					{TLD: "biz", CurrentStatus: czds.StatusAvailable},
+					{TLD: "info", CurrentStatus: czds.StatusPending},
+				})
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				var request czds.RequestSubmission
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					t.Error(err)
+				}
+				submitted = append(submitted, request.TLDNames...)
+			})
+			url := clitest.NewClient(t, mux, &client)
+
+			args := append([]string{"-username", "user", "-password", "pass", "-authurl", url + "/api/authenticate", "-baseurl", url,
+				"-rerequest-expired", "-reason", "research"}, tt.args...)
+			out := clitest.CaptureStdout(t, func() { runMain(t, args...) })
+			if !slices.Equal(submitted, tt.want) {
+				t.Errorf("submitted %v, want %v", submitted, tt.want)
+			}
+			if out != tt.wantOut {
+				t.Errorf("stdout = %q, want %q", out, tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestParseIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"comma separated", "1.2.3.4,5.6.7.8", []string{"1.2.3.4", "5.6.7.8"}, false},
+		{"spaces", "1.2.3.4, 5.6.7.8", []string{"1.2.3.4", "5.6.7.8"}, false},
+		{"empty entries", " 1.2.3.4 ,,2001:db8::1, ", []string{"1.2.3.4", "2001:db8::1"}, false},
+		{"invalid", "1.2.3.4, example.com", []string{"1.2.3.4"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIPs(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIPs(%q) error = %v, want error: %t", tt.list, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseIPs(%q) = %q, want %q", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFTPIPsFlag(t *testing.T) {
+	var submitted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]czds.TLDStatus{{TLD: "com", CurrentStatus: czds.StatusAvailable}})
+	})
+	mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(czds.Terms{Version: "1"})
+	})
+	mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+		var request czds.RequestSubmission
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			t.Error(err)
+		}
+		submitted = request.AdditionalFTPIps
+	})
+	url := clitest.NewClient(t, mux, &client)
+
+	clitest.CaptureStdout(t, func() {
+		runMain(t, "-username", "user", "-password", "pass", "-authurl", url+"/api/authenticate", "-baseurl", url,
+			"-request", "com", "-reason", "research", "-ftp-ips", "1.2.3.4, 5.6.7.8")
+	})
+	if want := []string{"1.2.3.4", "5.6.7.8"}; !slices.Equal(submitted, want) {
+		t.Errorf("submitted FTP IPs %q, want %q", submitted, want)
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/csv"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
 )
 
 func printRequestInfo(info *czds.RequestsInfo) {
 	fmt.Printf("ID:\t%s\n", info.RequestID)
-	fmt.Printf("TLD:\t%s (%s)\n", info.TLD.TLD, info.TLD.ULabel)
+	fmt.Printf("TLD:\t%s (%s)\n", info.TLD.TLD, info.TLD.UnicodeTLD())
 	fmt.Printf("Status:\t%s\n", info.Status)
 	fmt.Printf("Created:\t%s\n", info.Created.Format(time.ANSIC))
 	fmt.Printf("Updated:\t%s\n", info.LastUpdated.Format(time.ANSIC))
@@ -20,25 +25,174 @@ func printRequestInfo(info *czds.RequestsInfo) {
 	fmt.Printf("Cancellable:\t%t\n", info.Cancellable)
 	fmt.Printf("Request IP:\t%s\n", info.RequestIP)
 	fmt.Println("FTP IPs:\t", info.FtpIps)
-	fmt.Printf("Reason:\t%s\n", info.Reason)
+	fmt.Printf("Reason:\t%s\n", flatten(info.Reason))
 	fmt.Printf("History:\n")
 	for _, event := range info.History {
-		fmt.Printf("\t%s\t%s\n", event.Timestamp.Format(time.ANSIC), event.Action)
+		fmt.Printf("\t%s\t%s\t%s\n", event.Timestamp.Format(time.ANSIC), event.Action, flatten(event.Comment))
 	}
 }
 
-func printRequest(request czds.Request) {
-	fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t%t\n",
-		request.TLD,
-		request.RequestID,
-		request.ULabel,
-		request.Status,
-		request.Created.Format(time.ANSIC),
-		request.LastUpdated.Format(time.ANSIC),
-		expiredTime(request.Expired),
-		request.SFTP)
+// column is a column of the text list of requests
+type column struct {
+	name   string // used with -columns
+	header string
+	value  func(czds.Request) string
 }
 
-func printHeader() {
-	fmt.Printf("TLD\tID\tUnicodeTLD\tStatus\tCreated\tUpdated\tExpires\tSFTP\n")
+// allColumns are the columns that may be selected with -columns
+var allColumns = []column{
+	{"tld", "TLD", func(r czds.Request) string { return r.TLD }},
+	{"id", "ID", func(r czds.Request) string { return r.RequestID }},
+	{"unicodetld", "UnicodeTLD", func(r czds.Request) string { return r.UnicodeTLD() }},
+	{"status", "Status", func(r czds.Request) string { return r.Status }},
+	{"created", "Created", func(r czds.Request) string { return r.Created.Format(time.ANSIC) }},
+	{"updated", "Updated", func(r czds.Request) string { return r.LastUpdated.Format(time.ANSIC) }},
+	{"expires", "Expires", func(r czds.Request) string { return expiredTime(r.Expired) }},
+	{"sftp", "SFTP", func(r czds.Request) string { return strconv.FormatBool(r.SFTP) }},
+	{"autorenew", "AutoRenew", func(r czds.Request) string { return strconv.FormatBool(r.AutoRenew) }},
+}
+
+// defaultColumns are printed when -columns is not set
+// new columns are only added with -wide so existing parsers of the default columns keep working
+const defaultColumns = "tld,id,unicodetld,status,created,updated,expires,sftp"
+
+// columnNames returns the names of all of the columns
+func columnNames() []string {
+	names := make([]string, 0, len(allColumns))
+	for _, c := range allColumns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// findColumn returns the column named name, ignoring case and surrounding spaces
+func findColumn(name string) (column, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, c := range allColumns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// selectedColumns returns the columns to print from -columns and -wide
+func selectedColumns() []column {
+	names := *columns
+	if len(names) == 0 {
+		names = defaultColumns
+		if *wide {
+			names += ",autorenew"
+		}
+	}
+	var selected []column
+	for _, name := range strings.Split(names, ",") {
+		if c, ok := findColumn(name); ok {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+// printRequest prints the cols of request as a line of the text list of requests
+func printRequest(cols []column, request czds.Request) {
+	values := make([]string, 0, len(cols))
+	for _, c := range cols {
+		values = append(values, c.value(request))
+	}
+	fmt.Println(strings.Join(values, "\t"))
+}
+
+// printRequests prints the requests in the -format format
+// the json format is an array of czds.Request objects
+func printRequests(requests []czds.Request) {
+	if outFormat == cli.FormatCSV {
+		err := printRequestsCSV(requests)
+		if err != nil {
+			cli.Fatal(err)
+		}
+		return
+	}
+	if outFormat == cli.FormatJSON {
+		if requests == nil {
+			requests = []czds.Request{}
+		}
+		printJSON(requests)
+		return
+	}
+	if len(requests) > 0 {
+		// the columns are selected once for the whole list
+		cols := selectedColumns()
+		printHeader(cols)
+		for _, request := range requests {
+			printRequest(cols, request)
+		}
+	}
+}
+
+// printRequestsCSV prints the requests as CSV with a header row and RFC3339 timestamps
+// unlike -report, the columns are the fields of czds.Request
+func printRequestsCSV(requests []czds.Request) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"tld", "requestId", "ulabel", "status", "created", "lastUpdated", "expired", "sftp", "autoRenew"})
+	for _, request := range requests {
+		w.Write([]string{
+			request.TLD,
+			request.RequestID,
+			request.UnicodeTLD(),
+			request.Status,
+			csvTime(request.Created),
+			csvTime(request.LastUpdated),
+			csvTime(request.Expired),
+			strconv.FormatBool(request.SFTP),
+			strconv.FormatBool(request.AutoRenew),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvTime formats t as RFC3339, or an empty string if t is unset
+func csvTime(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) {
+	err := cli.PrintJSON(v)
+	if err != nil {
+		cli.Fatal(err)
+	}
+}
+
+// printWhoAmI prints the account the client is authenticated as
+// the json format is a czds.Identity object
+func printWhoAmI() {
+	identity, err := client.WhoAmI()
+	if err != nil {
+		cli.Fatal(err)
+	}
+	if outFormat == cli.FormatJSON {
+		printJSON(identity)
+		return
+	}
+	fmt.Printf("Username:\t%s\n", identity.Username)
+	if len(identity.Email) > 0 {
+		fmt.Printf("Email:\t%s\n", identity.Email)
+	}
+	if name := strings.TrimSpace(identity.GivenName + " " + identity.FamilyName); len(name) > 0 {
+		fmt.Printf("Name:\t%s\n", name)
+	}
+	fmt.Printf("Token Expires:\t%s\n", identity.Expires.Format(time.ANSIC))
+}
+
+func printHeader(cols []column) {
+	headers := make([]string, 0, len(cols))
+	for _, c := range cols {
+		headers = append(headers, c.header)
+	}
+	fmt.Println(strings.Join(headers, "\t"))
 }
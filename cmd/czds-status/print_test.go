@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+func TestFlatten(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"one line", "one line"},
+		{"line one\nline two", "line one line two"},
+		{"line one\r\nline two\n", "line one line two "},
+	}
+	for _, tt := range tests {
+		if got := flatten(tt.in); got != tt.want {
+			t.Errorf("flatten(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPrintRequestInfoHistory(t *testing.T) {
+	created := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	denied := time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)
+	info := &czds.RequestsInfo{
+		RequestID: "1",
+		TLD:       &czds.TLDStatus{TLD: "com"},
+		Reason:    "reason one\nreason two",
+		History: []czds.HistoryEntry{
+			{Timestamp: created, Action: "Created"},
+			{Timestamp: denied, Action: "Denied", Comment: "comment one\r\ncomment two"},
+		},
+	}
+	out := clitest.CaptureStdout(t, func() { printRequestInfo(info) })
+	for _, want := range []string{
+		"Reason:\treason one reason two\n",
+		"\t" + created.Format(time.ANSIC) + "\tCreated\t\n",
+		"\t" + denied.Format(time.ANSIC) + "\tDenied\tcomment one comment two\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printRequestInfo() output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPrintRequestsUnicodeTLD(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		// ulable is the API's spelling, the server leaves it empty for some IDN TLDs
+		w.Write([]byte(`{"requests": [
+			{"requestId": "1", "tld": "xn--p1ai", "ulable": "", "status": "Approved"},
+			{"requestId": "2", "tld": "xn--90ais", "ulable": "бел", "status": "Approved"},
+			{"requestId": "3", "tld": "com", "ulable": "", "status": "Approved"}
+		], "totalRequests": 3}`))
+	})
+	clitest.NewClient(t, mux, &client)
+	resp, err := client.GetRequests(&czds.RequestsFilter{Status: czds.RequestAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format cli.OutputFormat
+		want   string
+	}{
+		{cli.FormatText, "TLD\tUnicodeTLD\nxn--p1ai\tрф\nxn--90ais\tбел\ncom\tcom\n"},
+		{cli.FormatCSV, "tld,requestId,ulabel,status,created,lastUpdated,expired,sftp,autoRenew\n" +
+			"xn--p1ai,1,рф,Approved,,,,false,false\n" +
+			"xn--90ais,2,бел,Approved,,,,false,false\n" +
+			"com,3,com,Approved,,,,false,false\n"},
+	}
+	old := *columns
+	flag.Set("columns", "tld,unicodetld")
+	defer flag.Set("columns", old)
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			format := outFormat
+			outFormat = tt.format
+			defer func() { outFormat = format }()
+			if got := clitest.CaptureStdout(t, func() { printRequests(resp.Requests) }); got != tt.want {
+				t.Errorf("printRequests() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,38 +1,71 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
 )
 
 // flags
 var (
 	username    = flag.String("username", "", "username to authenticate with")
 	password    = flag.String("password", "", "password to authenticate with")
-	passin      = flag.String("passin", "", "password source (default: prompt on tty; other options: cmd:command, env:var, file:path, keychain:name, lpass:name, op:name)")
+	configFile  = flag.String("config", "", "JSON config file with the username and passin to use when they are not passed as flags or environment variables, defaults to ~/.czds.json")
+	passin      = flag.String("passin", "", "password source (default: prompt on tty; other options: bw:name, cmd:command, env:var, file:path, gopass:path, keychain:name, lpass:name, op:name, stdin)")
 	verbose     = flag.Bool("verbose", false, "enable verbose logging")
+	debugHTTP   = flag.Bool("debug-http", false, "log every HTTP request and response, credentials are redacted")
 	id          = flag.String("id", "", "ID of specific zone request to lookup, defaults to printing all")
 	zone        = flag.String("zone", "", "same as -id, but prints the request by zone name")
+	format      = flag.String("format", "text", "output format of the requests, request details, and -diff: text or json, or csv for the list of requests")
+	wide        = flag.Bool("wide", false, "add the AutoRenew column to the text list of requests")
+	columns     = flag.String("columns", "", "comma separated columns of the text list of requests to print in order, from: "+strings.Join(columnNames(), ", "))
+	raw         = flag.Bool("raw", false, "with -id or -zone, print the raw JSON of the request from the server")
+	histLimit   = flag.Uint("history-limit", 0, "with -id or -zone, only print the N most recent history events, 0 for all")
+	histSince   = flag.String("history-since", "", "with -id or -zone, only print history events on or after this date, ex: 2024-06-01 or 2024-06-01T15:04:05Z")
+	wait        = flag.String("wait", "", "with -id or -zone, wait until the request has this status, ex: approved, exits non-zero if it reaches another final status such as denied")
+	waitPoll    = flag.Duration("wait-interval", time.Minute, "how often to check the status of the request with -wait")
 	showVersion = flag.Bool("version", false, "print version and exit")
+	testEnv     = flag.Bool("test", false, "use the CZDS test environment instead of production")
+	authURL     = flag.String("authurl", "", "override the CZDS authentication URL")
+	baseURL     = flag.String("baseurl", "", "override the CZDS API base URL")
+	userAgent   = flag.String("user-agent", "", "override the User-Agent header sent to CZDS, defaults to czds-go/<version>")
+	caCert      = flag.String("cacert", "", "file with additional PEM encoded CA certificates to trust, for TLS inspecting proxies")
+	insecure    = flag.Bool("insecure", false, "disable TLS certificate verification, only for test environments")
 	report      = flag.String("report", "", "filename to save report CSV to, '-' for stdout")
+	diff        = flag.String("diff", "", "compare the current report with a previously saved report CSV and print the TLDs that were added, removed, or changed status")
+	inactive    = flag.Bool("inactive", false, "list the TLDs whose most recent request is expired, revoked, or denied")
+	expiring    = flag.String("expiring", "", "list approved requests expiring within the duration, ex: 30d or 72h")
+	whoami      = flag.Bool("whoami", false, "print the account the credentials authenticate as and when the token expires")
 )
 
 var (
-	version = "unknown"
-	client  *czds.Client
+	version   = "unknown"
+	client    *czds.Client
+	outFormat cli.OutputFormat // parsed from -format
 )
 
 func checkFlags() {
-	flag.Parse()
+	cli.ParseFlags()
 	if *showVersion {
-		fmt.Printf("Version: %s\n", version)
+		fmt.Printf("Version: %s\n%s\n", version, czds.BuildInfo())
 		os.Exit(0)
 	}
+	err := cli.ApplyConfig(*configFile, username, password, passin)
+	if err != nil {
+		log.Fatalf("unable to load config: %s", err)
+	}
 	flagError := false
 	if len(*username) == 0 {
 		log.Printf("must pass username")
@@ -42,96 +75,254 @@ func checkFlags() {
 		log.Printf("must pass either 'password' or 'passin'")
 		flagError = true
 	}
-	if (len(*report) > 0) && ((*id != "") || (*zone != "")) {
-		log.Printf("can not use -report with specific zone request")
+	if (len(*report) > 0 || len(*diff) > 0) && ((*id != "") || (*zone != "")) {
+		log.Printf("can not use -report or -diff with specific zone request")
+		flagError = true
+	}
+	outFormat, err = cli.ParseFormat(*format, cli.FormatText, cli.FormatJSON, cli.FormatCSV)
+	if err != nil {
+		log.Printf("'-format' %s", err)
+		flagError = true
+	}
+	if outFormat == cli.FormatCSV && (*id != "" || *zone != "" || len(*diff) > 0 || *whoami) {
+		log.Printf("'-format csv' is only supported for the list of requests")
+		flagError = true
+	}
+	if *whoami && (*id != "" || *zone != "" || len(*report) > 0 || len(*diff) > 0 || *inactive || len(*expiring) > 0) {
+		log.Printf("can not use -whoami with -id, -zone, -report, -diff, -inactive, or -expiring")
+		flagError = true
+	}
+	if len(*columns) > 0 {
+		if *wide {
+			log.Printf("'-columns' and '-wide' cannot be combined, add autorenew to -columns")
+			flagError = true
+		}
+		for _, name := range strings.Split(*columns, ",") {
+			if _, ok := findColumn(name); !ok {
+				log.Printf("unknown column %q in '-columns', must be one of: %s", name, strings.Join(columnNames(), ", "))
+				flagError = true
+			}
+		}
+	}
+	if *raw && *id == "" && *zone == "" {
+		log.Printf("-raw requires -id or -zone")
+		flagError = true
+	}
+	if (*histLimit > 0 || len(*histSince) > 0) && *id == "" && *zone == "" {
+		log.Printf("-history-limit and -history-since require -id or -zone")
+		flagError = true
+	}
+	if *raw && (*histLimit > 0 || len(*histSince) > 0) {
+		log.Printf("can not use -raw with -history-limit or -history-since, the raw JSON is not filtered")
+		flagError = true
+	}
+	if len(*histSince) > 0 {
+		if _, err := parseDate(*histSince); err != nil {
+			log.Printf("invalid -history-since date: %s", err)
+			flagError = true
+		}
+	}
+	if len(*wait) > 0 && *id == "" && *zone == "" {
+		log.Printf("-wait requires -id or -zone")
+		flagError = true
+	}
+	if *raw && len(*wait) > 0 {
+		log.Printf("can not use -raw with -wait")
+		flagError = true
+	}
+	if *waitPoll <= 0 {
+		log.Printf("-wait-interval must be positive")
 		flagError = true
 	}
+	if *report == "-" && len(*diff) > 0 {
+		log.Printf("can not print -report to stdout with -diff")
+		flagError = true
+	}
+	if *inactive && (*id != "" || *zone != "" || len(*expiring) > 0) {
+		log.Printf("can not use -inactive with -id, -zone, or -expiring")
+		flagError = true
+	}
+	if len(*expiring) > 0 {
+		if _, err := parseDuration(*expiring); err != nil {
+			log.Printf("invalid -expiring duration: %s", err)
+			flagError = true
+		}
+	}
 	if flagError {
 		flag.PrintDefaults()
-		os.Exit(1)
+		os.Exit(cli.ExitUsage)
 	}
 }
 
 func main() {
 	checkFlags()
 
-	p := *password
-	if len(p) == 0 {
-		pass, err := czds.Getpass(*passin)
-		if err != nil {
-			log.Fatal("Unable to get password from user: ", err)
-		}
-		p = pass
+	// an interrupt stops the password prompt and any wait for a request's status
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	p, err := cli.Password(ctx, *password, *passin)
+	if err != nil {
+		log.Fatal("Unable to get password from user: ", err)
 	}
 
-	client = czds.NewClient(*username, p)
+	client = cli.NewClient(*username, p, *testEnv, *authURL, *baseURL)
+	tlsConf, err := cli.TLSConfig(*caCert, *insecure)
+	if err != nil {
+		log.Fatalf("unable to load TLS config: %s", err)
+	}
+	if tlsConf != nil || *debugHTTP {
+		httpOpts := &czds.HTTPClientOptions{
+			TLSConfig: tlsConf,
+		}
+		if *debugHTTP {
+			httpOpts.DebugLogger = log.Default()
+		}
+		client.HTTPClient = czds.NewHTTPClient(httpOpts)
+	}
+	if len(*userAgent) != 0 {
+		client.UserAgent = *userAgent
+	}
 	if *verbose {
 		client.SetLogger(log.Default())
+		cli.PrintConfig(client)
 	}
 
 	// validate credentials
 	v("Authenticating to %s", client.AuthURL)
-	err := client.Authenticate()
+	err = client.Authenticate()
 	if err != nil {
-		log.Fatal(err)
+		cli.Fatal(err)
+	}
+
+	if *whoami {
+		printWhoAmI()
+		return
 	}
 
 	if *zone != "" {
 		// get id from zone name
-		zoneID, err := client.GetZoneRequestID(*zone)
+		zoneID, err := client.GetZoneRequestIDWithContext(ctx, *zone)
 		if err != nil {
-			log.Fatal(err)
+			cli.Fatal(err)
 		}
 		id = &zoneID
 	}
 
 	// save CSV report
-	if len(*report) > 0 {
-		csvReport()
+	if len(*report) > 0 || len(*diff) > 0 {
+		var buf bytes.Buffer
+		err := client.DownloadAllRequests(&buf)
+		if err != nil {
+			cli.Fatal(err)
+		}
+		if len(*report) > 0 {
+			csvReport(buf.Bytes())
+		}
+		if len(*diff) > 0 {
+			diffReport(buf.Bytes())
+		}
+		return
+	}
+
+	// list expiring zones
+	if len(*expiring) > 0 {
+		listExpiring(ctx)
+		return
+	}
+
+	// list zones that access was lost to
+	if *inactive {
+		listInactive(ctx)
 		return
 	}
 
 	// list status of all zones
 	if *id == "" {
-		listAll()
+		listAll(ctx)
+		return
+	}
+
+	// print the raw JSON of a single zone request
+	if *raw {
+		printRawRequestInfo(*id)
 		return
 	}
 
 	// list details of a single zone request
-	info, err := client.GetRequestInfo(*id)
-	if err != nil {
-		log.Fatal(err)
+	var info *czds.RequestsInfo
+	if len(*wait) > 0 {
+		info = waitForStatus(ctx, *id)
+	} else {
+		info, err = client.GetRequestInfo(*id)
+		if err != nil {
+			cli.Fatal(err)
+		}
+	}
+	if *histLimit > 0 || len(*histSince) > 0 {
+		since, _ := parseDate(*histSince)
+		info.History = filterHistory(info.History, int(*histLimit), since)
+	}
+	if outFormat == cli.FormatJSON {
+		printJSON(info)
+		return
 	}
 	printRequestInfo(info)
 }
 
-func listAll() {
-	requests, err := client.GetAllRequests(czds.RequestAll)
+// waitForStatus waits until the request with requestID has the -wait status or ctx is done
+func waitForStatus(ctx context.Context, requestID string) *czds.RequestsInfo {
+	v("Waiting for request %s to be %s", requestID, *wait)
+	info, err := client.WaitForStatusWithContext(ctx, requestID, *wait, *waitPoll)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	return info
+}
+
+func listAll(ctx context.Context) {
+	requests, err := client.GetAllRequestsWithContext(ctx, czds.RequestAll)
 	if err != nil {
-		log.Fatal(err)
+		cli.Fatal(err)
 	}
 
 	v("Total requests: %d", len(requests))
-	if len(requests) > 0 {
-		printHeader()
-		for _, request := range requests {
-			printRequest(request)
-		}
+	printRequests(requests)
+}
+
+func listExpiring(ctx context.Context) {
+	within, _ := parseDuration(*expiring)
+	requests, err := client.GetExpiringRequestsWithContext(ctx, within)
+	if err != nil {
+		cli.Fatal(err)
+	}
+
+	v("Expiring requests: %d", len(requests))
+	printRequests(requests)
+}
+
+func listInactive(ctx context.Context) {
+	requests, err := client.GetInactiveRequestsWithContext(ctx)
+	if err != nil {
+		cli.Fatal(err)
 	}
+
+	v("Inactive requests: %d", len(requests))
+	printRequests(requests)
 }
 
-func csvReport() {
+func csvReport(data []byte) {
 	out := os.Stdout
 	if *report != "-" {
 		v("Saving to %s", *report)
 		dir := path.Dir(*report)
 		err := os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
-			log.Fatal(err)
+			cli.Fatal(err)
 		}
 		file, err := os.Create(*report)
 		if err != nil {
-			log.Fatal(err)
+			cli.Fatal(err)
 		}
 		defer file.Close()
 		out = file
@@ -140,8 +331,59 @@ func csvReport() {
 	}
 
 	// CSV report to out
-	err := client.DownloadAllRequests(out)
+	_, err := out.Write(data)
+	if err != nil {
+		cli.Fatal(err)
+	}
+}
+
+// diffReport prints the differences between the report saved at -diff and the current report data
+func diffReport(data []byte) {
+	v("Comparing with %s", *diff)
+	file, err := os.Open(*diff)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	defer file.Close()
+	oldRows, err := czds.ParseReport(file)
+	if err != nil {
+		log.Fatalf("unable to parse %q: %s", *diff, err)
+	}
+	newRows, err := czds.ParseReport(bytes.NewReader(data))
+	if err != nil {
+		log.Fatalf("unable to parse current report: %s", err)
+	}
+
+	reportDiff := czds.DiffReports(oldRows, newRows)
+	if outFormat == cli.FormatJSON {
+		printJSON(reportDiff)
+		return
+	}
+	for _, row := range reportDiff.Added {
+		fmt.Printf("added\t%s\t%s\n", row.TLD, row.Status)
+	}
+	for _, row := range reportDiff.Removed {
+		fmt.Printf("removed\t%s\t%s\n", row.TLD, row.Status)
+	}
+	for _, change := range reportDiff.Changed {
+		fmt.Printf("changed\t%s\t%s -> %s\n", change.TLD, change.OldStatus, change.NewStatus)
+	}
+}
+
+// printRawRequestInfo prints the indented JSON of the request as returned by the server
+func printRawRequestInfo(requestID string) {
+	data, err := client.GetRequestInfoRaw(requestID)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = json.Indent(&out, data, "", "  ")
+	if err != nil {
+		cli.Fatal(err)
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(os.Stdout)
 	if err != nil {
-		log.Fatal(err)
+		cli.Fatal(err)
 	}
 }
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/cli"
+	"github.com/lanrat/czds/internal/clitest"
+	"github.com/lanrat/czds/jwt"
+)
+
+func TestPrintRawRequestInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "pretty printed",
+			body: `{"requestId":"1","tld":{"tld":"xn--p1ai","ulable":""},"status":"Approved"}`,
+			want: "{\n  \"requestId\": \"1\",\n  \"tld\": {\n    \"tld\": \"xn--p1ai\",\n    \"ulable\": \"\"\n  },\n  \"status\": \"Approved\"\n}\n",
+		},
+		{
+			name: "unknown fields are kept",
+			body: `{"requestId":"2","newField":[1,2]}`,
+			want: "{\n  \"requestId\": \"2\",\n  \"newField\": [\n    1,\n    2\n  ]\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+				requested = r.URL.Path
+				w.Write([]byte(tt.body))
+			})
+			clitest.NewClient(t, mux, &client)
+			got := clitest.CaptureStdout(t, func() { printRawRequestInfo("abc-123") })
+			if got != tt.want {
+				t.Errorf("printRawRequestInfo() = %q, want %q", got, tt.want)
+			}
+			if requested != "/czds/requests/abc-123" {
+				t.Errorf("requested %q, want /czds/requests/abc-123", requested)
+			}
+		})
+	}
+}
+
+func TestPrintWhoAmI(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	header, err := json.Marshal(jwt.Header{Alg: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(jwt.Data{Exp: exp.Unix(), Sub: "00u1", Email: "user@example.com", GivenName: "Zone", FamilyName: "User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	token := enc.EncodeToString(header) + "." + enc.EncodeToString(data) + "." + enc.EncodeToString([]byte("sig"))
+
+	tests := []struct {
+		format cli.OutputFormat
+		want   string
+	}{
+		{cli.FormatText, "Username:\tuser\nEmail:\tuser@example.com\nName:\tZone User\nToken Expires:\t" + exp.Format(time.ANSIC) + "\n"},
+		{cli.FormatJSON, "{\n" +
+			"  \"username\": \"user\",\n" +
+			"  \"subject\": \"00u1\",\n" +
+			"  \"email\": \"user@example.com\",\n" +
+			"  \"givenName\": \"Zone\",\n" +
+			"  \"familyName\": \"User\",\n" +
+			"  \"expires\": \"" + exp.Format(time.RFC3339) + "\"\n" +
+			"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]string{"accessToken": token, "message": "ok"})
+			}))
+			defer ts.Close()
+			client = czds.NewClient("user", "pass")
+			client.AuthURL = ts.URL + "/api/authenticate"
+			defer func() { client = nil }()
+			format := outFormat
+			outFormat = tt.format
+			defer func() { outFormat = format }()
+
+			if got := clitest.CaptureStdout(t, printWhoAmI); got != tt.want {
+				t.Errorf("printWhoAmI() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintRequestsJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []czds.Request
+	}{
+		{"requests", `{"requests": [{"requestId": "1", "tld": "com", "status": "Approved"}], "totalRequests": 1}`, []czds.Request{{RequestID: "1", TLD: "com", Status: "Approved"}}},
+		{"no requests", `{"requests": [], "totalRequests": 0}`, []czds.Request{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.body))
+			})
+			clitest.NewClient(t, mux, &client)
+			resp, err := client.GetRequests(&czds.RequestsFilter{Status: czds.RequestAll})
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := outFormat
+			outFormat = cli.FormatJSON
+			defer func() { outFormat = format }()
+
+			out := clitest.CaptureStdout(t, func() { printRequests(resp.Requests) })
+			var got []czds.Request
+			err = json.Unmarshal([]byte(out), &got)
+			if err != nil {
+				t.Fatalf("printRequests() printed invalid JSON %q: %s", out, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("printRequests() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitForStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		wait      string
+		statuses  []string // status returned by each poll, the last is repeated
+		wantPolls int
+	}{
+		{"pending to approved", "approved", []string{czds.RequestPending, czds.RequestPending, czds.RequestApproved}, 3},
+		{"case insensitive", "APPROVED", []string{czds.RequestSubmitted, czds.RequestApproved}, 2},
+		{"already approved", "approved", []string{czds.RequestApproved}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldWait, oldPoll := *wait, *waitPoll
+			*wait, *waitPoll = tt.wait, time.Millisecond
+			defer func() { *wait, *waitPoll = oldWait, oldPoll }()
+			polls := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/abc-123", func(w http.ResponseWriter, r *http.Request) {
+				polls++
+				status := tt.statuses[min(polls, len(tt.statuses))-1]
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "abc-123", Status: status})
+			})
+			clitest.NewClient(t, mux, &client)
+
+			info := waitForStatus(context.Background(), "abc-123")
+			if info.Status != czds.RequestApproved {
+				t.Errorf("waitForStatus() status = %q, want %q", info.Status, czds.RequestApproved)
+			}
+			if polls != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", polls, tt.wantPolls)
+			}
+		})
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 12, 0, 0, 0, time.UTC) }
+	// the server does not return the history in order
+	history := []czds.HistoryEntry{
+		{Timestamp: day(1), Action: "Created"},
+		{Timestamp: day(3), Action: "Approved"},
+		{Timestamp: day(2), Action: "Reviewed"},
+		{Timestamp: day(10), Action: "Extended"},
+		{Timestamp: day(5), Action: "Comment"},
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string // actions printed, in order
+	}{
+		{"all", nil, []string{"Created", "Approved", "Reviewed", "Extended", "Comment"}},
+		{"limit", []string{"-history-limit", "2"}, []string{"Extended", "Comment"}},
+		{"limit over length", []string{"-history-limit", "10"}, []string{"Extended", "Comment", "Approved", "Reviewed", "Created"}},
+		{"since date", []string{"-history-since", "2024-06-03"}, []string{"Extended", "Comment", "Approved"}},
+		{"since time", []string{"-history-since", "2024-06-03T12:00:01Z"}, []string{"Extended", "Comment"}},
+		{"since and limit", []string{"-history-since", "2024-06-02", "-history-limit", "3"}, []string{"Extended", "Comment", "Approved"}},
+		{"since after all", []string{"-history-since", "2025-01-01"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/abc-123", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(czds.RequestsInfo{RequestID: "abc-123", Status: czds.RequestApproved, History: history})
+			})
+			url := clitest.NewClient(t, mux, &client)
+			args := append([]string{"-username", "user", "-password", "pass", "-authurl", url + "/api/authenticate",
+				"-baseurl", url, "-id", "abc-123", "-format", "json"}, tt.args...)
+			out := clitest.CaptureStdout(t, func() { clitest.RunMain(t, main, "czds-status", args...) })
+
+			var info czds.RequestsInfo
+			err := json.Unmarshal([]byte(out), &info)
+			if err != nil {
+				t.Fatalf("%s: %q", err, out)
+			}
+			got := make([]string, 0, len(info.History))
+			for _, event := range info.History {
+				got = append(got, event.Action)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("history %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRequestsCSV(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		// the ULabel of рф is left empty to be decoded from the TLD, a status with a comma and quotes must be quoted
+		w.Write([]byte(`{"requests": [
+			{"requestId": "1", "tld": "com", "ulable": "com", "status": "Approved", "created": "2024-06-01T12:00:00-07:00",
+				"last_updated": "2024-06-02T00:00:00Z", "expired": "2025-06-01T00:00:00Z", "sftp": true, "auto_renew": true},
+			{"requestId": "2", "tld": "xn--p1ai", "ulable": "", "status": "Pending", "created": "2024-06-03T08:30:00Z",
+				"expired": "1970-01-01T00:00:00Z"},
+			{"requestId": "3", "tld": "net", "ulable": "net", "status": "Denied, \"incomplete\"", "created": "2024-06-04T00:00:00Z",
+				"last_updated": "2024-06-05T00:00:00Z"}
+		], "totalRequests": 3}`))
+	})
+	url := clitest.NewClient(t, mux, &client)
+	got := clitest.CaptureStdout(t, func() {
+		clitest.RunMain(t, main, "czds-status", "-username", "user", "-password", "pass", "-authurl", url+"/api/authenticate", "-baseurl", url, "-format", "csv")
+	})
+	want, err := os.ReadFile(filepath.Join("testdata", "requests.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("-format csv output does not match testdata/requests.csv:\n%s", got)
+	}
+}
+
+func TestListRequestsWide(t *testing.T) {
+	created := "Sat Jun  1 12:00:00 2024"
+	updated := "Sun Jun  2 12:00:00 2024"
+	expires := "Sun Jun  1 12:00:00 2025"
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "default",
+			want: "TLD\tID\tUnicodeTLD\tStatus\tCreated\tUpdated\tExpires\tSFTP\n" +
+				"com\t1\tcom\tApproved\t" + created + "\t" + updated + "\t" + expires + "\ttrue\n" +
+				"net\t2\tnet\tApproved\t" + created + "\t" + updated + "\t" + expires + "\tfalse\n",
+		},
+		{
+			name: "wide",
+			args: []string{"-wide"},
+			want: "TLD\tID\tUnicodeTLD\tStatus\tCreated\tUpdated\tExpires\tSFTP\tAutoRenew\n" +
+				"com\t1\tcom\tApproved\t" + created + "\t" + updated + "\t" + expires + "\ttrue\ttrue\n" +
+				"net\t2\tnet\tApproved\t" + created + "\t" + updated + "\t" + expires + "\tfalse\tfalse\n",
+		},
+		{
+			name: "autorenew column",
+			args: []string{"-columns", "tld,autorenew"},
+			want: "TLD\tAutoRenew\ncom\ttrue\nnet\tfalse\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"requests": [
+					{"requestId": "1", "tld": "com", "ulable": "com", "status": "Approved", "created": "2024-06-01T12:00:00Z",
+						"last_updated": "2024-06-02T12:00:00Z", "expired": "2025-06-01T12:00:00Z", "sftp": true, "auto_renew": true},
+					{"requestId": "2", "tld": "net", "ulable": "net", "status": "Approved", "created": "2024-06-01T12:00:00Z",
+						"last_updated": "2024-06-02T12:00:00Z", "expired": "2025-06-01T12:00:00Z", "sftp": false, "auto_renew": false}
+				], "totalRequests": 2}`))
+			})
+			url := clitest.NewClient(t, mux, &client)
+			args := append([]string{"-username", "user", "-password", "pass", "-authurl", url + "/api/authenticate", "-baseurl", url}, tt.args...)
+			got := clitest.CaptureStdout(t, func() { clitest.RunMain(t, main, "czds-status", args...) })
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv("CZDS_TEST_MAIN_ARGS"); ok {
+		os.Args = append([]string{"czds-status"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		want     string
+		wantExit int
+		wantErr  string // logged when the flags are rejected
+	}{
+		{"custom order", "-columns status,tld,expires", "Status\tTLD\tExpires\nApproved\tcom\tSun Jun  1 12:00:00 2025\nPending\tnet\t\n", 0, ""},
+		{"single column", "-columns id", "ID\n1\n2\n", 0, ""},
+		{"case insensitive", "-columns TLD,AutoRenew", "TLD\tAutoRenew\ncom\ttrue\nnet\tfalse\n", 0, ""},
+		{"repeated column", "-columns tld,status,tld", "TLD\tStatus\tTLD\ncom\tApproved\tcom\nnet\tPending\tnet\n", 0, ""},
+		{"unknown column", "-columns tld,owner", "", cli.ExitUsage, `unknown column "owner"`},
+		{"empty column", "-columns tld,,status", "", cli.ExitUsage, `unknown column ""`},
+		{"with wide", "-columns tld -wide", "", cli.ExitUsage, "'-columns' and '-wide' cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"requests": [
+					{"requestId": "1", "tld": "com", "ulable": "com", "status": "Approved", "expired": "2025-06-01T12:00:00Z", "auto_renew": true},
+					{"requestId": "2", "tld": "net", "ulable": "net", "status": "Pending"}
+				], "totalRequests": 2}`))
+			})
+			url := clitest.NewClient(t, mux, &client)
+
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), "HOME="+t.TempDir(), "CZDS_USERNAME=", "CZDS_PASSWORD=", "CZDS_PASSIN=",
+				"CZDS_TEST_MAIN_ARGS=-username user -password pass -authurl "+url+"/api/authenticate -baseurl "+url+" "+tt.args)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			exit := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exit = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if exit != tt.wantExit {
+				t.Fatalf("exit status %d, want %d, output:\n%s", exit, tt.wantExit, stderr.String())
+			}
+			if string(out) != tt.want {
+				t.Errorf("output = %q, want %q", out, tt.want)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("output does not contain %q:\n%s", tt.wantErr, stderr.String())
+			}
+		})
+	}
+}
+
+func TestListInactive(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		var filter czds.RequestsFilter
+		json.NewDecoder(r.Body).Decode(&filter)
+		resp := czds.RequestsResponse{TotalRequests: 5}
+		if filter.Pagination.Page == 0 {
+			w.Write([]byte(`{"requests": [
+				{"requestId": "1", "tld": "com", "status": "Approved", "created": "2024-06-05T00:00:00Z"},
+				{"requestId": "2", "tld": "net", "status": "Expired", "created": "2024-06-04T00:00:00Z"},
+				{"requestId": "3", "tld": "org", "status": "Revoked", "created": "2024-06-03T00:00:00Z"},
+				{"requestId": "4", "tld": "com", "status": "Denied", "created": "2024-06-02T00:00:00Z"},
+				{"requestId": "5", "tld": "xyz", "status": "Pending", "created": "2024-06-01T00:00:00Z"}
+			], "totalRequests": 5}`))
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	url := clitest.NewClient(t, mux, &client)
+	got := clitest.CaptureStdout(t, func() {
+		clitest.RunMain(t, main, "czds-status", "-username", "user", "-password", "pass", "-authurl", url+"/api/authenticate", "-baseurl", url,
+			"-inactive", "-columns", "tld,id,status")
+	})
+	// the denied com request is not listed as com was approved since
+	want := "TLD\tID\tStatus\nnet\t2\tExpired\norg\t3\tRevoked\n"
+	if got != want {
+		t.Errorf("-inactive output = %q, want %q", got, want)
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/lanrat/czds"
 )
 
 func v(format string, v ...interface{}) {
@@ -17,3 +23,50 @@ func expiredTime(t time.Time) string {
 	}
 	return ""
 }
+
+// flatten replaces newlines in s with spaces so that it prints on a single line
+func flatten(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// parseDate parses s as either a date such as "2024-06-01" or an RFC3339 time, an empty s is the zero time
+func parseDate(s string) (time.Time, error) {
+	if len(s) == 0 {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// filterHistory returns the events in history on or after since, sorted newest first and limited to the limit most recent
+// a limit of 0 and a zero since do not filter
+func filterHistory(history []czds.HistoryEntry, limit int, since time.Time) []czds.HistoryEntry {
+	filtered := make([]czds.HistoryEntry, 0, len(history))
+	for _, event := range history {
+		if !event.Timestamp.Before(since) {
+			filtered = append(filtered, event)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return filtered[i].Timestamp.After(filtered[j].Timestamp)
+	})
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+	return filtered
+}
+
+// parseDuration is like time.ParseDuration but also accepts a whole number of days such as "30d"
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,52 @@
+package czds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultConfigFile is the name of the config file in the user's home directory used by LoadConfig
+const DefaultConfigFile = ".czds.json"
+
+// Config holds the credentials stored in a JSON config file
+type Config struct {
+	Username string `json:"username"`
+	Passin   string `json:"passin"` // password source for Getpass, ex: keychain:czds or file:~/.czds.pass
+}
+
+// LoadConfig reads the JSON config file at path, a leading "~/" is expanded to the user's home directory
+// if path is empty DefaultConfigFile in the user's home directory is read, and an empty Config is returned if it does not exist
+func LoadConfig(path string) (*Config, error) {
+	optional := len(path) == 0
+	if optional {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return &Config{}, nil
+		}
+		path = filepath.Join(home, DefaultConfigFile)
+	} else if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path[2:])
+	}
+
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config %q: %w", path, err)
+	}
+	return config, nil
+}
@@ -3,10 +3,15 @@ package czds
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +31,12 @@ const (
 	TestBaseURL = "https://czds-api-test.icann.org"
 )
 
+// DefaultRetryDelay is the base time to wait before retrying a failed request when Client.RetryDelay is not set
+const DefaultRetryDelay = 10 * time.Second
+
+// AllRequestsPageSize is the number of requests in each page fetched by GetAllRequestsFromPage
+const AllRequestsPageSize = 100
+
 var (
 	defaultHTTPClient = &http.Client{}
 )
@@ -41,6 +52,42 @@ type Client struct {
 	Creds      Credentials
 	authMutex  sync.Mutex
 	log        Logger
+	slog       *slog.Logger
+	Metrics    Metrics // optional, receives observations about requests and downloads
+
+	// UserAgent is sent as the User-Agent header of every request, defaults to DefaultUserAgent()
+	UserAgent string
+
+	// RetryDelay is the base time to wait before retrying a failed request, defaults to DefaultRetryDelay
+	// each wait is randomized by ±50% so that parallel requests do not all retry at once
+	RetryDelay time.Duration
+
+	// CircuitBreakerThreshold is the number of consecutive failed requests, either network errors or 5xx responses,
+	// after which all requests fail fast with ErrCircuitOpen for CircuitBreakerCooldown, 0 disables the circuit breaker
+	CircuitBreakerThreshold int
+	// CircuitBreakerCooldown is how long requests fail fast once the circuit breaker opens, defaults to DefaultCircuitBreakerCooldown
+	CircuitBreakerCooldown time.Duration
+	breaker                circuitBreaker
+
+	// TLDStatusCacheTTL is how long GetTLDStatus results are reused, 0 disables caching
+	TLDStatusCacheTTL time.Duration
+	tldStatus         []TLDStatus
+	tldStatusTime     time.Time
+	tldStatusMutex    sync.Mutex
+
+	// TermsCacheTTL is how long GetTerms results are reused, 0 disables caching
+	TermsCacheTTL time.Duration
+	terms         *Terms
+	termsTime     time.Time
+	termsMutex    sync.Mutex
+
+	// LinksCacheTTL is how long GetLinks results are reused, 0 disables caching
+	// the cache is also invalidated when the auth token changes
+	LinksCacheTTL time.Duration
+	links         []string
+	linksTime     time.Time
+	linksToken    string
+	linksMutex    sync.Mutex
 }
 
 // Credentials used by the czds.Client
@@ -54,6 +101,39 @@ type authResponse struct {
 	Message     string `json:"message"`
 }
 
+// redacted replaces secrets when printing
+const redacted = "[redacted]"
+
+// String returns the Credentials with the password redacted
+func (c Credentials) String() string {
+	return fmt.Sprintf("{Username:%s Password:%s}", c.Username, redacted)
+}
+
+// GoString returns the Credentials with the password redacted
+func (c Credentials) GoString() string {
+	return fmt.Sprintf("czds.Credentials{Username:%q, Password:%q}", c.Username, redacted)
+}
+
+// String returns the authResponse with the token redacted
+func (ar authResponse) String() string {
+	return fmt.Sprintf("{AccessToken:%s Message:%s}", redacted, ar.Message)
+}
+
+// GoString returns the authResponse with the token redacted
+func (ar authResponse) GoString() string {
+	return fmt.Sprintf("czds.authResponse{AccessToken:%q, Message:%q}", redacted, ar.Message)
+}
+
+// String returns a description of the Client without any credentials or tokens
+func (c *Client) String() string {
+	return fmt.Sprintf("{AuthURL:%s BaseURL:%s Creds:%s}", c.AuthURL, c.BaseURL, c.Creds)
+}
+
+// GoString returns a description of the Client without any credentials or tokens
+func (c *Client) GoString() string {
+	return fmt.Sprintf("&czds.Client{AuthURL:%q, BaseURL:%q, Creds:%#v}", c.AuthURL, c.BaseURL, c.Creds)
+}
+
 type errorResponse struct {
 	Message    string `json:"message"`
 	HTTPStatus int    `json:"httpStatus"`
@@ -72,6 +152,14 @@ func NewClient(username, password string) *Client {
 	return client
 }
 
+// NewTestClient returns a new instance of the CZDS Client with the test environment URLs
+func NewTestClient(username, password string) *Client {
+	client := NewClient(username, password)
+	client.AuthURL = TestAuthURL
+	client.BaseURL = TestBaseURL
+	return client
+}
+
 // this function does NOT make network requests if the auth is valid
 func (c *Client) checkAuth() error {
 	// used a mutex to prevent multiple threads from authenticating at the same time
@@ -80,16 +168,130 @@ func (c *Client) checkAuth() error {
 	if c.auth.AccessToken == "" {
 		// no token yet
 		c.v("no auth token")
-		return c.Authenticate()
+		return c.authenticate()
 	}
 	if time.Now().After(c.authExp) {
 		// token expired, renew
 		c.v("auth token expired")
-		return c.Authenticate()
+		return c.authenticate()
 	}
 	return nil
 }
 
+// accessToken returns the current authentication token
+// the token is only accessed while holding authMutex so requests are safe to make while another goroutine authenticates
+func (c *Client) accessToken() string {
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+	return c.auth.AccessToken
+}
+
+// reauthenticate forces a new authentication after the server rejected the token
+// nothing is done if another request has already replaced the rejected token
+func (c *Client) reauthenticate(rejected string) error {
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+	if c.auth.AccessToken != rejected {
+		return nil
+	}
+	c.v("auth token rejected")
+	return c.authenticate()
+}
+
+// EnsureAuthenticated authenticates the client only if it does not already hold a valid token.
+// Callers starting many goroutines at once should call this first so that a single
+// authentication is performed up front instead of every worker blocking on the first one.
+func (c *Client) EnsureAuthenticated() error {
+	return c.checkAuth()
+}
+
+// Identity is the account a Client is authenticated as, from the claims of its authentication token
+// it is the json output of czds-status -whoami
+type Identity struct {
+	Username   string    `json:"username"`
+	Subject    string    `json:"subject"`
+	Email      string    `json:"email"`
+	GivenName  string    `json:"givenName"`
+	FamilyName string    `json:"familyName"`
+	Expires    time.Time `json:"expires"` // when the authentication token expires
+}
+
+// WhoAmI authenticates if needed and returns the account the authentication token was issued to
+func (c *Client) WhoAmI() (*Identity, error) {
+	err := c.EnsureAuthenticated()
+	if err != nil {
+		return nil, err
+	}
+	c.authMutex.Lock()
+	accessToken, exp := c.auth.AccessToken, c.authExp
+	c.authMutex.Unlock()
+	token, err := jwt.DecodeJWT(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode authentication token: %w", err)
+	}
+	return &Identity{
+		Username:   c.Creds.Username,
+		Subject:    token.Data.Sub,
+		Email:      token.Data.Email,
+		GivenName:  token.Data.GivenName,
+		FamilyName: token.Data.FamilyName,
+		Expires:    exp,
+	}, nil
+}
+
+// HTTPClientOptions configures the http.Client returned by NewHTTPClient
+type HTTPClientOptions struct {
+	MaxConns    int         // max connections per host, also used for the idle connection pool, 0 uses the http.DefaultTransport limits
+	TLSConfig   *tls.Config // optional TLS settings such as MinVersion, RootCAs, or client Certificates
+	DebugLogger Logger      // optional, logs every HTTP request and response with the Authorization header redacted
+}
+
+// NewHTTPClient returns a new http.Client suitable for Client.HTTPClient configured with opts, opts may be nil
+// set MaxConns to the number of parallel downloads so each download can reuse its own connection,
+// the default transport only keeps 2 idle connections per host
+func NewHTTPClient(opts *HTTPClientOptions) *http.Client {
+	if opts == nil {
+		opts = &HTTPClientOptions{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.MaxConns > 0 {
+		transport.MaxIdleConns = opts.MaxConns
+		transport.MaxIdleConnsPerHost = opts.MaxConns
+		// leave room for authentication and API requests alongside the downloads
+		transport.MaxConnsPerHost = opts.MaxConns + 1
+	}
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig.Clone()
+	}
+	var roundTripper http.RoundTripper = transport
+	if opts.DebugLogger != nil {
+		roundTripper = &debugTransport{
+			next:   transport,
+			logger: opts.DebugLogger,
+		}
+	}
+	return &http.Client{
+		Transport: roundTripper,
+	}
+}
+
+// LoadCertPool returns the system certificate pool with the PEM encoded certificates in caFile added
+// for use as the RootCAs of HTTPClientOptions.TLSConfig
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %q", caFile)
+	}
+	return pool, nil
+}
+
 func (c *Client) httpClient() *http.Client {
 	if c.HTTPClient != nil {
 		return c.HTTPClient
@@ -97,10 +299,31 @@ func (c *Client) httpClient() *http.Client {
 	return defaultHTTPClient
 }
 
+// userAgent returns the User-Agent header to send with requests
+func (c *Client) userAgent() string {
+	if len(c.UserAgent) > 0 {
+		return c.UserAgent
+	}
+	return DefaultUserAgent()
+}
+
+// retryDelay returns the base time to wait before retrying a failed request
+func (c *Client) retryDelay() time.Duration {
+	if c.RetryDelay > 0 {
+		return c.RetryDelay
+	}
+	return DefaultRetryDelay
+}
+
 // apiRequest makes a request to the client's API endpoint
-// TODO add optional context to requests
 func (c *Client) apiRequest(auth bool, method, url string, request io.Reader) (*http.Response, error) {
-	c.v("HTTP API Request: %s %q", method, url)
+	return c.apiRequestWithHeader(context.Background(), auth, method, url, request, nil)
+}
+
+// apiRequestWithHeader is the same as apiRequest but adds header to the request
+// and stops retrying once ctx is done
+func (c *Client) apiRequestWithHeader(ctx context.Context, auth bool, method, url string, request io.Reader, header http.Header) (*http.Response, error) {
+	c.vAttrs("HTTP API Request", slog.String("method", method), slog.String("url", url))
 	if auth {
 		err := c.checkAuth()
 		if err != nil {
@@ -108,32 +331,97 @@ func (c *Client) apiRequest(auth bool, method, url string, request io.Reader) (*
 		}
 	}
 
+	// buffer the body so that it can be resent on each attempt
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = io.ReadAll(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	totalTrys := 3
+	reauthenticated := false
 	var err error
 	var req *http.Request
 	var resp *http.Response
 	for try := 1; try <= totalTrys; try++ {
-		req, err = http.NewRequest(method, url, request)
+		var bodyReader io.Reader
+		if request != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		if !c.breaker.allow(c.CircuitBreakerThreshold) {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, url)
+		}
+		req, err = http.NewRequestWithContext(ctx, method, url, bodyReader)
 		if err != nil {
+			c.breaker.canceled()
 			return nil, err
 		}
 		if request != nil {
 			req.Header.Set("Content-Type", "application/json")
 		}
 		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.auth.AccessToken))
+		req.Header.Set("User-Agent", c.userAgent())
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		var token string
+		if auth {
+			token = c.accessToken()
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
 
+		start := time.Now()
 		resp, err = c.httpClient().Do(req)
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		c.metrics().ObserveRequest(method, req.URL.Path, status, time.Since(start))
+		switch {
+		case err != nil && ctx.Err() != nil:
+			c.breaker.canceled()
+		case err != nil || status >= http.StatusInternalServerError:
+			if c.breaker.failure(c.CircuitBreakerThreshold, c.circuitBreakerCooldown()) {
+				c.vAttrs("HTTP API circuit breaker open", slog.String("url", url),
+					slog.Duration("cooldown", c.circuitBreakerCooldown()))
+			}
+		default:
+			c.breaker.success()
+		}
 		if err != nil {
-			err = fmt.Errorf("error on request [%d/%d] %s, got error %w: %+v", try, totalTrys, url, err, resp)
-			c.v("HTTP API Request error: %s", err)
+			// never include the request or response in the error, they contain the Authorization header
+			err = fmt.Errorf("error on request [%d/%d] %s, got error %w", try, totalTrys, url, err)
+			c.vAttrs("HTTP API Request error", slog.String("method", method), slog.String("url", url),
+				slog.Int("attempt", try), slog.Any("error", err))
+		} else if auth && !reauthenticated && (status == http.StatusUnauthorized || status == http.StatusForbidden) {
+			// the token may have been invalidated before its expiration, authenticate again and retry once
+			resp.Body.Close()
+			c.vAttrs("HTTP API Request unauthorized, reauthenticating", slog.String("method", method), slog.String("url", url),
+				slog.Int("attempt", try), slog.Int("status", status))
+			reauthenticated = true
+			err = c.reauthenticate(token)
+			if err != nil {
+				return nil, err
+			}
+			// the forced retry does not count as a failed attempt
+			try--
+			continue
 		} else {
+			c.vAttrs("HTTP API Response", slog.String("method", method), slog.String("url", url),
+				slog.Int("attempt", try), slog.Int("status", status))
 			return resp, nil
 		}
 
 		// sleep only if we will try again
 		if try < totalTrys {
-			time.Sleep(time.Second * 10)
+			select {
+			case <-time.After(Jitter(c.retryDelay())):
+			case <-ctx.Done():
+				return nil, err
+			}
 		}
 	}
 
@@ -142,11 +430,21 @@ func (c *Client) apiRequest(auth bool, method, url string, request io.Reader) (*
 
 // jsonAPI performs an authenticated json API request
 func (c *Client) jsonAPI(method, path string, request, response interface{}) error {
-	return c.jsonRequest(true, method, c.BaseURL+path, request, response)
+	return c.jsonAPIWithContext(context.Background(), method, path, request, response)
+}
+
+// jsonAPIWithContext is the same as jsonAPI but the request is aborted when ctx is done
+func (c *Client) jsonAPIWithContext(ctx context.Context, method, path string, request, response interface{}) error {
+	return c.jsonRequestWithContext(ctx, true, method, c.BaseURL+path, request, response)
 }
 
 // jsonRequest performs a request to the API endpoint sending and receiving JSON objects
 func (c *Client) jsonRequest(auth bool, method, url string, request, response interface{}) error {
+	return c.jsonRequestWithContext(context.Background(), auth, method, url, request, response)
+}
+
+// jsonRequestWithContext is the same as jsonRequest but the request is aborted when ctx is done
+func (c *Client) jsonRequestWithContext(ctx context.Context, auth bool, method, url string, request, response interface{}) error {
 	var payloadReader io.Reader
 	if request != nil {
 		jsonPayload, err := json.Marshal(request)
@@ -156,22 +454,31 @@ func (c *Client) jsonRequest(auth bool, method, url string, request, response in
 		payloadReader = bytes.NewReader(jsonPayload)
 	}
 
-	resp, err := c.apiRequest(auth, method, url, payloadReader)
+	resp, err := c.apiRequestWithHeader(ctx, auth, method, url, payloadReader, nil)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return newRateLimitError(url, resp)
+	}
+
 	// got an error, decode it
 	if resp.StatusCode != http.StatusOK {
 		var errorResp errorResponse
-		err := fmt.Errorf("error on request %q: got Status %s %s", url, resp.Status, http.StatusText(resp.StatusCode))
+		err := &APIError{
+			URL:        url,
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+		}
 		if resp.ContentLength != 0 {
 			jsonError := json.NewDecoder(resp.Body).Decode(&errorResp)
 			if jsonError != nil {
-				return fmt.Errorf("error decoding json %w on errored request: %s", jsonError, err.Error())
+				return fmt.Errorf("error decoding json %w on errored request: %w", jsonError, err)
 			}
-			err = fmt.Errorf("%w HTTP Status: %d Message: %q", err, errorResp.HTTPStatus, errorResp.Message)
+			err.HTTPStatus = errorResp.HTTPStatus
+			err.Message = errorResp.Message
 		}
 		return err
 	}
@@ -189,20 +496,27 @@ func (c *Client) jsonRequest(auth bool, method, url string, request, response in
 // Authenticate tests the client's credentials and gets an authentication token from the server
 // calling this is optional. All other functions will check the auth state on their own first and authenticate if necessary.
 func (c *Client) Authenticate() error {
+	c.authMutex.Lock()
+	defer c.authMutex.Unlock()
+	return c.authenticate()
+}
+
+// authenticate gets a new authentication token, must hold authMutex
+func (c *Client) authenticate() error {
 	c.v("authenticating")
 	authResp := authResponse{}
 	err := c.jsonRequest(false, "POST", c.AuthURL, c.Creds, &authResp)
 	if err != nil {
-		return err
+		return &AuthError{Err: err}
 	}
 	c.auth = authResp
 	c.authExp, err = authResp.getExpiration()
 	if err != nil {
-		return err
+		return &AuthError{Err: err}
 	}
 
 	if !c.authExp.After(time.Now()) {
-		return fmt.Errorf("unable to authenticate")
+		return &AuthError{Err: fmt.Errorf("token expired at %s", c.authExp.Format(time.ANSIC))}
 	}
 
 	return nil
@@ -217,8 +531,13 @@ func (ar *authResponse) getExpiration() (time.Time, error) {
 
 // GetZoneRequestID returns the most request RequestID for the given zone
 func (c *Client) GetZoneRequestID(zone string) (string, error) {
+	return c.GetZoneRequestIDWithContext(context.Background(), zone)
+}
+
+// GetZoneRequestIDWithContext is the same as GetZoneRequestID but the requests are aborted when ctx is done
+func (c *Client) GetZoneRequestIDWithContext(ctx context.Context, zone string) (string, error) {
 	c.v("GetZoneRequestID: %q", zone)
-	zone = strings.ToLower(zone)
+	zone = toASCIIOrSame(strings.ToLower(zone))
 
 	// given a RequestsResponse, return the request for the provided zone if found, otherwise nil
 	findFirstZoneInRequests := func(zone string, r *RequestsResponse) *Request {
@@ -244,7 +563,7 @@ func (c *Client) GetZoneRequestID(zone string) (string, error) {
 	}
 
 	// get all requests matching filter
-	requests, err := c.GetRequests(&filter)
+	requests, err := c.GetRequestsWithContext(ctx, &filter)
 	if err != nil {
 		return "", err
 	}
@@ -254,7 +573,7 @@ func (c *Client) GetZoneRequestID(zone string) (string, error) {
 	for request == nil && len(requests.Requests) != 0 {
 		filter.Pagination.Page++
 		c.v("GetZoneRequestID: zone %q not found yet, requesting page %d", zone, filter.Pagination.Page)
-		requests, err = c.GetRequests(&filter)
+		requests, err = c.GetRequestsWithContext(ctx, &filter)
 		if err != nil {
 			return "", err
 		}
@@ -267,18 +586,66 @@ func (c *Client) GetZoneRequestID(zone string) (string, error) {
 	return request.RequestID, nil
 }
 
+// GetZoneRequestIDs returns the RequestIDs of all requests for the given zone, newest first
+func (c *Client) GetZoneRequestIDs(zone string) ([]string, error) {
+	return c.GetZoneRequestIDsWithContext(context.Background(), zone)
+}
+
+// GetZoneRequestIDsWithContext is the same as GetZoneRequestIDs but the requests are aborted when ctx is done
+func (c *Client) GetZoneRequestIDsWithContext(ctx context.Context, zone string) ([]string, error) {
+	c.v("GetZoneRequestIDs: %q", zone)
+	filter := RequestsFilter{
+		Status: RequestAll,
+		Filter: toASCIIOrSame(strings.ToLower(zone)),
+		Pagination: RequestsPagination{
+			Size: 100,
+			Page: 0,
+		},
+		Sort: RequestsSort{
+			Field:     SortByCreated,
+			Direction: SortDesc,
+		},
+	}
+	requests, err := c.GetRequestsExactWithContext(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(requests))
+	for _, request := range requests {
+		ids = append(ids, request.RequestID)
+	}
+	return ids, nil
+}
+
 // GetAllRequests returns the request information for all requests with the given status
 // status should be one of the constant czds.Status* strings
 // warning: for large number of results, may be slow
 func (c *Client) GetAllRequests(status string) ([]Request, error) {
+	return c.GetAllRequestsWithContext(context.Background(), status)
+}
+
+// GetAllRequestsWithContext is the same as GetAllRequests but the requests are aborted when ctx is done
+func (c *Client) GetAllRequestsWithContext(ctx context.Context, status string) ([]Request, error) {
+	out, _, err := c.GetAllRequestsFromPageWithContext(ctx, status, 0)
+	return out, err
+}
+
+// GetAllRequestsFromPage is the same as GetAllRequests but starts from startPage of AllRequestsPageSize requests
+// it returns the requests fetched and the page to resume from, which is the page that failed if an error is returned.
+// This allows callers enumerating a large number of requests to checkpoint their progress and resume after an interruption.
+func (c *Client) GetAllRequestsFromPage(status string, startPage int) ([]Request, int, error) {
+	return c.GetAllRequestsFromPageWithContext(context.Background(), status, startPage)
+}
+
+// GetAllRequestsFromPageWithContext is the same as GetAllRequestsFromPage but the requests are aborted when ctx is done
+func (c *Client) GetAllRequestsFromPageWithContext(ctx context.Context, status string, startPage int) ([]Request, int, error) {
 	c.v("GetAllRequests status: %q", status)
-	const pageSize = 100
 	filter := RequestsFilter{
 		Status: status,
 		Filter: "",
 		Pagination: RequestsPagination{
-			Size: pageSize,
-			Page: 0,
+			Size: AllRequestsPageSize,
+			Page: startPage,
 		},
 		Sort: RequestsSort{
 			Field:     SortByCreated,
@@ -287,21 +654,27 @@ func (c *Client) GetAllRequests(status string) ([]Request, error) {
 	}
 
 	out := make([]Request, 0, 100)
-	c.v("GetAllRequests status: %q, page %d", status, filter.Pagination.Page)
-	requests, err := c.GetRequests(&filter)
-	if err != nil {
-		return out, err
-	}
-
-	for len(requests.Requests) != 0 {
+	for {
 		c.v("GetAllRequests status: %q, page %d", status, filter.Pagination.Page)
+		requests, err := c.GetRequestsWithContext(ctx, &filter)
+		if err != nil {
+			return out, filter.Pagination.Page, err
+		}
 		out = append(out, requests.Requests...)
 		filter.Pagination.Page++
-		requests, err = c.GetRequests(&filter)
-		if err != nil {
-			return out, err
+		fetched := int64(startPage*AllRequestsPageSize + len(out))
+		if requests.TotalRequests > 0 {
+			c.v("GetAllRequests status: %q, fetched %d/%d", status, fetched, requests.TotalRequests)
+		}
+		// a short page is the last page, otherwise stop once TotalRequests have been fetched
+		// TotalRequests may be missing or change while paging, so it is never trusted to continue
+		if len(requests.Requests) < AllRequestsPageSize {
+			break
+		}
+		if requests.TotalRequests > 0 && fetched >= requests.TotalRequests {
+			break
 		}
 	}
 
-	return out, nil
+	return out, filter.Pagination.Page, nil
 }
@@ -0,0 +1,764 @@
+package czds
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds/jwt"
+)
+
+// testJWT returns an unsigned JWT with claims, exp defaults to an hour from now
+func testJWT(claims jwt.Data) string {
+	if claims.Exp == 0 {
+		claims.Exp = time.Now().Add(time.Hour).Unix()
+	}
+	header, _ := json.Marshal(jwt.Header{Kid: "test", Alg: "none"})
+	data, _ := json.Marshal(claims)
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(data) + "." + enc.EncodeToString([]byte("sig"))
+}
+
+// testServer is a fake CZDS server, authentication is served at /api/authenticate and all other paths by mux
+type testServer struct {
+	*httptest.Server
+	auths      atomic.Int32 // number of authentication requests
+	claims     jwt.Data     // claims of the tokens issued
+	authStatus int          // if set, authentication fails with this status code
+}
+
+// newTestServer starts a testServer and returns a Client for it
+func newTestServer(t *testing.T, mux *http.ServeMux) (*testServer, *Client) {
+	t.Helper()
+	ts := &testServer{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/authenticate" {
+			n := ts.auths.Add(1)
+			if ts.authStatus != 0 {
+				http.Error(w, "authentication failed", ts.authStatus)
+				return
+			}
+			// the jti is the number of the authentication so that every token is unique
+			claims := ts.claims
+			claims.Jti = strconv.Itoa(int(n))
+			json.NewEncoder(w).Encode(authResponse{AccessToken: testJWT(claims), Message: "ok"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	c := NewClient("user", "pass")
+	c.AuthURL = ts.URL + "/api/authenticate"
+	c.BaseURL = ts.URL
+	c.RetryDelay = time.Millisecond
+	return ts, c
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name   string
+		claims jwt.Data
+		want   Identity
+	}{
+		{
+			name:   "all claims",
+			claims: jwt.Data{Sub: "00u1", Email: "user@example.com", GivenName: "Given", FamilyName: "Family", Exp: exp.Unix()},
+			want:   Identity{Username: "user", Subject: "00u1", Email: "user@example.com", GivenName: "Given", FamilyName: "Family", Expires: exp},
+		},
+		{
+			name:   "no profile claims",
+			claims: jwt.Data{Exp: exp.Unix()},
+			want:   Identity{Username: "user", Expires: exp},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, c := newTestServer(t, http.NewServeMux())
+			ts.claims = tt.claims
+			got, err := c.WhoAmI()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Expires.Equal(tt.want.Expires) {
+				t.Errorf("Expires = %s, want %s", got.Expires, tt.want.Expires)
+			}
+			got.Expires = tt.want.Expires
+			if *got != tt.want {
+				t.Errorf("WhoAmI() = %+v, want %+v", *got, tt.want)
+			}
+			// a second call reuses the token
+			_, err = c.WhoAmI()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := ts.auths.Load(); n != 1 {
+				t.Errorf("authenticated %d times, want 1", n)
+			}
+		})
+	}
+}
+
+func TestEnsureAuthenticated(t *testing.T) {
+	tests := []struct {
+		name      string
+		callers   int  // concurrent calls to EnsureAuthenticated
+		expire    bool // expire the token before calling again
+		wantAuths int32
+	}{
+		{"single call", 1, false, 1},
+		{"concurrent calls authenticate once", 16, false, 1},
+		{"expired token is renewed", 1, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, c := newTestServer(t, http.NewServeMux())
+			var wg sync.WaitGroup
+			errs := make(chan error, tt.callers)
+			for i := 0; i < tt.callers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- c.EnsureAuthenticated()
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.expire {
+				c.authMutex.Lock()
+				c.authExp = time.Now().Add(-time.Second)
+				c.authMutex.Unlock()
+			}
+			// a second call only authenticates if the token expired
+			err := c.EnsureAuthenticated()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := ts.auths.Load(); n != tt.wantAuths {
+				t.Errorf("authenticated %d times, want %d", n, tt.wantAuths)
+			}
+		})
+	}
+}
+
+func TestEnsureAuthenticatedError(t *testing.T) {
+	ts, c := newTestServer(t, http.NewServeMux())
+	ts.authStatus = http.StatusUnauthorized
+	err := c.EnsureAuthenticated()
+	var authErr *AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("EnsureAuthenticated() error = %v, want an AuthError", err)
+	}
+}
+
+func TestNewClientEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *Client
+		authURL     string
+		baseURL     string
+		credentials Credentials
+	}{
+		{"production", NewClient("user", "pass"), AuthURL, BaseURL, Credentials{Username: "user", Password: "pass"}},
+		{"test", NewTestClient("user", "pass"), TestAuthURL, TestBaseURL, Credentials{Username: "user", Password: "pass"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.client.AuthURL != tt.authURL {
+				t.Errorf("AuthURL = %q, want %q", tt.client.AuthURL, tt.authURL)
+			}
+			if tt.client.BaseURL != tt.baseURL {
+				t.Errorf("BaseURL = %q, want %q", tt.client.BaseURL, tt.baseURL)
+			}
+			if tt.client.Creds != tt.credentials {
+				t.Error("credentials were not set")
+			}
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	tests := []struct {
+		name      string
+		statuses  []int // status of each request, 200 once they run out
+		wantCalls int32
+		wantAuths int32
+		wantError bool
+	}{
+		{"authorized", nil, 1, 1, false},
+		{"401 then 200", []int{http.StatusUnauthorized}, 2, 2, false},
+		{"403 then 200", []int{http.StatusForbidden}, 2, 2, false},
+		{"only one forced reauthentication", []int{http.StatusUnauthorized, http.StatusUnauthorized}, 2, 2, true},
+		{"other errors do not reauthenticate", []int{http.StatusNotFound}, 1, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			mux := http.NewServeMux()
+			handler := func(body string) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					n := int(calls.Add(1))
+					if n <= len(tt.statuses) && tt.statuses[n-1] != http.StatusOK {
+						http.Error(w, "rejected", tt.statuses[n-1])
+						return
+					}
+					w.Write([]byte(body))
+				}
+			}
+			mux.Handle("/czds/downloads/links", handler(`["https://czds.example/czds/downloads/com.zone"]`))
+			mux.Handle("/czds/downloads/com.zone", handler("com zone"))
+
+			requests := []struct {
+				name string
+				do   func(c *Client) error
+			}{
+				{"api", func(c *Client) error {
+					_, err := c.GetLinks()
+					return err
+				}},
+				{"download", func(c *Client) error {
+					var b bytes.Buffer
+					_, err := c.DownloadZoneToWriter(c.BaseURL+"/czds/downloads/com.zone", &b)
+					return err
+				}},
+			}
+			for _, request := range requests {
+				t.Run(request.name, func(t *testing.T) {
+					ts, c := newTestServer(t, mux)
+					calls.Store(0)
+					err := request.do(c)
+					if (err != nil) != tt.wantError {
+						t.Errorf("error = %v, want error: %t", err, tt.wantError)
+					}
+					if n := calls.Load(); n != tt.wantCalls {
+						t.Errorf("requested %d times, want %d", n, tt.wantCalls)
+					}
+					if n := ts.auths.Load(); n != tt.wantAuths {
+						t.Errorf("authenticated %d times, want %d", n, tt.wantAuths)
+					}
+				})
+			}
+		})
+	}
+}
+
+// TestConcurrentReauthenticate shares one Client between many requests while its token is replaced, run it with -race
+func TestConcurrentReauthenticate(t *testing.T) {
+	tests := []struct {
+		name   string
+		reject bool // the server rejects the first token after 20 requests instead of the client expiring it
+	}{
+		{"token expires", false},
+		{"token rejected", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/links", func(w http.ResponseWriter, r *http.Request) {
+				if tt.reject && calls.Add(1) > 20 {
+					token, err := jwt.DecodeJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+					if err != nil || token.Data.Jti == "1" {
+						http.Error(w, "rejected", http.StatusUnauthorized)
+						return
+					}
+				}
+				writeJSON(t, w, []string{"https://czds.example/czds/downloads/com.zone"})
+			})
+			mux.HandleFunc("/czds/downloads/com.zone", func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("com zone"))
+			})
+			ts, c := newTestServer(t, mux)
+
+			done := make(chan struct{})
+			var expirer sync.WaitGroup
+			if !tt.reject {
+				expirer.Add(1)
+				go func() {
+					defer expirer.Done()
+					for {
+						select {
+						case <-done:
+							return
+						case <-time.After(time.Millisecond):
+						}
+						c.authMutex.Lock()
+						c.authExp = time.Now()
+						c.authMutex.Unlock()
+					}
+				}()
+			}
+
+			var wg sync.WaitGroup
+			errs := make(chan error, 32*10)
+			for i := 0; i < 32; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 10; j++ {
+						var err error
+						if i%2 == 0 {
+							_, err = c.GetLinks()
+						} else {
+							_, err = c.DownloadZoneToWriter(c.BaseURL+"/czds/downloads/com.zone", io.Discard)
+						}
+						if err != nil {
+							errs <- err
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(done)
+			expirer.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+			n := ts.auths.Load()
+			if n < 2 {
+				t.Errorf("authenticated %d times, want the token to be replaced during the requests", n)
+			}
+			if tt.reject && n != 2 {
+				t.Errorf("authenticated %d times, want the rejected token to be replaced once", n)
+			}
+		})
+	}
+}
+
+func TestGetAllRequestsPaging(t *testing.T) {
+	tests := []struct {
+		name      string
+		requests  int // requests on the server
+		total     int // TotalRequests reported by the server, -1 for the number of requests
+		startPage int
+		wantPages int
+		wantCount int
+		wantLog   string
+	}{
+		{"short last page", 250, -1, 0, 3, 250, "fetched 250/250"},
+		{"full last page", 200, -1, 0, 2, 200, "fetched 200/200"},
+		{"no requests", 0, -1, 0, 1, 0, ""},
+		{"total missing", 200, 0, 0, 3, 200, ""},
+		{"total too large", 200, 300, 0, 3, 200, "fetched 200/300"},
+		{"resumed", 250, -1, 1, 2, 150, "fetched 250/250"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pages atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				pages.Add(1)
+				var filter RequestsFilter
+				err := json.NewDecoder(r.Body).Decode(&filter)
+				if err != nil {
+					t.Error(err)
+				}
+				resp := RequestsResponse{TotalRequests: int64(tt.total)}
+				if tt.total < 0 {
+					resp.TotalRequests = int64(tt.requests)
+				}
+				start := filter.Pagination.Page * filter.Pagination.Size
+				end := min(start+filter.Pagination.Size, tt.requests)
+				for i := start; i < end; i++ {
+					resp.Requests = append(resp.Requests, Request{RequestID: strconv.Itoa(i)})
+				}
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+			l := &printfLogger{}
+			c.SetLogger(l)
+
+			got, _, err := c.GetAllRequestsFromPage(RequestApproved, tt.startPage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("got %d requests, want %d", len(got), tt.wantCount)
+			}
+			if n := int(pages.Load()); n != tt.wantPages {
+				t.Errorf("requested %d pages, want %d", n, tt.wantPages)
+			}
+			if tt.wantLog != "" && !strings.Contains(strings.Join(l.lines, "\n"), tt.wantLog) {
+				t.Errorf("progress %q not logged in:\n%s", tt.wantLog, strings.Join(l.lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestGetAllRequestsResume(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+		failPage int // page that fails the first time it is requested
+	}{
+		{"first page", 350, 0},
+		{"middle page", 350, 2},
+		{"last page", 350, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failed atomic.Bool
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter RequestsFilter
+				err := json.NewDecoder(r.Body).Decode(&filter)
+				if err != nil {
+					t.Error(err)
+				}
+				if filter.Pagination.Page == tt.failPage && !failed.Swap(true) {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				resp := RequestsResponse{TotalRequests: int64(tt.requests)}
+				start := filter.Pagination.Page * filter.Pagination.Size
+				end := min(start+filter.Pagination.Size, tt.requests)
+				for i := start; i < end; i++ {
+					resp.Requests = append(resp.Requests, Request{RequestID: strconv.Itoa(i)})
+				}
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+
+			first, page, err := c.GetAllRequestsFromPage(RequestApproved, 0)
+			if err == nil {
+				t.Fatal("GetAllRequestsFromPage() did not return the error of the failed page")
+			}
+			if page != tt.failPage {
+				t.Errorf("resume page = %d, want %d", page, tt.failPage)
+			}
+			rest, _, err := c.GetAllRequestsFromPage(RequestApproved, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[string]bool)
+			for _, request := range append(first, rest...) {
+				if seen[request.RequestID] {
+					t.Errorf("request %s returned twice", request.RequestID)
+				}
+				seen[request.RequestID] = true
+			}
+			if len(seen) != tt.requests {
+				t.Errorf("got %d requests, want %d", len(seen), tt.requests)
+			}
+		})
+	}
+}
+
+func TestGetZoneRequestIDs(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	list := []Request{
+		{RequestID: "com-old", TLD: "com", Status: RequestExpired, Created: now.Add(-300 * time.Hour)},
+		{RequestID: "com-new", TLD: "com", Status: RequestApproved, Created: now.Add(-time.Hour)},
+		{RequestID: "com-denied", TLD: "com", Status: RequestDenied, Created: now.Add(-200 * time.Hour)},
+		{RequestID: "net", TLD: "net", Status: RequestApproved, Created: now},
+	}
+	// zones containing com that push the com requests onto later pages
+	for i := 0; i < 150; i++ {
+		list = append(list, Request{RequestID: "company" + strconv.Itoa(i), TLD: "company" + strconv.Itoa(i), Created: now.Add(-time.Duration(i) * time.Minute)})
+	}
+	tests := []struct {
+		name string
+		zone string
+		want []string
+	}{
+		{"all requests newest first", "com", []string{"com-new", "com-denied", "com-old"}},
+		{"case insensitive", "COM", []string{"com-new", "com-denied", "com-old"}},
+		{"single request", "net", []string{"net"}},
+		{"no requests", "org", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter RequestsFilter
+				err := json.NewDecoder(r.Body).Decode(&filter)
+				if err != nil {
+					t.Error(err)
+				}
+				matches := make([]Request, 0)
+				for _, request := range list {
+					if strings.Contains(request.TLD, filter.Filter) {
+						matches = append(matches, request)
+					}
+				}
+				sort.SliceStable(matches, func(i, j int) bool { return matches[i].Created.After(matches[j].Created) })
+				resp := RequestsResponse{TotalRequests: int64(len(matches))}
+				start := min(filter.Pagination.Page*filter.Pagination.Size, len(matches))
+				end := min(start+filter.Pagination.Size, len(matches))
+				resp.Requests = matches[start:end]
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+			got, err := c.GetZoneRequestIDs(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetZoneRequestIDs(%q) = %v, want %v", tt.zone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetZoneRequestIDsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var pages atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		// every page is full so paging only stops when ctx is done
+		if pages.Add(1) == 2 {
+			cancel()
+		}
+		writeJSON(t, w, RequestsResponse{TotalRequests: 1000, Requests: []Request{{RequestID: "com", TLD: "com"}}})
+	})
+	_, c := newTestServer(t, mux)
+
+	_, err := c.GetZoneRequestIDsWithContext(ctx, "com")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetZoneRequestIDsWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if n := pages.Load(); n > 3 {
+		t.Errorf("requested %d pages after the context was canceled", n)
+	}
+}
+
+func TestGetZoneRequestIDUnicode(t *testing.T) {
+	list := []Request{
+		{RequestID: "rf", TLD: "xn--p1ai", Status: RequestApproved},
+		{RequestID: "bel", TLD: "xn--90ais", Status: RequestApproved},
+		{RequestID: "com", TLD: "com", Status: RequestApproved},
+	}
+	tests := []struct {
+		name       string
+		zone       string
+		wantFilter string
+		want       string // empty when there is no request for the zone
+	}{
+		{"unicode", "рф", "xn--p1ai", "rf"},
+		{"uppercase unicode", "РФ", "xn--p1ai", "rf"},
+		{"punycode", "xn--p1ai", "xn--p1ai", "rf"},
+		{"uppercase punycode", "XN--90AIS", "xn--90ais", "bel"},
+		{"ascii", "COM", "com", "com"},
+		{"unicode without a request", "café", "xn--caf-dma", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var filters []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter RequestsFilter
+				err := json.NewDecoder(r.Body).Decode(&filter)
+				if err != nil {
+					t.Error(err)
+				}
+				filters = append(filters, filter.Filter)
+				resp := RequestsResponse{Requests: make([]Request, 0)}
+				for _, request := range list {
+					if filter.Pagination.Page == 0 && request.TLD == filter.Filter {
+						resp.Requests = append(resp.Requests, request)
+					}
+				}
+				resp.TotalRequests = int64(len(resp.Requests))
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+
+			id, err := c.GetZoneRequestID(tt.zone)
+			if (err != nil) != (len(tt.want) == 0) {
+				t.Fatalf("GetZoneRequestID(%q) error = %v", tt.zone, err)
+			}
+			if id != tt.want {
+				t.Errorf("GetZoneRequestID(%q) = %q, want %q", tt.zone, id, tt.want)
+			}
+			ids, err := c.GetZoneRequestIDs(tt.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{}
+			if len(tt.want) > 0 {
+				want = []string{tt.want}
+			}
+			if !slices.Equal(ids, want) {
+				t.Errorf("GetZoneRequestIDs(%q) = %v, want %v", tt.zone, ids, want)
+			}
+			for _, filter := range filters {
+				if filter != tt.wantFilter {
+					t.Errorf("requests filtered by %q, want %q", filter, tt.wantFilter)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientConnections(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxConns        int
+		wantIdle        int // MaxIdleConns and MaxIdleConnsPerHost
+		wantPerHost     int // MaxConnsPerHost
+		wantReused      bool
+		defaultIdleConn bool // the idle connection limits are left at the http.DefaultTransport values
+	}{
+		{"default", 0, 0, 0, false, true},
+		{"parallel 8", 8, 8, 9, true, false},
+		{"parallel 50", 50, 50, 51, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := NewHTTPClient(&HTTPClientOptions{MaxConns: tt.maxConns})
+			transport := hc.Transport.(*http.Transport)
+			if tt.defaultIdleConn {
+				def := http.DefaultTransport.(*http.Transport)
+				if transport.MaxIdleConns != def.MaxIdleConns || transport.MaxIdleConnsPerHost != def.MaxIdleConnsPerHost || transport.MaxConnsPerHost != def.MaxConnsPerHost {
+					t.Errorf("limits = %d/%d/%d, want the default transport limits", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost)
+				}
+			} else {
+				if transport.MaxIdleConns != tt.wantIdle || transport.MaxIdleConnsPerHost != tt.wantIdle {
+					t.Errorf("MaxIdleConns = %d, MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, tt.wantIdle)
+				}
+				if transport.MaxConnsPerHost != tt.wantPerHost {
+					t.Errorf("MaxConnsPerHost = %d, want %d", transport.MaxConnsPerHost, tt.wantPerHost)
+				}
+			}
+
+			// two rounds of 8 parallel requests reuse the connections of the first round when the pool is large enough
+			var conns atomic.Int32
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(20 * time.Millisecond)
+				w.Write([]byte("ok"))
+			}))
+			ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			ts.Start()
+			defer ts.Close()
+			defer transport.CloseIdleConnections()
+			for round := 0; round < 2; round++ {
+				var wg sync.WaitGroup
+				for i := 0; i < 8; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						resp, err := hc.Get(ts.URL)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						io.Copy(io.Discard, resp.Body)
+						resp.Body.Close()
+					}()
+				}
+				wg.Wait()
+			}
+			n := conns.Load()
+			if n > 16 {
+				t.Errorf("opened %d connections for 16 requests", n)
+			}
+			if reused := n <= 8; reused != tt.wantReused {
+				t.Errorf("opened %d connections for 2 rounds of 8 parallel requests, want connections reused: %t", n, tt.wantReused)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	calls := []struct {
+		name string
+		path string // path of the request that is checked
+		call func(c *Client, url string) error
+	}{
+		{"authenticate", "/auth", func(c *Client, url string) error {
+			c.AuthURL = url + "/auth"
+			return c.Authenticate()
+		}},
+		{"api", "/czds/tlds", func(c *Client, url string) error { _, err := c.GetTLDStatus(); return err }},
+		{"download info", "/czds/downloads/com.zone", func(c *Client, url string) error {
+			_, err := c.GetDownloadInfo(url + "/czds/downloads/com.zone")
+			return err
+		}},
+		{"download", "/czds/downloads/com.zone", func(c *Client, url string) error {
+			_, err := c.DownloadZoneToWriter(url+"/czds/downloads/com.zone", io.Discard)
+			return err
+		}},
+		{"report", "/czds/requests/report", func(c *Client, url string) error { return c.DownloadAllRequests(io.Discard) }},
+	}
+	for _, userAgent := range []string{"", "zone-sync/1.0 (ops@example.com)"} {
+		for _, tt := range calls {
+			want := userAgent
+			if len(want) == 0 {
+				want = DefaultUserAgent()
+				if !strings.HasPrefix(want, "czds-go/") {
+					t.Fatalf("DefaultUserAgent() = %q, want czds-go/<version>", want)
+				}
+			}
+			t.Run(tt.name+" "+want, func(t *testing.T) {
+				var got []string
+				mux := http.NewServeMux()
+				mux.HandleFunc(tt.path, func(w http.ResponseWriter, r *http.Request) {
+					got = append(got, r.Header.Get("User-Agent"))
+					switch tt.path {
+					case "/auth":
+						json.NewEncoder(w).Encode(authResponse{AccessToken: testJWT(jwt.Data{}), Message: "ok"})
+					case "/czds/tlds":
+						w.Write([]byte("[]"))
+					case "/czds/downloads/com.zone":
+						w.Header().Set("Content-Disposition", "attachment; filename=com.txt.gz")
+						w.Header().Set("Content-Length", "8")
+						if r.Method == http.MethodGet {
+							w.Write([]byte("com zone"))
+						}
+					default:
+						w.Write([]byte("TLD,Status\n"))
+					}
+				})
+				ts, c := newTestServer(t, mux)
+				c.UserAgent = userAgent
+				err := tt.call(c, ts.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) == 0 {
+					t.Fatalf("no requests to %s", tt.path)
+				}
+				for _, ua := range got {
+					if ua != want {
+						t.Errorf("User-Agent = %q, want %q", ua, want)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package czds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// default time to wait when rate limited and the server does not send a Retry-After header
+const defaultRetryAfter = 30 * time.Second
+
+// max number of times a batch operation will pause and retry a single rate limited call
+const maxRateLimitRetries = 5
+
+// ErrNotModified is returned by DownloadZoneToWriterIfModifiedSince when the zone has not changed
+var ErrNotModified = errors.New("zone not modified")
+
+// AuthError is returned when the client is unable to authenticate with the CZDS API
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("unable to authenticate: %s", e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is returned when the API responds to a request with an error status
+type APIError struct {
+	URL        string
+	Status     string
+	StatusCode int
+	HTTPStatus int    // status from the error body, 0 if none was sent
+	Message    string // message from the error body, empty if none was sent
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("error on request %q: got Status %s %s", e.URL, e.Status, http.StatusText(e.StatusCode))
+	if e.HTTPStatus != 0 || len(e.Message) > 0 {
+		msg += fmt.Sprintf(" HTTP Status: %d Message: %q", e.HTTPStatus, e.Message)
+	}
+	return msg
+}
+
+// isTermsVersionError returns true if err is the API rejecting a request for accepting an outdated terms and conditions version
+func isTermsVersionError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode < 400 || apiErr.StatusCode >= 500 {
+		return false
+	}
+	message := strings.ToLower(apiErr.Message)
+	return strings.Contains(message, "terms") || strings.Contains(message, "tcversion")
+}
+
+// RateLimitError is returned when the API responds with HTTP 429 Too Many Requests
+type RateLimitError struct {
+	URL        string
+	RetryAfter time.Duration // delay advertised by the server, 0 if none was sent
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited on request %q, retry after %s", e.URL, e.RetryAfter)
+	}
+	return fmt.Sprintf("rate limited on request %q", e.URL)
+}
+
+// newRateLimitError creates a RateLimitError from the Retry-After header of resp
+// the header may either be a number of seconds or an HTTP date
+func newRateLimitError(url string, resp *http.Response) *RateLimitError {
+	e := &RateLimitError{URL: url}
+	retryAfter := resp.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return e
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(retryAfter); err == nil {
+		e.RetryAfter = time.Until(date)
+	}
+	if e.RetryAfter < 0 {
+		e.RetryAfter = 0
+	}
+	return e
+}
+
+// retryRateLimited calls f, and if it fails with a RateLimitError pauses for the advertised
+// Retry-After duration before calling it again, the pause is cut short when ctx is done
+func (c *Client) retryRateLimited(ctx context.Context, f func() error) error {
+	for try := 1; ; try++ {
+		err := f()
+		var rateLimitErr *RateLimitError
+		if !errors.As(err, &rateLimitErr) || try > maxRateLimitRetries {
+			return err
+		}
+		wait := rateLimitErr.RetryAfter
+		if wait == 0 {
+			wait = defaultRetryAfter
+		}
+		c.v("rate limited [%d/%d], pausing for %s", try, maxRateLimitRetries, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
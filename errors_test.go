@@ -0,0 +1,55 @@
+package czds
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryRateLimited(t *testing.T) {
+	rateLimited := &RateLimitError{URL: "/test", RetryAfter: time.Millisecond}
+	other := errors.New("other")
+	tests := []struct {
+		name      string
+		errs      []error // returned by each call, nil once exhausted
+		cancel    bool    // cancel the context before calling
+		wantCalls int
+		wantErr   []error
+	}{
+		{"success", nil, false, 1, nil},
+		{"retried after rate limit", []error{rateLimited, rateLimited}, false, 3, nil},
+		{"other errors are not retried", []error{other}, false, 1, []error{other}},
+		{"gives up after max retries", []error{rateLimited, rateLimited, rateLimited, rateLimited, rateLimited, rateLimited, rateLimited}, false, maxRateLimitRetries + 1, []error{rateLimited}},
+		{"canceled while paused", []error{rateLimited}, true, 1, []error{rateLimited, context.Canceled}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			c := NewClient("user", "pass")
+			calls := 0
+			err := c.retryRateLimited(ctx, func() error {
+				calls++
+				if calls > len(tt.errs) {
+					return nil
+				}
+				return tt.errs[calls-1]
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+			}
+			if len(tt.wantErr) == 0 && err != nil {
+				t.Errorf("retryRateLimited() error = %v", err)
+			}
+			for _, want := range tt.wantErr {
+				if !errors.Is(err, want) {
+					t.Errorf("retryRateLimited() error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -33,21 +33,24 @@ package czds
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"os/signal"
 	"os/user"
 	"regexp"
-	"runtime"
 	"strings"
-	"syscall"
 )
 
 // Getpass retrieves a password from the user using a method defined by
 // the 'passfrom' string.  The following methods are supported:
 //
+//  bw:name        Use the Bitwarden command-line client bw(1) to
+//                 retrieve the named password.  You should previously have
+//                 unlocked the vault and set BW_SESSION for this to work.
+//
 //  cmd:command    Obtain the password by running the given command.
 //                 The command will be passed to the shell for execution
 //                 via "/bin/sh -c 'command'".
@@ -61,6 +64,8 @@ import (
 //                 a device or named pipe.  Note that standard Unix file
 //                 access controls should be used to protect this file.
 //
+//  gopass:path    Use gopass(1) to retrieve the password stored at path.
+//
 //  keychain:name  Use the security(1) utility to retrieve the
 //                 password from the macOS keychain.
 //
@@ -76,6 +81,10 @@ import (
 //                 into the shell history file, this form should only be
 //                 used where security is not important.
 //
+//  stdin          The first line read from standard input is the password.
+//                 This allows piping the password in where there is no tty,
+//                 ex: echo "$PASSWORD" | command -passin stdin
+//
 //  tty:prompt     This is the default: `Getpass` will prompt the user on
 //                 the controlling tty using  the provided `prompt`.  If no
 //                 `prompt` is provided, then `Getpass` will use "Password: ".
@@ -83,7 +92,16 @@ import (
 // This function is variadic purely so that you can invoke it without any
 // arguments, thereby defaulting to interactively providing the password
 // as if 'passfrom' was set to "tty:Password: ".
+//
+// An interrupt or SIGTERM while prompting on the tty restores echo and
+// returns an error.
 func Getpass(passfrom ...string) (pass string, err error) {
+	return GetpassWithContext(context.Background(), passfrom...)
+}
+
+// GetpassWithContext is like Getpass, but the tty prompt is also
+// cancelled when ctx is done.
+func GetpassWithContext(ctx context.Context, passfrom ...string) (pass string, err error) {
 	var passin []string
 	source := "tty"
 	prompt := "Password: "
@@ -95,19 +113,23 @@ func Getpass(passfrom ...string) (pass string, err error) {
 	errMsg := "invalid password source"
 	if len(passfrom) > 0 {
 		passin = strings.SplitN(passfrom[0], ":", 2)
-		if len(passin) < 2 && passfrom[0] != "tty" {
+		if len(passin) < 2 && passfrom[0] != "tty" && passfrom[0] != "stdin" {
 			return "", errors.New(errMsg)
 		}
 		source = passin[0]
 	}
 
 	switch source {
+	case "bw":
+		return getpassFromBitwarden(passin[1])
 	case "cmd":
 		return getpassFromCommand(passin[1])
 	case "env":
 		return getpassFromEnv(passin[1])
 	case "file":
 		return getpassFromFile(passin[1])
+	case "gopass":
+		return getpassFromGopass(passin[1])
 	case "keychain":
 		return getpassFromKeychain(passin[1])
 	case "lastpass":
@@ -120,16 +142,16 @@ func Getpass(passfrom ...string) (pass string, err error) {
 		return getpassFromOnepass(passin[1])
 	case "pass":
 		return passin[1], nil
+	case "stdin":
+		return getpassFromStdin()
 	case "tty":
 		if len(passin) == 2 {
 			prompt = passin[1]
 		}
-		return getpassFromUser(prompt)
+		return getpassFromUser(ctx, prompt)
 	default:
 		return "", errors.New(errMsg)
 	}
-
-	return pass, nil
 }
 
 func getpassFromCommand(command string) (pass string, err error) {
@@ -218,43 +240,31 @@ func getpassFromOnepass(entry string) (pass string, err error) {
 	return out, nil
 }
 
-func getpassFromUser(prompt string) (pass string, err error) {
-	dev_tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
-	if err != nil {
-		return "", err
-	}
-
-	fmt.Fprintf(dev_tty, prompt)
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		err = stty("echo")
-		if err != nil {
-			os.Exit(1)
-		}
-	}()
-
-	err = stty("-echo")
+func getpassFromBitwarden(entry string) (pass string, err error) {
+	cmd := []string{"bw", "get", "password", entry}
+	out, err := runCommand(cmd, "", false)
 	if err != nil {
 		return "", err
 	}
+	return out, nil
+}
 
-	input := bufio.NewReader(dev_tty)
-	b, err := input.ReadBytes('\n')
+func getpassFromGopass(entry string) (pass string, err error) {
+	cmd := []string{"gopass", "show", "-o", entry}
+	out, err := runCommand(cmd, "", false)
 	if err != nil {
 		return "", err
 	}
-	pass = string(b)
+	return out, nil
+}
 
-	err = stty("echo")
-	if err != nil {
-		return "", err
+func getpassFromStdin() (pass string, err error) {
+	input := bufio.NewReader(os.Stdin)
+	line, err := input.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return "", fmt.Errorf("unable to read password from stdin: %w", err)
 	}
-	fmt.Fprintf(dev_tty, "\n")
-
-	return string(pass[:len(pass)-1]), nil
+	return strings.TrimRight(line, "\r\n"), nil
 }
 
 func runCommand(args []string, stdinData string, need_tty bool) (string, error) {
@@ -266,7 +276,7 @@ func runCommand(args []string, stdinData string, need_tty bool) (string, error)
 	cmd.Stderr = &stderr
 
 	if need_tty {
-		dev_tty, err := os.Open("/dev/tty")
+		dev_tty, err := os.Open(ttyPath)
 		if err != nil {
 			return "", err
 		}
@@ -285,18 +295,3 @@ func runCommand(args []string, stdinData string, need_tty bool) (string, error)
 	}
 	return strings.TrimSpace(stdout.String()), nil
 }
-
-func stty(arg string) (err error) {
-	flag := "-f"
-	if runtime.GOOS == "linux" {
-		flag = "-F"
-	}
-
-	err = exec.Command("/bin/stty", flag, "/dev/tty", arg).Run()
-	if err != nil {
-		errMsg := fmt.Sprintf("Unable to run stty on /dev/tty: %v", err)
-		return errors.New(errMsg)
-	}
-
-	return nil
-}
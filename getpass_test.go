@@ -0,0 +1,110 @@
+package czds
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// stubCommands puts shell scripts that print their name and bracketed arguments first in PATH
+// a command listed in fail exits with an error instead
+func stubCommands(t *testing.T, names []string, fail ...string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("command stubs are shell scripts")
+	}
+	dir := t.TempDir()
+	for _, name := range names {
+		script := "#!/bin/sh\nprintf %s " + name + "\nfor a; do printf ' [%s]' \"$a\"; done\necho\necho\n"
+		for _, f := range fail {
+			if f == name {
+				script = "#!/bin/sh\necho \"" + name + ": not logged in\" >&2\nexit 1\n"
+			}
+		}
+		err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGetpassCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		passin  string
+		fail    string // command that exits with an error
+		want    string // the command line run, echoed back by the stub
+		wantErr string
+	}{
+		{"bitwarden", "bw:czds", "", "bw [get] [password] [czds]", ""},
+		{"bitwarden entry with spaces", "bw:czds account", "", "bw [get] [password] [czds account]", ""},
+		{"gopass", "gopass:web/czds", "", "gopass [show] [-o] [web/czds]", ""},
+		{"lastpass", "lpass:czds", "", "lpass [show] [czds] [--password]", ""},
+		{"1password", "op:czds", "", "op [item] [get] [czds] [--fields] [password]", ""},
+		{"bitwarden fails", "bw:czds", "bw", "", "bw: not logged in"},
+		{"gopass fails", "gopass:web/czds", "gopass", "", "gopass: not logged in"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubCommands(t, []string{"bw", "gopass", "lpass", "op"}, tt.fail)
+			got, err := Getpass(tt.passin)
+			if len(tt.wantErr) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Getpass(%q) error = %v, want %q", tt.passin, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Getpass(%q) = %q, want %q", tt.passin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetpassStdin(t *testing.T) {
+	tests := []struct {
+		name    string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		{"newline", "secret\n", "secret", false},
+		{"crlf", "secret\r\n", "secret", false},
+		{"no trailing newline", "secret", "secret", false},
+		{"only the first line", "secret\nsecond\n", "secret", false},
+		{"spaces are kept", " secret \n", " secret ", false},
+		{"empty line", "\n", "", false},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a pipe like `echo $PASS | czds-dl` where there is no tty
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			go func() {
+				w.WriteString(tt.stdin)
+				w.Close()
+			}()
+			stdin := os.Stdin
+			os.Stdin = r
+			defer func() { os.Stdin = stdin }()
+
+			got, err := Getpass("stdin")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Getpass(\"stdin\") error = %v, want error: %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Getpass(\"stdin\") = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+//go:build !windows
+
+// Getpass imported from
+// https://github.com/jschauma/getpass/ to avoid
+// pulling in external dependencies.
+// See getpass.go for the copyright and license.
+
+package czds
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+)
+
+// ttyPath is the path of the controlling terminal and sttyPath the stty(1) used to toggle its echo
+var (
+	ttyPath  = "/dev/tty"
+	sttyPath = "/bin/stty"
+)
+
+func getpassFromUser(ctx context.Context, prompt string) (pass string, err error) {
+	dev_tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer dev_tty.Close()
+
+	fmt.Fprintf(dev_tty, prompt)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = stty("-echo")
+	if err != nil {
+		return "", err
+	}
+
+	type readResult struct {
+		b   []byte
+		err error
+	}
+	read := make(chan readResult, 1)
+	go func() {
+		input := bufio.NewReader(dev_tty)
+		b, err := input.ReadBytes('\n')
+		read <- readResult{b, err}
+	}()
+
+	var result readResult
+	select {
+	case <-ctx.Done():
+		stty("echo")
+		fmt.Fprintf(dev_tty, "\n")
+		return "", ctx.Err()
+	case result = <-read:
+	}
+	if result.err != nil {
+		stty("echo")
+		return "", result.err
+	}
+	pass = string(result.b)
+
+	err = stty("echo")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(dev_tty, "\n")
+
+	return string(pass[:len(pass)-1]), nil
+}
+
+func stty(arg string) (err error) {
+	flag := "-f"
+	if runtime.GOOS == "linux" {
+		flag = "-F"
+	}
+
+	err = exec.Command(sttyPath, flag, ttyPath, arg).Run()
+	if err != nil {
+		errMsg := fmt.Sprintf("Unable to run stty on /dev/tty: %v", err)
+		return errors.New(errMsg)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+
+package czds
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubTTY replaces the terminal with a FIFO that is never typed into and stty with a script
+// that logs its last argument, it returns the path of the log
+func stubTTY(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	tty := filepath.Join(dir, "tty")
+	err := syscall.Mkfifo(tty, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "stty.log")
+	stty := filepath.Join(dir, "stty")
+	script := "#!/bin/sh\nfor a; do last=\"$a\"; done\necho \"$last\" >> " + log + "\n"
+	err = os.WriteFile(stty, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldTTY, oldStty := ttyPath, sttyPath
+	ttyPath, sttyPath = tty, stty
+	t.Cleanup(func() { ttyPath, sttyPath = oldTTY, oldStty })
+	return log
+}
+
+// sttyCalls returns the arguments stty was called with
+func sttyCalls(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestGetpassFromUserCancel(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration // the prompt times out instead of being cancelled
+		wantErr error
+	}{
+		{"cancelled", 0, context.Canceled},
+		{"timeout", 50 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := stubTTY(t)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			errc := make(chan error, 1)
+			go func() {
+				_, err := GetpassWithContext(ctx, "tty")
+				errc <- err
+			}()
+
+			if tt.timeout == 0 {
+				// cancel once echo is off and the prompt is waiting for input
+				deadline := time.Now().Add(5 * time.Second)
+				for len(sttyCalls(t, log)) == 0 {
+					if time.Now().After(deadline) {
+						t.Fatal("echo was never disabled")
+					}
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}
+			select {
+			case err := <-errc:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetpassWithContext() error = %v, want %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the prompt was not cancelled")
+			}
+			if calls := sttyCalls(t, log); strings.Join(calls, " ") != "-echo echo" {
+				t.Errorf("stty called with %v, want echo disabled then restored", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+//go:build windows
+
+package czds
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// ttyPath is the path of the console input
+const ttyPath = "CONIN$"
+
+// console mode flags from the Windows API
+const (
+	enableProcessedInput = 0x0001
+	enableLineInput      = 0x0002
+	enableEchoInput      = 0x0004
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+func setConsoleMode(console syscall.Handle, mode uint32) error {
+	r, _, err := procSetConsoleMode.Call(uintptr(console), uintptr(mode))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// getpassFromUser prompts on the console with echo disabled until a line is read or ctx is done
+func getpassFromUser(ctx context.Context, prompt string) (pass string, err error) {
+	conin, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer conin.Close()
+	conout, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		return "", err
+	}
+	defer conout.Close()
+
+	handle := syscall.Handle(conin.Fd())
+	var mode uint32
+	err = syscall.GetConsoleMode(handle, &mode)
+	if err != nil {
+		return "", fmt.Errorf("unable to get console mode: %w", err)
+	}
+	err = setConsoleMode(handle, (mode&^enableEchoInput)|enableProcessedInput|enableLineInput)
+	if err != nil {
+		return "", fmt.Errorf("unable to disable console echo: %w", err)
+	}
+	defer setConsoleMode(handle, mode)
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	fmt.Fprint(conout, prompt)
+	type readResult struct {
+		line string
+		err  error
+	}
+	read := make(chan readResult, 1)
+	go func() {
+		line, err := bufio.NewReader(conin).ReadString('\n')
+		read <- readResult{line, err}
+	}()
+
+	var result readResult
+	select {
+	case <-ctx.Done():
+		fmt.Fprint(conout, "\n")
+		return "", ctx.Err()
+	case result = <-read:
+	}
+	fmt.Fprint(conout, "\n")
+	if result.err != nil {
+		return "", result.err
+	}
+	return strings.TrimRight(result.line, "\r\n"), nil
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package czds
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetpassFromUserWindows(t *testing.T) {
+	console := true
+	conin, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		console = false
+	} else {
+		conin.Close()
+	}
+
+	tests := []struct {
+		name    string
+		passin  string
+		wantErr error
+	}{
+		{"tty", "tty", context.Canceled},
+		{"default", "", context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the prompt is cancelled before anything is typed
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			var err error
+			if len(tt.passin) > 0 {
+				_, err = GetpassWithContext(ctx, tt.passin)
+			} else {
+				_, err = GetpassWithContext(ctx)
+			}
+			if !console {
+				// without a console, as under CI, the prompt fails instead of blocking
+				if err == nil {
+					t.Fatal("GetpassWithContext() without a console succeeded")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetpassWithContext() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/lanrat/czds
 
-go 1.13
+go 1.21
+
+require golang.org/x/net v0.35.0
+
+require golang.org/x/text v0.22.0 // indirect
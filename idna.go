@@ -0,0 +1,67 @@
+package czds
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// prefix of IDN labels encoded with punycode
+const acePrefix = "xn--"
+
+// UnicodeTLD returns the unicode form of the TLD, ULabel if set by the server, otherwise the decoded punycode TLD
+func (t TLDStatus) UnicodeTLD() string {
+	return unicodeLabel(t.TLD, t.ULabel)
+}
+
+// UnicodeTLD returns the unicode form of the TLD, ULabel if set by the server, otherwise the decoded punycode TLD
+func (r Request) UnicodeTLD() string {
+	return unicodeLabel(r.TLD, r.ULabel)
+}
+
+// unicodeLabel returns ulabel if it is set, otherwise label with any punycode decoded
+func unicodeLabel(label, ulabel string) string {
+	if len(ulabel) != 0 {
+		return ulabel
+	}
+	decoded, err := ToUnicode(label)
+	if err != nil {
+		return label
+	}
+	return decoded
+}
+
+// ToUnicode decodes an IDN label with the "xn--" prefix from punycode to unicode
+// labels without the prefix are returned unchanged
+func ToUnicode(label string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(label), acePrefix) {
+		return label, nil
+	}
+	return idna.Punycode.ToUnicode(strings.ToLower(label))
+}
+
+// ToASCII lowercases an IDN label and encodes it to punycode with the "xn--" prefix, as used by CZDS for zone names
+// ASCII labels are only lowercased, unicode labels are mapped and validated with the IDNA lookup profile of UTS #46
+func ToASCII(label string) (string, error) {
+	label = strings.ToLower(label)
+	for i := 0; i < len(label); i++ {
+		if label[i] >= utf8.RuneSelf {
+			encoded, err := idna.Lookup.ToASCII(label)
+			if err != nil {
+				return "", err
+			}
+			return encoded, nil
+		}
+	}
+	return label, nil
+}
+
+// toASCIIOrSame returns the ToASCII form of label, or label unchanged if it can not be encoded
+func toASCIIOrSame(label string) string {
+	encoded, err := ToASCII(label)
+	if err != nil {
+		return label
+	}
+	return encoded
+}
@@ -0,0 +1,122 @@
+package czds
+
+import (
+	"strings"
+	"testing"
+)
+
+// sample strings from RFC 3492 section 7.1
+// sample S is left out as it contains a dot, so it is not a single label
+var rfc3492Samples = []struct {
+	name     string
+	unicode  string
+	punycode string
+}{
+	{"A Arabic (Egyptian)", "ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+	{"B Chinese (simplified)", "他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	{"C Chinese (traditional)", "他們爲什麽不說中文", "ihqwctvzc91f659drss3x8bo0yb"},
+	{"D Czech", "Pročprostěnemluvíčesky", "Proprostnemluvesky-uyb24dma41a"},
+	{"E Hebrew", "למההםפשוטלאמדבריםעברית", "4dbcagdahymbxekheh6e0a7fei0b"},
+	{"F Hindi (Devanagari)", "यहलोगहिन्दीक्योंनहींबोलसकतेहैं", "i1baa7eci9glrd9b2ae1bj0hfcgg6iyaf8o0a1dig0cd"},
+	{"G Japanese (kanji and hiragana)", "なぜみんな日本語を話してくれないのか", "n8jok5ay5dzabd5bym9f0cm5685rrjetr6pdxa"},
+	{"H Korean (Hangul syllables)", "세계의모든사람들이한국어를이해한다면얼마나좋을까", "989aomsvi5e83db1d2a355cv1e0vak1dwrv93d5xbh15a0dt30a5jpsd879ccm6fea98c"},
+	{"I Russian (Cyrillic)", "почемужеонинеговорятпорусски", "b1abfaaepdrnnbgefbaDotcwatmq2g4l"},
+	{"J Spanish", "PorquénopuedensimplementehablarenEspañol", "PorqunopuedensimplementehablarenEspaol-fmd56a"},
+	{"K Vietnamese", "TạisaohọkhôngthểchỉnóitiếngViệt", "TisaohkhngthchnitingVit-kjcr8268qyxafd2f1b9g"},
+	{"L 3nenBgumikinpachisensei", "3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+	{"M amuronamie-with-SUPER-MONKEYS", "安室奈美恵-with-SUPER-MONKEYS", "-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n"},
+	{"N Hello-Another-Way-sorezorenobasho", "Hello-Another-Way-それぞれの場所", "Hello-Another-Way--fc4qua05auwb3674vfr0b"},
+	{"O hitotsuyanenoshita2", "ひとつ屋根の下2", "2-u9tlzr9756bt3uc0v"},
+	{"P MajideKoisuru5byoumae", "MajiでKoiする5秒前", "MajiKoi5-783gue6qz075azm5e"},
+	{"Q pafiiderunba", "パフィーdeルンバ", "de-jg4avhby1noc0d"},
+	{"R sonosupiidode", "そのスピードで", "d9juau41awczczp"},
+}
+
+func TestToUnicodeRFC3492(t *testing.T) {
+	for _, tt := range rfc3492Samples {
+		t.Run(tt.name, func(t *testing.T) {
+			// zone names are lowercase, so the mixed case annotations of the samples are not preserved
+			got, err := ToUnicode(acePrefix + tt.punycode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.ToLower(tt.unicode); got != want {
+				t.Errorf("ToUnicode(%q) = %q, want %q", acePrefix+tt.punycode, got, want)
+			}
+		})
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"com", "com", false},
+		{"COM", "com", false},
+		{"xn--p1ai", "xn--p1ai", false},
+		{"рф", "xn--p1ai", false},
+		{"РФ", "xn--p1ai", false},
+		{"中国", "xn--fiqs8s", false},
+		{"みんな", "xn--q9jyb4c", false},
+		{"ελ", "xn--qxam", false},
+		{"онлайн", "xn--80asehdb", false},
+		{"vermögensberater", "xn--vermgensberater-ctb", false},
+		{"a‍b", "", true}, // zero width joiner is not allowed in this context
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ToASCII(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ToASCII(%q) = %q, want error", tt.in, got)
+				}
+				if same := toASCIIOrSame(tt.in); same != tt.in {
+					t.Errorf("toASCIIOrSame(%q) = %q, want the label unchanged", tt.in, same)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ToASCII(%q) unexpected error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ToASCII(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if got == strings.ToLower(tt.in) {
+				return
+			}
+			// round trip back to the lowercase unicode label
+			back, err := ToUnicode(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.ToLower(tt.in); back != want {
+				t.Errorf("ToUnicode(%q) = %q, want %q", got, back, want)
+			}
+		})
+	}
+}
+
+func TestUnicodeTLD(t *testing.T) {
+	tests := []struct {
+		name   string
+		status TLDStatus
+		want   string
+	}{
+		{"ascii", TLDStatus{TLD: "com"}, "com"},
+		{"decoded", TLDStatus{TLD: "xn--p1ai"}, "рф"},
+		{"ulabel from server", TLDStatus{TLD: "xn--p1ai", ULabel: "РФ"}, "РФ"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.UnicodeTLD(); got != tt.want {
+				t.Errorf("TLDStatus.UnicodeTLD() = %q, want %q", got, tt.want)
+			}
+			request := Request{TLD: tt.status.TLD, ULabel: tt.status.ULabel}
+			if got := request.UnicodeTLD(); got != tt.want {
+				t.Errorf("Request.UnicodeTLD() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Package cli holds the helpers shared by the czds command line tools
+package cli
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/lanrat/czds"
+)
+
+// PrintConfig logs the effective configuration from the command line flags and client with secrets redacted
+func PrintConfig(client *czds.Client) {
+	flag.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch f.Name {
+		case "password":
+			value = Redact(value)
+		case "passin":
+			// the pass: source contains the password itself
+			if strings.HasPrefix(value, "pass:") {
+				value = "pass:" + Redact(strings.TrimPrefix(value, "pass:"))
+			}
+		}
+		log.Printf("config: -%s=%q", f.Name, value)
+	})
+	log.Printf("config: auth url: %s", client.AuthURL)
+	log.Printf("config: base url: %s", client.BaseURL)
+}
+
+// Redact hides a secret, empty values are returned unchanged to show that they are not set
+func Redact(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return "[redacted]"
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lanrat/czds"
+)
+
+func TestPrintConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name:    "password is redacted",
+			args:    []string{"-username", "user", "-password", "hunter2", "-parallel", "7"},
+			want:    []string{`-username="user"`, `-password="[redacted]"`, `-parallel="7"`, `-passin=""`},
+			wantNot: []string{"hunter2"},
+		},
+		{
+			name:    "pass: passin is redacted",
+			args:    []string{"-passin", "pass:hunter2"},
+			want:    []string{`-passin="pass:[redacted]"`, `-password=""`},
+			wantNot: []string{"hunter2"},
+		},
+		{
+			name: "other passin sources are shown",
+			args: []string{"-passin", "env:CZDS_SECRET"},
+			want: []string{`-passin="env:CZDS_SECRET"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commandLine := flag.CommandLine
+			t.Cleanup(func() { flag.CommandLine = commandLine })
+			flag.CommandLine = flag.NewFlagSet("test", flag.ContinueOnError)
+			flag.String("username", "", "")
+			flag.String("password", "", "")
+			flag.String("passin", "", "")
+			flag.Int("parallel", 5, "")
+			err := flag.CommandLine.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+			client := czds.NewClient("user", "pass")
+			client.BaseURL = "https://czds.example.com"
+			PrintConfig(client)
+
+			out := buf.String()
+			want := append(tt.want, "base url: https://czds.example.com", "auth url: "+client.AuthURL)
+			for _, s := range want {
+				if !strings.Contains(out, s) {
+					t.Errorf("PrintConfig() output missing %q:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(out, s) {
+					t.Errorf("PrintConfig() output contains %q:\n%s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"hunter2", "[redacted]"},
+	}
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package cli
+
+import "github.com/lanrat/czds"
+
+// NewClient returns a client for the production or test environment
+// with the authURL and baseURL overrides from -authurl and -baseurl when they are set
+func NewClient(username, password string, test bool, authURL, baseURL string) *czds.Client {
+	var client *czds.Client
+	if test {
+		client = czds.NewTestClient(username, password)
+	} else {
+		client = czds.NewClient(username, password)
+	}
+	if len(authURL) != 0 {
+		client.AuthURL = authURL
+	}
+	if len(baseURL) != 0 {
+		client.BaseURL = baseURL
+	}
+	return client
+}
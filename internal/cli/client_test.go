@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/lanrat/czds"
+)
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name             string
+		test             bool
+		authURL, baseURL string
+		wantAuthURL      string
+		wantBaseURL      string
+	}{
+		{"production", false, "", "", czds.AuthURL, czds.BaseURL},
+		{"test", true, "", "", czds.TestAuthURL, czds.TestBaseURL},
+		{"overrides", false, "https://auth.example/api/authenticate", "https://czds.example", "https://auth.example/api/authenticate", "https://czds.example"},
+		{"override test", true, "", "https://czds.example", czds.TestAuthURL, "https://czds.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient("user", "pass", tt.test, tt.authURL, tt.baseURL)
+			if client.AuthURL != tt.wantAuthURL {
+				t.Errorf("AuthURL = %q, want %q", client.AuthURL, tt.wantAuthURL)
+			}
+			if client.BaseURL != tt.wantBaseURL {
+				t.Errorf("BaseURL = %q, want %q", client.BaseURL, tt.wantBaseURL)
+			}
+			if client.Creds.Username != "user" || client.Creds.Password != "pass" {
+				t.Error("credentials were not set")
+			}
+		})
+	}
+}
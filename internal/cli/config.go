@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/lanrat/czds"
+)
+
+// ApplyConfig sets username and password or passin when they are not passed as flags
+// from the CZDS_USERNAME, CZDS_PASSWORD, and CZDS_PASSIN environment variables, then from configFile
+func ApplyConfig(configFile string, username, password, passin *string) error {
+	if len(*username) == 0 {
+		*username = os.Getenv("CZDS_USERNAME")
+	}
+	if len(*password) == 0 && len(*passin) == 0 {
+		*password = os.Getenv("CZDS_PASSWORD")
+		if len(*password) == 0 {
+			*passin = os.Getenv("CZDS_PASSIN")
+		}
+	}
+	if len(*username) > 0 && (len(*password) > 0 || len(*passin) > 0) {
+		return nil
+	}
+	config, err := czds.LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	if len(*username) == 0 {
+		*username = config.Username
+	}
+	if len(*password) == 0 && len(*passin) == 0 {
+		*passin = config.Passin
+	}
+	return nil
+}
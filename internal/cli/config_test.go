@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+func TestApplyConfig(t *testing.T) {
+	type settings struct{ username, password, passin string }
+	tests := []struct {
+		name       string
+		flags      settings
+		env        settings
+		config     string // contents of the config file, not created if empty
+		configFlag bool   // pass the config file with -config instead of using the default
+		want       czds.Credentials
+		wantErr    bool
+	}{
+		{
+			name:   "flags",
+			flags:  settings{"flag-user", "flag-pass", ""},
+			env:    settings{"env-user", "env-pass", ""},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "flag-user", Password: "flag-pass"},
+		},
+		{
+			name:   "flag passin",
+			flags:  settings{"flag-user", "", "pass:flag-passin"},
+			env:    settings{"env-user", "env-pass", ""},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "flag-user", Password: "flag-passin"},
+		},
+		{
+			name:   "env",
+			env:    settings{"env-user", "env-pass", "pass:env-passin"},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "env-user", Password: "env-pass"},
+		},
+		{
+			name:   "env passin",
+			env:    settings{"env-user", "", "pass:env-passin"},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "env-user", Password: "env-passin"},
+		},
+		{
+			name:   "default config",
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "config-user", Password: "config-pass"},
+		},
+		{
+			name:       "config flag",
+			config:     `{"username": "config-user", "passin": "pass:config-pass"}`,
+			configFlag: true,
+			want:       czds.Credentials{Username: "config-user", Password: "config-pass"},
+		},
+		{
+			name:   "flag username, env password, config ignored",
+			flags:  settings{"flag-user", "", ""},
+			env:    settings{"", "env-pass", ""},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "flag-user", Password: "env-pass"},
+		},
+		{
+			name:   "env username, config password",
+			env:    settings{"env-user", "", ""},
+			config: `{"username": "config-user", "passin": "pass:config-pass"}`,
+			want:   czds.Credentials{Username: "env-user", Password: "config-pass"},
+		},
+		{
+			name:       "missing config flag",
+			configFlag: true,
+			wantErr:    true,
+		},
+		{
+			name:    "invalid config",
+			config:  `username: config-user`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("CZDS_USERNAME", tt.env.username)
+			t.Setenv("CZDS_PASSWORD", tt.env.password)
+			t.Setenv("CZDS_PASSIN", tt.env.passin)
+			configFile := filepath.Join(home, czds.DefaultConfigFile)
+			if tt.configFlag {
+				configFile = filepath.Join(t.TempDir(), "czds.json")
+			}
+			if len(tt.config) > 0 {
+				err := os.WriteFile(configFile, []byte(tt.config), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			configFlag := ""
+			if tt.configFlag {
+				configFlag = configFile
+			}
+
+			username, password, passin := tt.flags.username, tt.flags.password, tt.flags.passin
+			err := ApplyConfig(configFlag, &username, &password, &passin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyConfig() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			password, err = Password(context.Background(), password, passin)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the resolved credentials are the ones sent to the server
+			var got czds.Credentials
+			token := clitest.JWT(t)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+				json.NewEncoder(w).Encode(map[string]string{"accessToken": token, "message": "ok"})
+			}))
+			defer ts.Close()
+			client := NewClient(username, password, false, ts.URL+"/api/authenticate", ts.URL)
+			err = client.Authenticate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("authenticated as %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
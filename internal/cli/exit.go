@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/lanrat/czds"
+)
+
+// exit statuses of all of the commands
+const (
+	ExitError   = 1 // any other error
+	ExitAuth    = 2 // unable to authenticate
+	ExitNetwork = 3 // network error, server error, or rate limited, running again may succeed
+	ExitPartial = 4 // some of the work failed
+	ExitUsage   = 5 // invalid flags
+)
+
+// ParseFlags parses the command line flags, exiting with ExitUsage on invalid flags
+// instead of the flag package's default status of 2, which is ExitAuth
+func ParseFlags() {
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	err := flag.CommandLine.Parse(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(ExitUsage)
+	}
+}
+
+// Fatal logs err and exits with the status for its class of error
+func Fatal(err error) {
+	log.Print(err)
+	os.Exit(ExitStatus(err))
+}
+
+// FatalPartial is like Fatal, but exits with ExitPartial if any of the work succeeded before err
+func FatalPartial(err error, succeeded int) {
+	if succeeded > 0 {
+		log.Print(err)
+		os.Exit(ExitPartial)
+	}
+	Fatal(err)
+}
+
+// ExitStatus returns the exit status for err
+// network and server errors while authenticating are ExitNetwork as running again may succeed
+func ExitStatus(err error) int {
+	var netErr net.Error
+	var rateLimitErr *czds.RateLimitError
+	var authErr *czds.AuthError
+	var apiErr *czds.APIError
+	isAPIErr := errors.As(err, &apiErr)
+	switch {
+	case errors.As(err, &netErr), errors.As(err, &rateLimitErr), errors.Is(err, czds.ErrCircuitOpen):
+		return ExitNetwork
+	case isAPIErr && apiErr.StatusCode >= http.StatusInternalServerError:
+		return ExitNetwork
+	case errors.As(err, &authErr), isAPIErr && apiErr.StatusCode == http.StatusUnauthorized:
+		return ExitAuth
+	}
+	return ExitError
+}
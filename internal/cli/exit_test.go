@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/internal/clitest"
+)
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		authStatus int  // status of the authentication, 0 for success
+		apiStatus  int  // status of the API request, 0 for success
+		closed     bool // the server is not listening
+		want       int
+	}{
+		{"authentication rejected", http.StatusUnauthorized, 0, false, ExitAuth},
+		{"authentication server error", http.StatusBadGateway, 0, false, ExitNetwork},
+		{"token rejected", 0, http.StatusUnauthorized, false, ExitAuth},
+		{"server error", 0, http.StatusInternalServerError, false, ExitNetwork},
+		{"unavailable", 0, http.StatusServiceUnavailable, false, ExitNetwork},
+		{"rate limited", 0, http.StatusTooManyRequests, false, ExitNetwork},
+		{"not found", 0, http.StatusNotFound, false, ExitError},
+		{"bad request", 0, http.StatusBadRequest, false, ExitError},
+		{"connection refused", 0, 0, true, ExitNetwork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := clitest.JWT(t)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/authenticate", func(w http.ResponseWriter, r *http.Request) {
+				if tt.authStatus != 0 {
+					http.Error(w, "authentication failed", tt.authStatus)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]string{"accessToken": token, "message": "ok"})
+			})
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				if tt.apiStatus != 0 {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, http.StatusText(tt.apiStatus), tt.apiStatus)
+					return
+				}
+				w.Write([]byte("[]"))
+			})
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+			client := NewClient("user", "pass", false, ts.URL+"/api/authenticate", ts.URL)
+			client.RetryDelay = time.Millisecond
+			if tt.closed {
+				ts.Close()
+			}
+
+			_, err := client.GetTLDStatus()
+			if err == nil {
+				t.Fatal("GetTLDStatus() succeeded")
+			}
+			if got := ExitStatus(err); got != tt.want {
+				t.Errorf("ExitStatus(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitStatusWrapped(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"circuit open", fmt.Errorf("download com: %w", czds.ErrCircuitOpen), ExitNetwork},
+		{"auth", fmt.Errorf("request: %w", &czds.AuthError{Err: fmt.Errorf("bad password")}), ExitAuth},
+		{"other", fmt.Errorf("unable to write zone"), ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitStatus(tt.err); got != tt.want {
+				t.Errorf("ExitStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OutputFormat is the format of a command's output, selected with -format
+type OutputFormat string
+
+// output formats, the json output of each command is a documented type in that command or the czds package
+const (
+	FormatText OutputFormat = "text"
+	FormatJSON OutputFormat = "json"
+	FormatCSV  OutputFormat = "csv"
+)
+
+// ParseFormat returns the OutputFormat named s, which must be one of allowed
+func ParseFormat(s string, allowed ...OutputFormat) (OutputFormat, error) {
+	names := make([]string, 0, len(allowed))
+	for _, f := range allowed {
+		if strings.EqualFold(s, string(f)) {
+			return f, nil
+		}
+		names = append(names, string(f))
+	}
+	switch len(names) {
+	case 1:
+		return "", fmt.Errorf("must be %s", names[0])
+	case 2:
+		return "", fmt.Errorf("must be %s or %s", names[0], names[1])
+	}
+	return "", fmt.Errorf("must be %s, or %s", strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+// PrintJSON writes v to stdout as indented JSON
+func PrintJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,40 @@
+package cli
+
+import "testing"
+
+func TestParseFormat(t *testing.T) {
+	all := []OutputFormat{FormatText, FormatJSON, FormatCSV}
+	tests := []struct {
+		name    string
+		in      string
+		allowed []OutputFormat
+		want    OutputFormat
+		wantErr string
+	}{
+		{"text", "text", all, FormatText, ""},
+		{"json", "json", all, FormatJSON, ""},
+		{"csv", "csv", all, FormatCSV, ""},
+		{"case insensitive", "JSON", all, FormatJSON, ""},
+		{"unknown", "xml", all, "", "must be text, json, or csv"},
+		{"not allowed", "csv", []OutputFormat{FormatText, FormatJSON}, "", "must be text or json"},
+		{"single", "text", []OutputFormat{FormatJSON}, "", "must be json"},
+		{"empty", "", all, "", "must be text, json, or csv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.in, tt.allowed...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ParseFormat(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFormat(%q) unexpected error: %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
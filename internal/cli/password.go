@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/lanrat/czds"
+)
+
+// Password returns password, or reads it from the passin source if it is empty
+// the tty prompt is cancelled when ctx is done or on an interrupt
+func Password(ctx context.Context, password, passin string) (string, error) {
+	if len(password) > 0 {
+		return password, nil
+	}
+	return czds.GetpassWithContext(ctx, passin)
+}
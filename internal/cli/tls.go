@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"crypto/tls"
+	"log"
+
+	"github.com/lanrat/czds"
+)
+
+// TLSConfig returns the TLS settings from the -cacert and -insecure flags, or nil if neither is set
+func TLSConfig(caCert string, insecure bool) (*tls.Config, error) {
+	if len(caCert) == 0 && !insecure {
+		return nil, nil
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if len(caCert) > 0 {
+		pool, err := czds.LoadCertPool(caCert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if insecure {
+		log.Printf("WARNING: -insecure disables TLS certificate verification, connections can be intercepted! Only use it with test environments")
+		config.InsecureSkipVerify = true
+	}
+	return config, nil
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lanrat/czds"
+)
+
+func TestTLSConfig(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	// the rejected handshakes are logged by the server, keep them out of the logs checked for the warning
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+	dir := t.TempDir()
+	caCert := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "not.pem")
+	err = os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		caCert      string
+		insecure    bool
+		wantNil     bool // no TLS settings
+		wantErr     bool // TLSConfig fails
+		wantConnect bool
+		wantWarning bool
+	}{
+		{"default", "", false, true, false, false, false},
+		{"custom ca", caCert, false, false, false, true, false},
+		{"insecure", "", true, false, false, true, true},
+		{"missing ca file", filepath.Join(dir, "missing.pem"), false, false, true, false, false},
+		{"ca file without certificates", notPEM, false, false, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+			config, err := TLSConfig(tt.caCert, tt.insecure)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TLSConfig() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (config == nil) != tt.wantNil {
+				t.Fatalf("TLSConfig() = %v, want nil: %t", config, tt.wantNil)
+			}
+			if config != nil && config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", config.MinVersion)
+			}
+			if warned := strings.Contains(logs.String(), "WARNING"); warned != tt.wantWarning {
+				t.Errorf("warning logged: %t, want %t", warned, tt.wantWarning)
+			}
+
+			hc := czds.NewHTTPClient(&czds.HTTPClientOptions{TLSConfig: config})
+			resp, err := hc.Get(ts.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if connected := err == nil; connected != tt.wantConnect {
+				t.Errorf("connected: %t, want %t, err: %v", connected, tt.wantConnect, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadZonesFile reads a list of zones from the file at path, or stdin if path is "-"
+// one zone per line, blank lines and anything after a '#' are ignored
+func ReadZonesFile(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read zones from %q: %w", path, err)
+	}
+	zones := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if len(line) != 0 {
+			zones = append(zones, line)
+		}
+	}
+	return zones, nil
+}
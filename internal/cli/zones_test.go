@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadZonesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		stdin   bool
+		want    []string
+	}{
+		{"one per line", "com\nnet\n", false, []string{"com", "net"}},
+		{"comments and blank lines", "# zones\ncom # main\n\n\t\n#net\norg", false, []string{"com", "org"}},
+		{"crlf", "com\r\nnet\r\n", false, []string{"com", "net"}},
+		{"duplicates are kept for RequestTLDs to remove", "com\ncom\n", false, []string{"com", "com"}},
+		{"empty", "# nothing\n", false, []string{}},
+		{"stdin", "com\nnet\n", true, []string{"com", "net"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "zones.txt")
+			err := os.WriteFile(path, []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stdin {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+				path = "-"
+			}
+			got, err := ReadZonesFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ReadZonesFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadZonesFileMissing(t *testing.T) {
+	_, err := ReadZonesFile(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadZonesFile() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
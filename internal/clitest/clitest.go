@@ -0,0 +1,107 @@
+// Package clitest holds the test helpers shared by the czds command line tools
+package clitest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lanrat/czds"
+	"github.com/lanrat/czds/jwt"
+)
+
+// JWT returns an unsigned authentication token that expires in an hour
+func JWT(t testing.TB) string {
+	t.Helper()
+	header, err := json.Marshal(jwt.Header{Alg: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(jwt.Data{Exp: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(header) + "." + enc.EncodeToString(data) + "." + enc.EncodeToString([]byte("sig"))
+}
+
+// AuthHandler returns a handler for /api/authenticate that accepts any credentials with token
+func AuthHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"accessToken": token, "message": "ok"})
+	}
+}
+
+// NewClient starts a fake CZDS server for mux, which also serves authentication,
+// and points *client at it until the test ends, the server's URL is returned
+func NewClient(t testing.TB, mux *http.ServeMux, client **czds.Client) string {
+	t.Helper()
+	mux.HandleFunc("/api/authenticate", AuthHandler(JWT(t)))
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	*client = czds.NewClient("user", "pass")
+	(*client).AuthURL = ts.URL + "/api/authenticate"
+	(*client).BaseURL = ts.URL
+	t.Cleanup(func() { *client = nil })
+	return ts.URL
+}
+
+// RunMain runs main as the command name with args and then resets every flag of the command to its default
+// the credentials and config file of the user running the tests are hidden from main
+func RunMain(t testing.TB, main func(), name string, args ...string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	for _, env := range []string{"CZDS_USERNAME", "CZDS_PASSWORD", "CZDS_PASSIN"} {
+		t.Setenv(env, "")
+	}
+	osArgs := os.Args
+	os.Args = append([]string{name}, args...)
+	defer func() {
+		os.Args = osArgs
+		flag.VisitAll(func(f *flag.Flag) {
+			if !strings.HasPrefix(f.Name, "test.") {
+				f.Value.Set(f.DefValue)
+			}
+		})
+	}()
+	main()
+}
+
+// CaptureStdout returns everything f writes to stdout
+func CaptureStdout(t testing.TB, f func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stdout, f)
+}
+
+// CaptureStderr returns everything f writes to stderr
+func CaptureStderr(t testing.TB, f func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stderr, f)
+}
+
+// captureFile replaces *file with a pipe while f runs and returns everything written to it
+func captureFile(t testing.TB, file **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *file
+	*file = w
+	defer func() { *file = orig }()
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-out
+}
@@ -43,7 +43,8 @@ func DecodeJWT(jwtStr string) (*Token, error) {
 	token := &Token{}
 	parts := strings.Split(jwtStr, ".")
 	if len(parts) != 3 {
-		return token, fmt.Errorf("JWT Token has %d parts not 3: %s", len(parts), jwtStr)
+		// do not include the token in the error as it may be logged
+		return token, fmt.Errorf("JWT Token has %d parts not 3", len(parts))
 	}
 	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
 	if err != nil {
@@ -1,5 +1,11 @@
 package czds
 
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
 // Logger specifies the methods required for the verbose logger for the API
 type Logger interface {
 	Printf(format string, v ...interface{})
@@ -11,8 +17,34 @@ func (c *Client) SetLogger(l Logger) {
 	c.log = l
 }
 
+// SetSlogLogger enables verbose structured logging for most API calls with the provided logger
+// messages are logged at slog.LevelDebug, defaults to nil/off.
+func (c *Client) SetSlogLogger(l *slog.Logger) {
+	c.slog = l
+}
+
 func (c *Client) v(format string, v ...interface{}) {
 	if c.log != nil {
 		c.log.Printf(format, v...)
 	}
+	if c.slog != nil {
+		c.slog.Debug(fmt.Sprintf(format, v...))
+	}
+}
+
+// vAttrs logs msg with the provided attributes as structured fields to the slog logger
+// and as key=value pairs to the Printf logger
+func (c *Client) vAttrs(msg string, attrs ...slog.Attr) {
+	if c.log != nil {
+		format := msg
+		args := make([]interface{}, 0, len(attrs))
+		for _, attr := range attrs {
+			format += " " + attr.Key + "=%v"
+			args = append(args, attr.Value)
+		}
+		c.log.Printf(format, args...)
+	}
+	if c.slog != nil {
+		c.slog.LogAttrs(context.Background(), slog.LevelDebug, msg, attrs...)
+	}
 }
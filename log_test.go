@@ -0,0 +1,177 @@
+package czds
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// recordingHandler is a slog.Handler that records every message with its attributes
+type recordingHandler struct {
+	mutex   sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+// find returns the attributes of the records with msg
+func (h *recordingHandler) find(msg string) []map[string]string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	var out []map[string]string
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]string)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value.String()
+			return true
+		})
+		out = append(out, attrs)
+	}
+	return out
+}
+
+// printfLogger is a Logger that records every line
+type printfLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *printfLogger) Printf(format string, v ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestSlogLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32 // number of malformed responses before success
+	}{
+		{"first attempt", 0},
+		{"after a retry", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					// send a malformed response so that the request fails and is retried
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					conn.Write([]byte("HTTP/1.1 bogus\r\n\r\n"))
+					conn.Close()
+					return
+				}
+				writeJSON(t, w, []TLDStatus{})
+			})
+			ts, c := newTestServer(t, mux)
+			h := &recordingHandler{}
+			c.SetSlogLogger(slog.New(h))
+			l := &printfLogger{}
+			c.SetLogger(l)
+
+			_, err := c.GetTLDStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			url := ts.URL + "/czds/tlds"
+			var got map[string]string
+			for _, attrs := range h.find("HTTP API Response") {
+				if attrs["url"] == url {
+					got = attrs
+				}
+			}
+			want := map[string]string{
+				"method":  "GET",
+				"url":     url,
+				"attempt": fmt.Sprint(tt.failures + 1),
+				"status":  "200",
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("HTTP API Response attributes = %v, want %v", got, want)
+			}
+			if errs := len(h.find("HTTP API Request error")); errs != int(tt.failures) {
+				t.Errorf("logged %d request errors, want %d", errs, tt.failures)
+			}
+
+			// the Printf logger still gets the same message with the attributes inline
+			line := fmt.Sprintf("HTTP API Response method=GET url=%s attempt=%d status=200", url, tt.failures+1)
+			found := false
+			for _, l := range l.lines {
+				found = found || strings.Contains(l, line)
+			}
+			if !found {
+				t.Errorf("Printf logger missing %q in:\n%s", line, strings.Join(l.lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestLogRedaction(t *testing.T) {
+	var unauthorized atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		// reject the first token to also log the reauthentication
+		if unauthorized.CompareAndSwap(false, true) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		writeJSON(t, w, []TLDStatus{})
+	})
+	mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	ts, c := newTestServer(t, mux)
+	ts.claims.Email = "user@example.com"
+	c.Creds.Password = "hunter2-password"
+	var buf strings.Builder
+	c.SetSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l := &printfLogger{}
+	c.SetLogger(l)
+
+	_, err := c.GetTLDStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SubmitRequest(&RequestSubmission{TLDNames: []string{"com"}, Reason: "test"})
+	_, _ = c.WhoAmI()
+	token := c.accessToken()
+	if len(token) == 0 {
+		t.Fatal("no access token")
+	}
+	if n := ts.auths.Load(); n != 2 {
+		t.Errorf("authenticated %d times, want 2", n)
+	}
+	out := buf.String() + strings.Join(l.lines, "\n")
+	for _, secret := range []string{token, "hunter2-password", "Bearer"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output contains %q:\n%s", secret, out)
+		}
+	}
+	for _, s := range []string{fmt.Sprintf("%v", c.Creds), fmt.Sprintf("%+v", c.Creds), fmt.Sprintf("%#v", c.Creds)} {
+		if strings.Contains(s, "hunter2-password") {
+			t.Errorf("formatted credentials contain the password: %s", s)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package czds
+
+import "time"
+
+// Metrics receives observations about the API requests and zone downloads made by a Client.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after every HTTP request attempt, status is 0 if no response was received
+	ObserveRequest(method, path string, status int, duration time.Duration)
+	// ObserveDownload is called after every zone download
+	ObserveDownload(zone string, bytes int64, duration time.Duration, err error)
+}
+
+// NoopMetrics is the default Metrics implementation which discards all observations
+type NoopMetrics struct{}
+
+// ObserveRequest does nothing
+func (NoopMetrics) ObserveRequest(string, string, int, time.Duration) {}
+
+// ObserveDownload does nothing
+func (NoopMetrics) ObserveDownload(string, int64, time.Duration, error) {}
+
+func (c *Client) metrics() Metrics {
+	if c.Metrics != nil {
+		return c.Metrics
+	}
+	return NoopMetrics{}
+}
@@ -0,0 +1,90 @@
+package czds
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type observedRequest struct {
+	method string
+	path   string
+	status int
+}
+
+type observedDownload struct {
+	zone  string
+	bytes int64
+	err   bool
+}
+
+// recordingMetrics records every observation
+type recordingMetrics struct {
+	mutex     sync.Mutex
+	requests  []observedRequest
+	downloads []observedDownload
+}
+
+func (m *recordingMetrics) ObserveRequest(method, path string, status int, duration time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, observedRequest{method, path, status})
+}
+
+func (m *recordingMetrics) ObserveDownload(zone string, bytes int64, duration time.Duration, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.downloads = append(m.downloads, observedDownload{zone, bytes, err != nil})
+}
+
+func TestMetrics(t *testing.T) {
+	zone := gzipZone(t, "com zone")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, []TLDStatus{})
+	})
+	mux.Handle("/czds/downloads/", &zoneHandler{zones: map[string][]byte{"com": zone}, gets: make(map[string]int), since: make(map[string]string)})
+	ts, c := newTestServer(t, mux)
+	m := &recordingMetrics{}
+	c.Metrics = m
+
+	_, err := c.GetTLDStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.GetRequestInfo("missing")
+	if err == nil {
+		t.Fatal("GetRequestInfo() of a missing request returned no error")
+	}
+	var buf bytes.Buffer
+	_, err = c.DownloadZoneToWriter(ts.URL+"/czds/downloads/com.zone", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.DownloadZoneToWriter(ts.URL+"/czds/downloads/net.zone", io.Discard)
+	if err == nil {
+		t.Fatal("DownloadZoneToWriter() of a missing zone returned no error")
+	}
+
+	wantRequests := []observedRequest{
+		{"POST", "/api/authenticate", http.StatusOK},
+		{"GET", "/czds/tlds", http.StatusOK},
+		{"GET", "/czds/requests/missing", http.StatusNotFound},
+		{"GET", "/czds/downloads/com.zone", http.StatusOK},
+		{"GET", "/czds/downloads/net.zone", http.StatusNotFound},
+	}
+	if !reflect.DeepEqual(m.requests, wantRequests) {
+		t.Errorf("observed requests %v, want %v", m.requests, wantRequests)
+	}
+	wantDownloads := []observedDownload{
+		{"com", int64(len(zone)), false},
+		{"net", 0, true},
+	}
+	if !reflect.DeepEqual(m.downloads, wantDownloads) {
+		t.Errorf("observed downloads %v, want %v", m.downloads, wantDownloads)
+	}
+}
@@ -0,0 +1,156 @@
+// Package prometheus implements a czds.Metrics collector that exposes its metrics in the Prometheus text format
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lanrat/czds"
+)
+
+var _ czds.Metrics = (*Collector)(nil)
+
+// Collector records czds.Metrics observations and serves them to Prometheus as an http.Handler.
+// Zone names and request IDs are not used as labels to keep the number of series bounded.
+type Collector struct {
+	mutex             sync.Mutex
+	requests          map[requestKey]int64
+	requestDurations  map[string]*summary
+	downloads         map[string]int64
+	downloadBytes     int64
+	downloadDurations summary
+}
+
+type requestKey struct {
+	method string
+	path   string
+	status int
+}
+
+type summary struct {
+	sum   float64
+	count int64
+}
+
+// NewCollector returns a new empty Collector
+func NewCollector() *Collector {
+	return &Collector{
+		requests:         make(map[requestKey]int64),
+		requestDurations: make(map[string]*summary),
+		downloads:        make(map[string]int64),
+	}
+}
+
+// ObserveRequest records an API request
+func (c *Collector) ObserveRequest(method, path string, status int, duration time.Duration) {
+	path = normalizePath(path)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requests[requestKey{method: method, path: path, status: status}]++
+	durationKey := labels("method", method, "path", path)
+	if c.requestDurations[durationKey] == nil {
+		c.requestDurations[durationKey] = &summary{}
+	}
+	c.requestDurations[durationKey].sum += duration.Seconds()
+	c.requestDurations[durationKey].count++
+}
+
+// ObserveDownload records a zone download
+func (c *Collector) ObserveDownload(_ string, bytes int64, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.downloads[result]++
+	c.downloadBytes += bytes
+	c.downloadDurations.sum += duration.Seconds()
+	c.downloadDurations.count++
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteMetrics(w)
+}
+
+// WriteMetrics writes all metrics in the Prometheus text format to w
+func (c *Collector) WriteMetrics(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fmt.Fprintln(w, "# HELP czds_api_requests_total Total number of CZDS API requests.")
+	fmt.Fprintln(w, "# TYPE czds_api_requests_total counter")
+	requestLines := make([]string, 0, len(c.requests))
+	for key, count := range c.requests {
+		requestLines = append(requestLines, fmt.Sprintf("czds_api_requests_total%s %d",
+			labels("method", key.method, "path", key.path, "status", fmt.Sprint(key.status)), count))
+	}
+	writeSorted(w, requestLines)
+
+	fmt.Fprintln(w, "# HELP czds_api_request_duration_seconds Duration of CZDS API requests.")
+	fmt.Fprintln(w, "# TYPE czds_api_request_duration_seconds summary")
+	durationLines := make([]string, 0, 2*len(c.requestDurations))
+	for key, s := range c.requestDurations {
+		durationLines = append(durationLines,
+			fmt.Sprintf("czds_api_request_duration_seconds_sum%s %g", key, s.sum),
+			fmt.Sprintf("czds_api_request_duration_seconds_count%s %d", key, s.count))
+	}
+	writeSorted(w, durationLines)
+
+	fmt.Fprintln(w, "# HELP czds_downloads_total Total number of zone downloads.")
+	fmt.Fprintln(w, "# TYPE czds_downloads_total counter")
+	downloadLines := make([]string, 0, len(c.downloads))
+	for result, count := range c.downloads {
+		downloadLines = append(downloadLines, fmt.Sprintf("czds_downloads_total%s %d", labels("result", result), count))
+	}
+	writeSorted(w, downloadLines)
+
+	fmt.Fprintln(w, "# HELP czds_download_bytes_total Total number of zone bytes downloaded.")
+	fmt.Fprintln(w, "# TYPE czds_download_bytes_total counter")
+	fmt.Fprintf(w, "czds_download_bytes_total %d\n", c.downloadBytes)
+
+	fmt.Fprintln(w, "# HELP czds_download_duration_seconds Duration of zone downloads.")
+	fmt.Fprintln(w, "# TYPE czds_download_duration_seconds summary")
+	fmt.Fprintf(w, "czds_download_duration_seconds_sum %g\n", c.downloadDurations.sum)
+	fmt.Fprintf(w, "czds_download_duration_seconds_count %d\n", c.downloadDurations.count)
+}
+
+func writeSorted(w io.Writer, lines []string) {
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// labels formats the name value pairs as a Prometheus label set
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", pairs[i], pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// normalizePath replaces the zone names and request IDs in API paths with placeholders
+func normalizePath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/czds/downloads/") && path != "/czds/downloads/links":
+		return "/czds/downloads/{zone}"
+	case strings.HasPrefix(path, "/czds/requests/extension/"):
+		return "/czds/requests/extension/{id}"
+	case strings.HasPrefix(path, "/czds/requests/"):
+		switch strings.TrimPrefix(path, "/czds/requests/") {
+		case "all", "create", "cancel", "report":
+			return path
+		}
+		return "/czds/requests/{id}"
+	}
+	return path
+}
@@ -0,0 +1,64 @@
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/czds/downloads/links", "/czds/downloads/links"},
+		{"/czds/downloads/com.zone", "/czds/downloads/{zone}"},
+		{"/czds/requests/all", "/czds/requests/all"},
+		{"/czds/requests/report", "/czds/requests/report"},
+		{"/czds/requests/abc-123", "/czds/requests/{id}"},
+		{"/czds/requests/extension/abc-123", "/czds/requests/extension/{id}"},
+		{"/czds/tlds", "/czds/tlds"},
+		{"/api/authenticate", "/api/authenticate"},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.path); got != tt.want {
+			t.Errorf("normalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	c.ObserveRequest("GET", "/czds/requests/abc", http.StatusOK, time.Second)
+	c.ObserveRequest("GET", "/czds/requests/def", http.StatusOK, 2*time.Second)
+	c.ObserveRequest("POST", "/czds/requests/all", http.StatusTooManyRequests, time.Second)
+	c.ObserveDownload("com", 100, time.Second, nil)
+	c.ObserveDownload("net", 50, 3*time.Second, errors.New("failed"))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		`czds_api_requests_total{method="GET",path="/czds/requests/{id}",status="200"} 2`,
+		`czds_api_requests_total{method="POST",path="/czds/requests/all",status="429"} 1`,
+		`czds_api_request_duration_seconds_sum{method="GET",path="/czds/requests/{id}"} 3`,
+		`czds_api_request_duration_seconds_count{method="GET",path="/czds/requests/{id}"} 2`,
+		`czds_downloads_total{result="error"} 1`,
+		`czds_downloads_total{result="success"} 1`,
+		`czds_download_bytes_total 150`,
+		`czds_download_duration_seconds_sum 4`,
+		`czds_download_duration_seconds_count 2`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "com") || strings.Contains(out, "abc") {
+		t.Errorf("metrics contain zone names or request IDs:\n%s", out)
+	}
+}
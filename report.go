@@ -0,0 +1,128 @@
+package czds
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ReportRow is a single request from the CSV report saved by DownloadAllRequests
+type ReportRow struct {
+	TLD    string            `json:"tld"`
+	Status string            `json:"status"`
+	Fields map[string]string `json:"fields"` // all of the columns of the row keyed by the header
+}
+
+// ReportChange is a TLD whose status differs between two reports
+type ReportChange struct {
+	TLD       string `json:"tld"`
+	OldStatus string `json:"oldStatus"`
+	NewStatus string `json:"newStatus"`
+}
+
+// ReportDiff holds the differences between two reports
+type ReportDiff struct {
+	Added   []ReportRow    `json:"added"`   // TLDs only in the new report
+	Removed []ReportRow    `json:"removed"` // TLDs only in the old report
+	Changed []ReportChange `json:"changed"` // TLDs in both reports with a different status
+}
+
+// ParseReport parses the CSV report saved by DownloadAllRequests
+// the report must have a header row with "TLD" and "Status" columns
+func ParseReport(r io.Reader) ([]ReportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read report header: %w", err)
+	}
+	tldCol, statusCol := -1, -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+		switch strings.ToLower(header[i]) {
+		case "tld":
+			tldCol = i
+		case "status":
+			statusCol = i
+		}
+	}
+	if tldCol < 0 || statusCol < 0 {
+		return nil, fmt.Errorf("report header %q is missing the TLD or Status column", header)
+	}
+
+	rows := make([]ReportRow, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return rows, err
+		}
+		if len(record) <= tldCol || len(record) <= statusCol {
+			continue
+		}
+		row := ReportRow{
+			TLD:    strings.TrimSpace(record[tldCol]),
+			Status: strings.TrimSpace(record[statusCol]),
+			Fields: make(map[string]string, len(header)),
+		}
+		for i, value := range record {
+			if i < len(header) {
+				row.Fields[header[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// DiffReports returns the TLDs that were added, removed, or changed status between the old and new reports
+// TLDs are compared ignoring case, if a TLD is in a report more than once only its first row is used
+func DiffReports(old, new []ReportRow) ReportDiff {
+	oldMap := reportMap(old)
+	newMap := reportMap(new)
+	diff := ReportDiff{
+		Added:   make([]ReportRow, 0),
+		Removed: make([]ReportRow, 0),
+		Changed: make([]ReportChange, 0),
+	}
+	for tld, row := range newMap {
+		oldRow, ok := oldMap[tld]
+		if !ok {
+			diff.Added = append(diff.Added, row)
+			continue
+		}
+		if !strings.EqualFold(oldRow.Status, row.Status) {
+			diff.Changed = append(diff.Changed, ReportChange{
+				TLD:       row.TLD,
+				OldStatus: oldRow.Status,
+				NewStatus: row.Status,
+			})
+		}
+	}
+	for tld, row := range oldMap {
+		if _, ok := newMap[tld]; !ok {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].TLD < diff.Added[j].TLD })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].TLD < diff.Removed[j].TLD })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].TLD < diff.Changed[j].TLD })
+	return diff
+}
+
+// reportMap returns the first row for each TLD keyed by the lowercase TLD
+func reportMap(rows []ReportRow) map[string]ReportRow {
+	out := make(map[string]ReportRow, len(rows))
+	for _, row := range rows {
+		tld := strings.ToLower(row.TLD)
+		if _, ok := out[tld]; !ok {
+			out[tld] = row
+		}
+	}
+	return out
+}
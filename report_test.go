@@ -0,0 +1,148 @@
+package czds
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const oldReport = `"TLD","Status","Created"
+"com","Approved","2024-01-01"
+"net","Pending","2024-01-02"
+"org","Approved","2024-01-03"
+"info","Denied","2024-01-04"
+`
+
+const newReport = `TLD,Status,Created
+COM,Approved,2024-01-01
+net,Approved,2024-01-02
+info,Denied,2024-01-04
+xyz,Pending,2024-02-01
+xyz,Approved,2024-01-01
+`
+
+func TestParseReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  string
+		want    []ReportRow
+		wantErr bool
+	}{
+		{
+			name:   "quoted",
+			report: "\"TLD\",\"Status\",\"Created\"\n\"com\",\"Approved\",\"2024-01-01\"\n",
+			want:   []ReportRow{{TLD: "com", Status: "Approved", Fields: map[string]string{"TLD": "com", "Status": "Approved", "Created": "2024-01-01"}}},
+		},
+		{
+			name:   "columns in any order",
+			report: "status, tld\nPending, net\n",
+			want:   []ReportRow{{TLD: "net", Status: "Pending", Fields: map[string]string{"status": "Pending", "tld": " net"}}},
+		},
+		{
+			name:   "short rows are skipped",
+			report: "TLD,Status\ncom\nnet,Pending\n",
+			want:   []ReportRow{{TLD: "net", Status: "Pending", Fields: map[string]string{"TLD": "net", "Status": "Pending"}}},
+		},
+		{"missing status column", "TLD,Created\ncom,2024-01-01\n", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReport(strings.NewReader(tt.report))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseReport() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseReport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffReports(t *testing.T) {
+	// the new report is downloaded from the server as it is by czds-status -diff
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/report", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(newReport))
+	})
+	_, c := newTestServer(t, mux)
+	var b bytes.Buffer
+	err := c.DownloadAllRequests(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRows, err := ParseReport(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRows, err := ParseReport(strings.NewReader(oldReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		old, new []ReportRow
+		added    []string
+		removed  []string
+		changed  []ReportChange
+	}{
+		{
+			name:    "added, removed, and changed",
+			old:     oldRows,
+			new:     newRows,
+			added:   []string{"xyz"},
+			removed: []string{"org"},
+			changed: []ReportChange{{TLD: "net", OldStatus: "Pending", NewStatus: "Approved"}},
+		},
+		{
+			name:    "reversed",
+			old:     newRows,
+			new:     oldRows,
+			added:   []string{"org"},
+			removed: []string{"xyz"},
+			changed: []ReportChange{{TLD: "net", OldStatus: "Approved", NewStatus: "Pending"}},
+		},
+		{
+			name:    "unchanged",
+			old:     oldRows,
+			new:     oldRows,
+			added:   []string{},
+			removed: []string{},
+			changed: []ReportChange{},
+		},
+		{
+			name:    "empty old report",
+			old:     nil,
+			new:     oldRows,
+			added:   []string{"com", "info", "net", "org"},
+			removed: []string{},
+			changed: []ReportChange{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffReports(tt.old, tt.new)
+			if got := reportTLDs(diff.Added); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("Added = %v, want %v", got, tt.added)
+			}
+			if got := reportTLDs(diff.Removed); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("Removed = %v, want %v", got, tt.removed)
+			}
+			if !reflect.DeepEqual(diff.Changed, tt.changed) {
+				t.Errorf("Changed = %+v, want %+v", diff.Changed, tt.changed)
+			}
+		})
+	}
+}
+
+// reportTLDs returns the TLD of each row
+func reportTLDs(rows []ReportRow) []string {
+	tlds := make([]string, 0, len(rows))
+	for _, row := range rows {
+		tlds = append(tlds, row.TLD)
+	}
+	return tlds
+}
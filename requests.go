@@ -1,9 +1,14 @@
 package czds
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -52,6 +57,9 @@ const (
 // 0 disables the check
 const expiryDateThreshold = 120
 
+// maximum number of concurrent requests used to check if requests are extensible
+const extensibleProbeWorkers = 8
+
 // used in RequestExtension
 var emptyStruct, _ = json.Marshal(make(map[int]int))
 
@@ -153,6 +161,11 @@ type Terms struct {
 	Created    time.Time `json:"created"`
 }
 
+// autoRenewSubmission is the payload sent by SetAutoRenew()
+type autoRenewSubmission struct {
+	AutoRenew bool `json:"autoRenew"`
+}
+
 // CancelRequestSubmission Request cancellation arguments passed to CancelRequest()
 type CancelRequestSubmission struct {
 	RequestID string `json:"integrationId"` // This is effectively 'requestId'
@@ -162,65 +175,332 @@ type CancelRequestSubmission struct {
 // GetRequests searches for the status of zones requests as seen on the
 // CZDS dashboard page "https://czds.icann.org/zone-requests/all"
 func (c *Client) GetRequests(filter *RequestsFilter) (*RequestsResponse, error) {
+	return c.GetRequestsWithContext(context.Background(), filter)
+}
+
+// GetRequestsWithContext is the same as GetRequests but the request is aborted when ctx is done
+func (c *Client) GetRequestsWithContext(ctx context.Context, filter *RequestsFilter) (*RequestsResponse, error) {
 	c.v("GetRequests filter: %+v", filter)
 	requests := new(RequestsResponse)
-	err := c.jsonAPI("POST", "/czds/requests/all", filter, requests)
+	err := c.jsonAPIWithContext(ctx, "POST", "/czds/requests/all", filter, requests)
 	return requests, err
 }
 
+// GetRequestsExact is like GetRequests but only returns the requests whose TLD exactly matches filter.Filter
+// ignoring case, as the server side filter is a substring search.
+// All pages starting from filter.Pagination.Page are fetched
+func (c *Client) GetRequestsExact(filter *RequestsFilter) ([]Request, error) {
+	return c.GetRequestsExactWithContext(context.Background(), filter)
+}
+
+// GetRequestsExactWithContext is the same as GetRequestsExact but the requests are aborted when ctx is done
+func (c *Client) GetRequestsExactWithContext(ctx context.Context, filter *RequestsFilter) ([]Request, error) {
+	c.v("GetRequestsExact filter: %+v", filter)
+	pageFilter := *filter
+	out := make([]Request, 0, 1)
+	for {
+		requests, err := c.GetRequestsWithContext(ctx, &pageFilter)
+		if err != nil {
+			return out, err
+		}
+		if len(requests.Requests) == 0 {
+			break
+		}
+		for _, request := range requests.Requests {
+			if strings.EqualFold(request.TLD, filter.Filter) {
+				out = append(out, request)
+			}
+		}
+		pageFilter.Pagination.Page++
+	}
+	return out, nil
+}
+
 // GetRequestInfo gets detailed information about a particular request and its timeline
 // as seen on the CZDS dashboard page "https://czds.icann.org/zone-requests/{ID}"
 func (c *Client) GetRequestInfo(requestID string) (*RequestsInfo, error) {
+	return c.GetRequestInfoWithContext(context.Background(), requestID)
+}
+
+// GetRequestInfoWithContext is the same as GetRequestInfo but the request is aborted when ctx is done
+func (c *Client) GetRequestInfoWithContext(ctx context.Context, requestID string) (*RequestsInfo, error) {
 	c.v("GetRequestInfo request ID: %s", requestID)
 	request := new(RequestsInfo)
-	err := c.jsonAPI("GET", "/czds/requests/"+requestID, nil, request)
+	err := c.jsonAPIWithContext(ctx, "GET", "/czds/requests/"+requestID, nil, request)
 	return request, err
 }
 
+// WaitForStatusWithContext polls the request every pollInterval until its status is target, compared case-insensitively,
+// and returns its information. An error is returned along with the information if the request reaches a final status
+// other than target, such as denied or revoked, and the context's error is returned if ctx is done first.
+func (c *Client) WaitForStatusWithContext(ctx context.Context, requestID string, target string, pollInterval time.Duration) (*RequestsInfo, error) {
+	c.v("WaitForStatus request ID: %s status: %s", requestID, target)
+	if pollInterval <= 0 {
+		pollInterval = time.Minute
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := c.GetRequestInfoWithContext(ctx, requestID)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(info.Status, target) {
+			return info, nil
+		}
+		if isFinal(info.Status) {
+			return info, fmt.Errorf("request %s is %s and will not become %s", requestID, info.Status, target)
+		}
+		c.v("WaitForStatus request ID: %s is %s, waiting %s", requestID, info.Status, pollInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// isFinal returns true if a request with status will never change status on its own
+func isFinal(status string) bool {
+	for _, final := range []string{RequestDenied, RequestRevoked, RequestExpired, RequestCanceled} {
+		if strings.EqualFold(status, final) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRequestInfoRaw gets the unparsed JSON information about the provided request ID
+// useful for debugging responses that do not match RequestsInfo
+func (c *Client) GetRequestInfoRaw(requestID string) (json.RawMessage, error) {
+	c.v("GetRequestInfoRaw request ID: %s", requestID)
+	var raw json.RawMessage
+	err := c.jsonAPI("GET", "/czds/requests/"+requestID, nil, &raw)
+	return raw, err
+}
+
+// GetRequestInfos gets the information for each of the provided request IDs using up to parallel concurrent requests
+// the returned map is keyed by request ID and contains every request that was fetched successfully,
+// the returned error joins the errors for every request ID that failed
+func (c *Client) GetRequestInfos(ids []string, parallel int) (map[string]*RequestsInfo, error) {
+	return c.GetRequestInfosWithContext(context.Background(), ids, parallel)
+}
+
+// GetRequestInfosWithContext is the same as GetRequestInfos but the requests and any pause for a rate limit
+// are aborted when ctx is done, no more requests are started once ctx is done
+func (c *Client) GetRequestInfosWithContext(ctx context.Context, ids []string, parallel int) (map[string]*RequestsInfo, error) {
+	c.v("GetRequestInfos: %d requests", len(ids))
+	if parallel < 1 {
+		parallel = 1
+	}
+	infos := make(map[string]*RequestsInfo, len(ids))
+	var errs []error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for _, id := range ids {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mutex.Lock()
+			errs = append(errs, ctx.Err())
+			mutex.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var info *RequestsInfo
+			err := c.retryRateLimited(ctx, func() error {
+				var err error
+				info, err = c.GetRequestInfoWithContext(ctx, id)
+				return err
+			})
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("GetRequestInfo(%q): %w", id, err))
+				return
+			}
+			infos[id] = info
+		}(id)
+	}
+	wg.Wait()
+	return infos, errors.Join(errs...)
+}
+
+// GetRequestHistory gets the timeline of actions for a particular request
+func (c *Client) GetRequestHistory(requestID string) ([]HistoryEntry, error) {
+	c.v("GetRequestHistory request ID: %s", requestID)
+	info, err := c.GetRequestInfo(requestID)
+	if err != nil {
+		return nil, err
+	}
+	return info.History, nil
+}
+
 // GetTLDStatus gets the current status of all TLDs and their ability to be requested
+// if TLDStatusCacheTTL is set a cached result newer than the TTL is returned without making a request
 func (c *Client) GetTLDStatus() ([]TLDStatus, error) {
+	return c.GetTLDStatusWithContext(context.Background())
+}
+
+// GetTLDStatusWithContext is the same as GetTLDStatus but the request is aborted when ctx is done
+func (c *Client) GetTLDStatusWithContext(ctx context.Context) ([]TLDStatus, error) {
+	c.tldStatusMutex.Lock()
+	if c.TLDStatusCacheTTL > 0 && c.tldStatus != nil && time.Since(c.tldStatusTime) < c.TLDStatusCacheTTL {
+		c.v("GetTLDStatus: using cached status from %s", c.tldStatusTime.Format(time.ANSIC))
+		cached := append([]TLDStatus(nil), c.tldStatus...)
+		c.tldStatusMutex.Unlock()
+		return cached, nil
+	}
+	c.tldStatusMutex.Unlock()
+
+	// the lock is not held during the request so a slow server does not block other callers
 	c.v("GetTLDStatus")
 	requests := make([]TLDStatus, 0, 20)
-	err := c.jsonAPI("GET", "/czds/tlds", nil, &requests)
+	err := c.jsonAPIWithContext(ctx, "GET", "/czds/tlds", nil, &requests)
+	if err == nil && c.TLDStatusCacheTTL > 0 {
+		c.tldStatusMutex.Lock()
+		c.tldStatus = append([]TLDStatus(nil), requests...)
+		c.tldStatusTime = time.Now()
+		c.tldStatusMutex.Unlock()
+	}
 	return requests, err
 }
 
+// invalidateTLDStatus clears the GetTLDStatus cache after the status of a TLD has changed
+func (c *Client) invalidateTLDStatus() {
+	c.tldStatusMutex.Lock()
+	c.tldStatus = nil
+	c.tldStatusMutex.Unlock()
+}
+
+// invalidateTerms clears the GetTerms cache after the terms were rejected
+func (c *Client) invalidateTerms() {
+	c.termsMutex.Lock()
+	c.terms = nil
+	c.termsMutex.Unlock()
+}
+
 // GetTerms gets the current terms and conditions from the CZDS portal
 // page "https://czds.icann.org/terms-and-conditions"
 // this is required to accept the terms and conditions when submitting a new request
+// if TermsCacheTTL is set a cached result newer than the TTL is returned without making a request
 func (c *Client) GetTerms() (*Terms, error) {
+	return c.GetTermsWithContext(context.Background())
+}
+
+// GetTermsWithContext is the same as GetTerms but the request is aborted when ctx is done
+func (c *Client) GetTermsWithContext(ctx context.Context) (*Terms, error) {
+	c.termsMutex.Lock()
+	if c.TermsCacheTTL > 0 && c.terms != nil && time.Since(c.termsTime) < c.TermsCacheTTL {
+		c.v("GetTerms: using cached terms from %s", c.termsTime.Format(time.ANSIC))
+		terms := *c.terms
+		c.termsMutex.Unlock()
+		return &terms, nil
+	}
+	c.termsMutex.Unlock()
+
+	// the lock is not held during the request so a slow server does not block other callers
 	c.v("GetTerms")
 	terms := new(Terms)
 	// this does not appear to need auth, but we auth regardless
-	err := c.jsonAPI("GET", "/czds/terms/condition", nil, terms)
+	err := c.jsonAPIWithContext(ctx, "GET", "/czds/terms/condition", nil, terms)
+	if err == nil && c.TermsCacheTTL > 0 {
+		cached := *terms
+		c.termsMutex.Lock()
+		c.terms = &cached
+		c.termsTime = time.Now()
+		c.termsMutex.Unlock()
+	}
 	return terms, err
 }
 
 // SubmitRequest submits a new request for access to new zones
 func (c *Client) SubmitRequest(request *RequestSubmission) error {
+	return c.SubmitRequestWithContext(context.Background(), request)
+}
+
+// SubmitRequestWithContext is the same as SubmitRequest but the request is aborted when ctx is done
+func (c *Client) SubmitRequestWithContext(ctx context.Context, request *RequestSubmission) error {
 	c.v("SubmitRequest request: %+v", request)
-	err := c.jsonAPI("POST", "/czds/requests/create", request, nil)
+	err := c.jsonAPIWithContext(ctx, "POST", "/czds/requests/create", request, nil)
+	if err == nil {
+		c.invalidateTLDStatus()
+	}
 	return err
 }
 
+// submitWithTerms submits request, which accepts the terms and conditions in terms
+// if the terms changed after they were fetched and the server rejects the request, the terms are fetched again
+// and the request is retried once with the new version, which is also saved to terms for later requests
+func (c *Client) submitWithTerms(ctx context.Context, request *RequestSubmission, terms *Terms) error {
+	err := c.SubmitRequestWithContext(ctx, request)
+	if !isTermsVersionError(err) {
+		return err
+	}
+	c.v("SubmitRequest: terms version %q rejected, fetching terms again: %s", request.TcVersion, err)
+	c.invalidateTerms()
+	current, termsErr := c.GetTermsWithContext(ctx)
+	if termsErr != nil {
+		return errors.Join(err, termsErr)
+	}
+	if current.Version == request.TcVersion {
+		// the terms did not change, retrying would fail the same way
+		return err
+	}
+	*terms = *current
+	request.TcVersion = current.Version
+	return c.SubmitRequestWithContext(ctx, request)
+}
+
 // CancelRequest cancels a pre-existing request.
 // Can only cancel pending requests.
 func (c *Client) CancelRequest(cancel *CancelRequestSubmission) (*RequestsInfo, error) {
+	return c.CancelRequestWithContext(context.Background(), cancel)
+}
+
+// CancelRequestWithContext is the same as CancelRequest but the request is aborted when ctx is done
+func (c *Client) CancelRequestWithContext(ctx context.Context, cancel *CancelRequestSubmission) (*RequestsInfo, error) {
 	c.v("CancelRequest request: %+v", cancel)
 	request := new(RequestsInfo)
-	err := c.jsonAPI("POST", "/czds/requests/cancel", cancel, request)
+	err := c.jsonAPIWithContext(ctx, "POST", "/czds/requests/cancel", cancel, request)
+	if err == nil {
+		c.invalidateTLDStatus()
+	}
 	return request, err
 }
 
 // RequestExtension submits a request to have the access extended.
 // Can only request extensions for requests expiring within 30 days.
 func (c *Client) RequestExtension(requestID string) (*RequestsInfo, error) {
+	return c.RequestExtensionWithContext(context.Background(), requestID)
+}
+
+// RequestExtensionWithContext is the same as RequestExtension but the request is aborted when ctx is done
+func (c *Client) RequestExtensionWithContext(ctx context.Context, requestID string) (*RequestsInfo, error) {
 	c.v("RequestExtension request ID: %s", requestID)
 	request := new(RequestsInfo)
-	err := c.jsonAPI("POST", "/czds/requests/extension/"+requestID, emptyStruct, request)
+	err := c.jsonAPIWithContext(ctx, "POST", "/czds/requests/extension/"+requestID, emptyStruct, request)
 	return request, err
 }
 
+// SetAutoRenew enables or disables automatically renewing the approved request
+// Note: this endpoint is used by the CZDS portal but is not part of the documented API
+func (c *Client) SetAutoRenew(requestID string, enabled bool) (*RequestsInfo, error) {
+	c.v("SetAutoRenew request ID: %s enabled: %t", requestID, enabled)
+	request := new(RequestsInfo)
+	err := c.jsonAPI("POST", "/czds/requests/autorenew/"+requestID, &autoRenewSubmission{AutoRenew: enabled}, request)
+	if err != nil {
+		return nil, fmt.Errorf("SetAutoRenew(%q): %w", requestID, err)
+	}
+	return request, nil
+}
+
 // DownloadAllRequests outputs the contents of the csv file downloaded by
 // the "Download All Requests" button on the CZDS portal to the provided output
 func (c *Client) DownloadAllRequests(output io.Writer) error {
@@ -243,24 +523,145 @@ func (c *Client) DownloadAllRequests(output io.Writer) error {
 	return nil
 }
 
+// RequestOptions holds the optional settings for RequestTLDsWithOptions() and RequestAllTLDsExceptWithOptions()
+type RequestOptions struct {
+	AdditionalFTPIps []string // additional IPs to allow FTP access from
+	CheckStatus      bool     // check that each TLD is able to be requested with GetTLDStatus() before submitting
+	Force            bool     // request TLDs even if they are already approved, pending, or submitted
+	BatchSize        int      // max number of TLDs submitted in each request by RequestAllTLDsExceptWithOptions(), defaults to DefaultRequestBatchSize
+}
+
+// DefaultRequestBatchSize is the default max number of TLDs submitted in a single request
+const DefaultRequestBatchSize = 100
+
 // RequestTLDs is a helper function that requests access to the provided tlds with the provided reason
 // TLDs provided should be marked as able to request from GetTLDStatus()
+// TLDs that are already approved, pending, or submitted are skipped
 func (c *Client) RequestTLDs(tlds []string, reason string) error {
+	_, err := c.RequestTLDsWithOptions(tlds, reason, nil)
+	return err
+}
+
+// RequestTLDsWithOptions is the same as RequestTLDs but with the additional RequestOptions, opts may be nil
+// returns the TLDs that were requested
+func (c *Client) RequestTLDsWithOptions(tlds []string, reason string, opts *RequestOptions) ([]string, error) {
+	return c.requestTLDs(context.Background(), tlds, reason, opts)
+}
+
+// requestTLDs is the same as RequestTLDsWithOptions but the requests are aborted when ctx is done
+func (c *Client) requestTLDs(ctx context.Context, tlds []string, reason string, opts *RequestOptions) ([]string, error) {
 	c.v("RequestTLDs TLDS: %+v", tlds)
+	if opts == nil {
+		opts = &RequestOptions{}
+	}
+	tlds, err := normalizeTLDs(tlds)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Force || opts.CheckStatus {
+		statusMap, err := c.tldStatusMap(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Force {
+			tlds = c.skipRequested(tlds, statusMap)
+			if len(tlds) == 0 {
+				c.v("no TLDs to request")
+				return tlds, nil
+			}
+		}
+		if opts.CheckStatus {
+			err = checkRequestable(tlds, statusMap)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	// get terms
-	terms, err := c.GetTerms()
+	terms, err := c.GetTermsWithContext(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// submit request
 	request := &RequestSubmission{
-		TLDNames:  tlds,
-		Reason:    reason,
-		TcVersion: terms.Version,
+		TLDNames:         tlds,
+		Reason:           reason,
+		TcVersion:        terms.Version,
+		AdditionalFTPIps: opts.AdditionalFTPIps,
 	}
-	err = c.SubmitRequest(request)
-	return err
+	err = c.submitWithTerms(ctx, request, terms)
+	if err != nil {
+		return nil, err
+	}
+	return tlds, nil
+}
+
+// skipRequested returns the tlds that are not already approved, pending, or submitted
+func (c *Client) skipRequested(tlds []string, statusMap map[string]string) []string {
+	out := make([]string, 0, len(tlds))
+	for _, tld := range tlds {
+		switch statusMap[tld] {
+		case StatusApproved, StatusPending, StatusSubmitted:
+			c.v("skipping request for %q, already %s", tld, statusMap[tld])
+			continue
+		}
+		out = append(out, tld)
+	}
+	return out
+}
+
+// tldStatusMap returns the current status of every TLD keyed by the lowercase TLD
+func (c *Client) tldStatusMap(ctx context.Context) (map[string]string, error) {
+	status, err := c.GetTLDStatusWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statusMap := make(map[string]string, len(status))
+	for _, tld := range status {
+		statusMap[strings.ToLower(tld.TLD)] = tld.CurrentStatus
+	}
+	return statusMap, nil
+}
+
+// isRequestable returns true if a TLD with the provided TLDStatus.CurrentStatus is able to be requested
+func isRequestable(status string) bool {
+	switch status {
+	case StatusAvailable, StatusCanceled, StatusDenied, StatusExpired, StatusRevoked:
+		return true
+	}
+	return false
+}
+
+// GetRequestableTLDs returns the status of only the TLDs that are able to be requested
+func (c *Client) GetRequestableTLDs() ([]TLDStatus, error) {
+	status, err := c.GetTLDStatus()
+	if err != nil {
+		return nil, err
+	}
+	requestable := make([]TLDStatus, 0, len(status))
+	for _, tld := range status {
+		if isRequestable(tld.CurrentStatus) {
+			requestable = append(requestable, tld)
+		}
+	}
+	return requestable, nil
+}
+
+// checkRequestable returns an error if any of the provided tlds are unknown or are not able to be requested
+func checkRequestable(tlds []string, statusMap map[string]string) error {
+	var errs []error
+	for _, tld := range tlds {
+		current, ok := statusMap[tld]
+		if !ok {
+			errs = append(errs, fmt.Errorf("TLD %q not found", tld))
+			continue
+		}
+		if !isRequestable(current) {
+			errs = append(errs, fmt.Errorf("TLD %q is %s and can not be requested", tld, current))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // RequestAllTLDs is a helper function to request access to all available TLDs with the provided reason
@@ -270,29 +671,61 @@ func (c *Client) RequestAllTLDs(reason string) ([]string, error) {
 
 // RequestAllTLDsExcept is a helper function to request access to all available TLDs with the provided reason skipping over the TLDs in except
 func (c *Client) RequestAllTLDsExcept(reason string, except []string) ([]string, error) {
+	return c.RequestAllTLDsExceptWithOptions(reason, except, nil)
+}
+
+// RequestAllTLDsExceptWithOptions is the same as RequestAllTLDsExcept but with the additional RequestOptions, opts may be nil
+func (c *Client) RequestAllTLDsExceptWithOptions(reason string, except []string, opts *RequestOptions) ([]string, error) {
+	result, err := c.RequestAllTLDsExceptWithResult(reason, except, opts)
+	if result == nil {
+		return nil, err
+	}
+	return result.Requested, err
+}
+
+// RequestAllResult describes what RequestAllTLDsExceptWithResult did with each TLD
+type RequestAllResult struct {
+	Requested []string // TLDs that were successfully requested
+	Failed    []string // TLDs whose request was submitted but failed
+	Skipped   []string // TLDs that can not be requested, such as those already approved or pending
+	Excluded  []string // TLDs that were skipped because they were in except
+}
+
+// RequestAllTLDsExceptWithResult is the same as RequestAllTLDsExceptWithOptions but returns what happened to every TLD
+// the result is returned along with any error when some of the requests failed
+func (c *Client) RequestAllTLDsExceptWithResult(reason string, except []string, opts *RequestOptions) (*RequestAllResult, error) {
 	c.v("RequestAllTLDs")
+	if opts == nil {
+		opts = &RequestOptions{}
+	}
 	exceptMap := slice2LowerMap(except)
-	// get available to request
 	status, err := c.GetTLDStatus()
 	if err != nil {
 		return nil, err
 	}
+	result := &RequestAllResult{
+		Requested: make([]string, 0),
+		Failed:    make([]string, 0),
+		Skipped:   make([]string, 0),
+		Excluded:  make([]string, 0),
+	}
 	// check to see if any available to request
 	requestTLDs := make([]string, 0, 10)
 	for _, tld := range status {
 		if exceptMap[tld.TLD] {
-			// skip over excluded TLDs
+			result.Excluded = append(result.Excluded, tld.TLD)
 			continue
 		}
-		switch tld.CurrentStatus {
-		case StatusAvailable, StatusCanceled, StatusDenied, StatusExpired, StatusRevoked:
-			requestTLDs = append(requestTLDs, tld.TLD)
+		if !isRequestable(tld.CurrentStatus) {
+			result.Skipped = append(result.Skipped, tld.TLD)
+			continue
 		}
+		requestTLDs = append(requestTLDs, tld.TLD)
 	}
 	// if none, return now
 	if len(requestTLDs) == 0 {
 		c.v("no TLDs to request")
-		return requestTLDs, nil
+		return result, nil
 	}
 
 	// get terms
@@ -301,29 +734,100 @@ func (c *Client) RequestAllTLDsExcept(reason string, except []string) ([]string,
 		return nil, err
 	}
 
-	// submit request
-	request := &RequestSubmission{
-		AllTLDs:   true,
-		TLDNames:  requestTLDs,
-		Reason:    reason,
-		TcVersion: terms.Version,
+	// submit requests in batches to keep the request size reasonable
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultRequestBatchSize
+	}
+	var errs []error
+	for start := 0; start < len(requestTLDs); start += batchSize {
+		end := start + batchSize
+		if end > len(requestTLDs) {
+			end = len(requestTLDs)
+		}
+		batch := requestTLDs[start:end]
+		request := &RequestSubmission{
+			// only a single request can be for all TLDs
+			AllTLDs:          len(batch) == len(requestTLDs),
+			TLDNames:         batch,
+			Reason:           reason,
+			TcVersion:        terms.Version,
+			AdditionalFTPIps: opts.AdditionalFTPIps,
+		}
+		c.v("Requesting %d TLDs %+v", len(batch), batch)
+		err = c.retryRateLimited(context.Background(), func() error {
+			return c.submitWithTerms(context.Background(), request, terms)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("request for %d TLDs %v: %w", len(batch), batch, err))
+			result.Failed = append(result.Failed, batch...)
+			continue
+		}
+		result.Requested = append(result.Requested, batch...)
 	}
-	c.v("Requesting %d TLDs %+v", len(requestTLDs), requestTLDs)
-	err = c.SubmitRequest(request)
-	return requestTLDs, err
+	return result, errors.Join(errs...)
+}
+
+// ReRequestExpired requests access again to the TLDs that were previously requested but are now
+// expired, revoked, denied, or canceled, skipping over the TLDs in except
+// it returns the TLDs that were requested
+func (c *Client) ReRequestExpired(reason string, except []string) ([]string, error) {
+	return c.ReRequestExpiredWithContext(context.Background(), reason, except, nil)
+}
+
+// ReRequestExpiredWithOptions is the same as ReRequestExpired but with the additional RequestOptions, opts may be nil
+func (c *Client) ReRequestExpiredWithOptions(reason string, except []string, opts *RequestOptions) ([]string, error) {
+	return c.ReRequestExpiredWithContext(context.Background(), reason, except, opts)
+}
+
+// ReRequestExpiredWithContext is the same as ReRequestExpiredWithOptions but the requests and any pause for a rate limit
+// are aborted when ctx is done
+func (c *Client) ReRequestExpiredWithContext(ctx context.Context, reason string, except []string, opts *RequestOptions) ([]string, error) {
+	c.v("ReRequestExpired")
+	exceptMap := slice2LowerMap(except)
+	status, err := c.GetTLDStatusWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tlds := make([]string, 0)
+	for _, tld := range status {
+		if exceptMap[strings.ToLower(tld.TLD)] {
+			continue
+		}
+		switch tld.CurrentStatus {
+		case StatusExpired, StatusRevoked, StatusDenied, StatusCanceled:
+			tlds = append(tlds, tld.TLD)
+		}
+	}
+	if len(tlds) == 0 {
+		c.v("no TLDs to request again")
+		return tlds, nil
+	}
+	var requested []string
+	err = c.retryRateLimited(ctx, func() error {
+		var err error
+		requested, err = c.requestTLDs(ctx, tlds, reason, opts)
+		return err
+	})
+	return requested, err
 }
 
 // ExtendTLD is a helper function that requests extensions to the provided tld
 // TLDs provided should be marked as Extensible from GetRequestInfo()
 func (c *Client) ExtendTLD(tld string) error {
+	return c.ExtendTLDWithContext(context.Background(), tld)
+}
+
+// ExtendTLDWithContext is the same as ExtendTLD but the requests are aborted when ctx is done
+func (c *Client) ExtendTLDWithContext(ctx context.Context, tld string) error {
 	c.v("ExtendTLD: %q", tld)
-	requestID, err := c.GetZoneRequestID(tld)
+	requestID, err := c.GetZoneRequestIDWithContext(ctx, tld)
 	if err != nil {
 		return fmt.Errorf("error GetZoneRequestID(%q): %w", tld, err)
 	}
 	c.v("ExtendTLD: tld: %q requestID: %q", tld, requestID)
 
-	info, err := c.RequestExtension(requestID)
+	info, err := c.RequestExtensionWithContext(ctx, requestID)
 	if err != nil {
 		return fmt.Errorf("RequestExtension(%q): %w", tld, err)
 	}
@@ -335,6 +839,36 @@ func (c *Client) ExtendTLD(tld string) error {
 	return nil
 }
 
+// ExtendTLDs is a helper function that requests extensions to all of the provided tlds
+// A failure to extend one TLD does not prevent the others from being extended,
+// the returned error joins the errors for every TLD that failed
+func (c *Client) ExtendTLDs(tlds []string) ([]string, error) {
+	return c.ExtendTLDsWithContext(context.Background(), tlds)
+}
+
+// ExtendTLDsWithContext is the same as ExtendTLDs but the requests and any pause for a rate limit are aborted
+// when ctx is done, the TLDs extended before ctx was done are returned along with the context's error
+func (c *Client) ExtendTLDsWithContext(ctx context.Context, tlds []string) ([]string, error) {
+	c.v("ExtendTLDs TLDS: %+v", tlds)
+	extended := make([]string, 0, len(tlds))
+	var errs []error
+	for _, tld := range tlds {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		err := c.retryRateLimited(ctx, func() error {
+			return c.ExtendTLDWithContext(ctx, tld)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		extended = append(extended, tld)
+	}
+	return extended, errors.Join(errs...)
+}
+
 // ExtendAllTLDs is a helper function to request extensions to all TLDs that are extendable
 func (c *Client) ExtendAllTLDs() ([]string, error) {
 	return c.ExtendAllTLDsExcept(nil)
@@ -342,80 +876,324 @@ func (c *Client) ExtendAllTLDs() ([]string, error) {
 
 // ExtendAllTLDsExcept is a helper function to request extensions to all TLDs that are extendable excluding any in except
 func (c *Client) ExtendAllTLDsExcept(except []string) ([]string, error) {
+	return c.ExtendAllTLDsExceptWithContext(context.Background(), except)
+}
+
+// ExtendAllTLDsExceptWithContext is the same as ExtendAllTLDsExcept but the requests and any pause for a rate limit
+// are aborted when ctx is done
+func (c *Client) ExtendAllTLDsExceptWithContext(ctx context.Context, except []string) ([]string, error) {
 	c.v("ExtendAllTLDs")
 	tlds := make([]string, 0, 10)
-	toExtend := make([]Request, 0, 10)
 	exceptMap := slice2LowerMap(except)
 
-	// get all TLDs to extend
-	const pageSize = 100
-	filter := RequestsFilter{
-		Status: RequestApproved,
-		Filter: "",
-		Pagination: RequestsPagination{
-			Size: pageSize,
-			Page: 0,
-		},
-		Sort: RequestsSort{
-			Field:     SortByExpiration,
-			Direction: SortAsc,
-		},
+	// get all TLDs that may be extended
+	var deadline time.Time
+	if expiryDateThreshold > 0 {
+		deadline = time.Now().AddDate(0, 0, expiryDateThreshold)
+	}
+	approved, err := c.getApprovedRequestsExpiringBefore(ctx, deadline)
+	if err != nil {
+		return tlds, err
+	}
+	candidates := make([]Request, 0, len(approved))
+	for _, r := range approved {
+		if exceptMap[strings.ToLower(r.TLD)] {
+			// skip over excluded TLDs
+			continue
+		}
+		candidates = append(candidates, r)
 	}
 
-	// test if a request is extensible
-	isExtensible := func(id string) (bool, error) {
-		info, err := c.GetRequestInfo(id)
-		return info.Extensible, err
+	// check which ones are extendable
+	toExtend, err := c.filterExtensible(ctx, candidates)
+	if err != nil {
+		return tlds, err
 	}
 
-	// get all pages of requests and check which ones are extendable
-	morePages := true
-	for morePages {
-		c.v("ExtendAllTLDs requesting %d requests on page %d", filter.Pagination.Size, filter.Pagination.Page)
-		req, err := c.GetRequests(&filter)
+	// perform extend
+	c.v("requesting extensions for %d tlds: %+v", len(toExtend), toExtend)
+	for _, r := range toExtend {
+		err := c.retryRateLimited(ctx, func() error {
+			_, err := c.RequestExtensionWithContext(ctx, r.RequestID)
+			return err
+		})
 		if err != nil {
 			return tlds, err
 		}
-		for _, r := range req.Requests {
-			// check for break early
-			if expiryDateThreshold > 0 && r.Expired.After(time.Now().AddDate(0, 0, expiryDateThreshold)) {
-				c.v("request %q: %q expires on %s, > %d days threshold, looking no further", r.TLD, r.RequestID, r.Expired.Format(time.ANSIC), expiryDateThreshold)
-				morePages = false
-				break
-			}
+		tlds = append(tlds, r.TLD)
+	}
+
+	if len(tlds) != len(toExtend) {
+		return tlds, fmt.Errorf("expected to extend %d TLDs but only extended %d", len(toExtend), len(tlds))
+	}
+
+	return tlds, nil
+}
 
-			// get request info
-			ext, err := isExtensible(r.RequestID)
+// filterExtensible returns the requests that are extensible, preserving their order
+// the requests are checked in parallel by up to extensibleProbeWorkers workers,
+// the first error, or ctx being done, stops any checks that have not yet started
+func (c *Client) filterExtensible(ctx context.Context, requests []Request) ([]Request, error) {
+	extensible := make([]bool, len(requests))
+	sem := make(chan struct{}, extensibleProbeWorkers)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var firstErr error
+	for i := range requests {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		mutex.Lock()
+		if firstErr == nil && ctx.Err() != nil {
+			firstErr = ctx.Err()
+		}
+		failed := firstErr != nil
+		mutex.Unlock()
+		if failed {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var info *RequestsInfo
+			err := c.retryRateLimited(ctx, func() error {
+				var err error
+				info, err = c.GetRequestInfoWithContext(ctx, requests[i].RequestID)
+				return err
+			})
 			if err != nil {
-				return tlds, err
-			}
-			if ext {
-				toExtend = append(toExtend, r)
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("GetRequestInfo(%q): %w", requests[i].TLD, err)
+				}
+				mutex.Unlock()
+				return
 			}
+			extensible[i] = info.Extensible
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	out := make([]Request, 0, len(requests))
+	for i, r := range requests {
+		if extensible[i] {
+			out = append(out, r)
 		}
-		filter.Pagination.Page++
-		if len(req.Requests) == 0 {
-			morePages = false
+	}
+	return out, nil
+}
+
+// CancelTLD is a helper function that cancels the most recent request for the provided tld
+// Only pending requests are able to be canceled
+func (c *Client) CancelTLD(tld string) (*RequestsInfo, error) {
+	return c.CancelTLDWithContext(context.Background(), tld)
+}
+
+// CancelTLDWithContext is the same as CancelTLD but the requests are aborted when ctx is done
+func (c *Client) CancelTLDWithContext(ctx context.Context, tld string) (*RequestsInfo, error) {
+	c.v("CancelTLD: %q", tld)
+	requestID, err := c.GetZoneRequestIDWithContext(ctx, tld)
+	if err != nil {
+		return nil, fmt.Errorf("error GetZoneRequestID(%q): %w", tld, err)
+	}
+	c.v("CancelTLD: tld: %q requestID: %q", tld, requestID)
+
+	cancel := &CancelRequestSubmission{
+		RequestID: requestID,
+		TLDName:   tld,
+	}
+	info, err := c.CancelRequestWithContext(ctx, cancel)
+	if err != nil {
+		return nil, fmt.Errorf("CancelRequest(%q): %w", tld, err)
+	}
+	return info, nil
+}
+
+// CancelTLDs is a helper function that cancels the requests for all of the provided tlds
+// A failure to cancel one TLD does not prevent the others from being canceled,
+// the returned error joins the errors for every TLD that failed
+func (c *Client) CancelTLDs(tlds []string) ([]*RequestsInfo, error) {
+	return c.CancelTLDsWithContext(context.Background(), tlds)
+}
+
+// CancelTLDsWithContext is the same as CancelTLDs but the requests are aborted when ctx is done
+// the requests canceled before ctx was done are returned along with the context's error
+func (c *Client) CancelTLDsWithContext(ctx context.Context, tlds []string) ([]*RequestsInfo, error) {
+	c.v("CancelTLDs TLDS: %+v", tlds)
+	canceled := make([]*RequestsInfo, 0, len(tlds))
+	var errs []error
+	for _, tld := range tlds {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		info, err := c.CancelTLDWithContext(ctx, tld)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		canceled = append(canceled, info)
 	}
+	return canceled, errors.Join(errs...)
+}
 
-	// perform extend
-	c.v("requesting extensions for %d tlds: %+v", len(toExtend), toExtend)
-	for _, r := range toExtend {
-		if exceptMap[r.TLD] {
+// CancelAllPending is a helper function to cancel all pending requests excluding any TLDs in except
+// returns the TLDs that were canceled, a failure to cancel one TLD does not stop the others
+func (c *Client) CancelAllPending(except []string) ([]string, error) {
+	return c.CancelAllPendingWithContext(context.Background(), except)
+}
+
+// CancelAllPendingWithContext is the same as CancelAllPending but the requests are aborted when ctx is done
+// the TLDs canceled before ctx was done are returned along with the context's error
+func (c *Client) CancelAllPendingWithContext(ctx context.Context, except []string) ([]string, error) {
+	c.v("CancelAllPending")
+	exceptMap := slice2LowerMap(except)
+	requests, err := c.GetAllRequestsWithContext(ctx, RequestPending)
+	if err != nil {
+		return nil, err
+	}
+
+	canceled := make([]string, 0, len(requests))
+	var errs []error
+	for _, r := range requests {
+		// only pending requests are able to be canceled
+		if !strings.EqualFold(r.Status, RequestPending) {
+			c.v("CancelAllPending: skipping %q with status %q", r.TLD, r.Status)
+			continue
+		}
+		if exceptMap[strings.ToLower(r.TLD)] {
 			// skip over excluded TLDs
 			continue
 		}
-		_, err := c.RequestExtension(r.RequestID)
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		c.v("CancelAllPending: canceling %q: %q", r.TLD, r.RequestID)
+		cancel := &CancelRequestSubmission{
+			RequestID: r.RequestID,
+			TLDName:   r.TLD,
+		}
+		err = c.retryRateLimited(ctx, func() error {
+			_, err := c.CancelRequestWithContext(ctx, cancel)
+			return err
+		})
 		if err != nil {
-			return tlds, err
+			errs = append(errs, fmt.Errorf("CancelRequest(%q): %w", r.TLD, err))
+			continue
 		}
-		tlds = append(tlds, r.TLD)
+		canceled = append(canceled, r.TLD)
 	}
 
-	if len(tlds) != len(toExtend) {
-		return tlds, fmt.Errorf("expected to extend %d TLDs but only extended %d", len(toExtend), len(tlds))
+	return canceled, errors.Join(errs...)
+}
+
+// GetExpiringRequests returns the approved requests that will expire within the provided duration
+// ordered by expiration
+func (c *Client) GetExpiringRequests(within time.Duration) ([]Request, error) {
+	return c.GetExpiringRequestsWithContext(context.Background(), within)
+}
+
+// GetExpiringRequestsWithContext is the same as GetExpiringRequests but the requests and any pause for a rate limit
+// are aborted when ctx is done
+func (c *Client) GetExpiringRequestsWithContext(ctx context.Context, within time.Duration) ([]Request, error) {
+	c.v("GetExpiringRequests within %s", within)
+	approved, err := c.getApprovedRequestsExpiringBefore(ctx, time.Now().Add(within))
+	if err != nil {
+		return nil, err
+	}
+	expiring := make([]Request, 0, len(approved))
+	for _, r := range approved {
+		// epoch 0 means no expiration set
+		if r.Expired.IsZero() || r.Expired.Unix() <= 0 {
+			continue
+		}
+		expiring = append(expiring, r)
 	}
+	return expiring, nil
+}
 
-	return tlds, nil
+// GetInactiveRequests returns the most recent request of each TLD whose access was lost or never granted
+// because the request is expired, revoked, or denied
+// TLDs with a newer request, such as one that was approved or is pending, are not included
+func (c *Client) GetInactiveRequests() ([]Request, error) {
+	return c.GetInactiveRequestsWithContext(context.Background())
+}
+
+// GetInactiveRequestsWithContext is the same as GetInactiveRequests but the requests are aborted when ctx is done
+func (c *Client) GetInactiveRequestsWithContext(ctx context.Context) ([]Request, error) {
+	c.v("GetInactiveRequests")
+	requests, err := c.GetAllRequestsWithContext(ctx, RequestAll)
+	if err != nil {
+		return nil, err
+	}
+	// sort newest first so only the most recent request of each TLD is considered
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].Created.After(requests[j].Created)
+	})
+	seen := make(map[string]bool, len(requests))
+	inactive := make([]Request, 0)
+	for _, r := range requests {
+		tld := strings.ToLower(r.TLD)
+		if seen[tld] {
+			continue
+		}
+		seen[tld] = true
+		for _, status := range []string{RequestExpired, RequestRevoked, RequestDenied} {
+			if strings.EqualFold(r.Status, status) {
+				inactive = append(inactive, r)
+				break
+			}
+		}
+	}
+	return inactive, nil
+}
+
+// getApprovedRequestsExpiringBefore returns the approved requests that expire before deadline ordered by expiration
+// a zero deadline returns all approved requests
+func (c *Client) getApprovedRequestsExpiringBefore(ctx context.Context, deadline time.Time) ([]Request, error) {
+	const pageSize = 100
+	filter := RequestsFilter{
+		Status: RequestApproved,
+		Filter: "",
+		Pagination: RequestsPagination{
+			Size: pageSize,
+			Page: 0,
+		},
+		Sort: RequestsSort{
+			Field:     SortByExpiration,
+			Direction: SortAsc,
+		},
+	}
+
+	out := make([]Request, 0, 10)
+	for {
+		c.v("requesting %d approved requests on page %d", filter.Pagination.Size, filter.Pagination.Page)
+		var req *RequestsResponse
+		err := c.retryRateLimited(ctx, func() error {
+			var err error
+			req, err = c.GetRequestsWithContext(ctx, &filter)
+			return err
+		})
+		if err != nil {
+			return out, err
+		}
+		if len(req.Requests) == 0 {
+			return out, nil
+		}
+		for _, r := range req.Requests {
+			// check for break early
+			if !deadline.IsZero() && r.Expired.After(deadline) {
+				c.v("request %q: %q expires on %s, after %s, looking no further", r.TLD, r.RequestID, r.Expired.Format(time.ANSIC), deadline.Format(time.ANSIC))
+				return out, nil
+			}
+			out = append(out, r)
+		}
+		filter.Pagination.Page++
+	}
 }
@@ -0,0 +1,1694 @@
+package czds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCancelAllPending(t *testing.T) {
+	// the server does not filter by status, so CancelAllPending must skip the others itself
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestPending},
+		{RequestID: "2", TLD: "net", Status: RequestApproved},
+		{RequestID: "3", TLD: "org", Status: "pending"},
+		{RequestID: "4", TLD: "xyz", Status: RequestDenied},
+		{RequestID: "5", TLD: "fail", Status: RequestPending},
+	}
+	tests := []struct {
+		name       string
+		except     []string
+		want       []string // TLDs canceled
+		wantCalls  []string // TLDs sent to the cancel endpoint
+		wantErrTLD bool
+	}{
+		{
+			name:       "pending only",
+			want:       []string{"com", "org"},
+			wantCalls:  []string{"com", "fail", "org"},
+			wantErrTLD: true,
+		},
+		{
+			name:      "except is case insensitive",
+			except:    []string{"ORG", "fail"},
+			want:      []string{"com"},
+			wantCalls: []string{"com"},
+		},
+		{
+			name:      "except non pending",
+			except:    []string{"net", "com", "org", "fail"},
+			want:      []string{},
+			wantCalls: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var calls []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				if filter.Status != RequestPending {
+					t.Errorf("listed requests with status %q, want %q", filter.Status, RequestPending)
+				}
+				resp := RequestsResponse{TotalRequests: int64(len(list))}
+				if filter.Pagination.Page == 0 {
+					resp.Requests = list
+				}
+				writeJSON(t, w, resp)
+			})
+			mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+				var cancel CancelRequestSubmission
+				json.NewDecoder(r.Body).Decode(&cancel)
+				mu.Lock()
+				calls = append(calls, cancel.TLDName)
+				mu.Unlock()
+				if cancel.TLDName == "fail" {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, RequestsInfo{RequestID: cancel.RequestID, Status: RequestCanceled})
+			})
+			_, c := newTestServer(t, mux)
+
+			canceled, err := c.CancelAllPending(tt.except)
+			if tt.wantErrTLD {
+				if err == nil || !strings.Contains(err.Error(), `"fail"`) {
+					t.Errorf("CancelAllPending() error = %v, want an error for \"fail\"", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(canceled)
+			if !reflect.DeepEqual(canceled, tt.want) {
+				t.Errorf("CancelAllPending() = %v, want %v", canceled, tt.want)
+			}
+			sort.Strings(calls)
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("canceled %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCancelAllPendingWithContext(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestPending},
+		{RequestID: "2", TLD: "net", Status: RequestPending},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", requestsHandler(t, list))
+	mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+		// rate limit the first cancel for much longer than the test and stop while waiting it out
+		calls.Add(1)
+		cancel()
+		w.Header().Set("Retry-After", "3600")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+	_, c := newTestServer(t, mux)
+
+	canceled, err := c.CancelAllPendingWithContext(ctx, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CancelAllPendingWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if len(canceled) != 0 {
+		t.Errorf("CancelAllPendingWithContext() = %v, want none", canceled)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("cancel endpoint called %d times after ctx was done, want 1", n)
+	}
+}
+
+// requestsHandler serves the first page of /czds/requests/all with the requests whose TLD contains the filter
+func requestsHandler(t *testing.T, list []Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var filter RequestsFilter
+		json.NewDecoder(r.Body).Decode(&filter)
+		var resp RequestsResponse
+		for _, request := range list {
+			if strings.Contains(request.TLD, filter.Filter) {
+				resp.TotalRequests++
+				if filter.Pagination.Page == 0 {
+					resp.Requests = append(resp.Requests, request)
+				}
+			}
+		}
+		writeJSON(t, w, resp)
+	}
+}
+
+func TestCancelTLDs(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestPending},
+		{RequestID: "2", TLD: "net", Status: RequestPending},
+		{RequestID: "3", TLD: "org", Status: RequestPending},
+	}
+	tests := []struct {
+		name    string
+		tlds    []string
+		want    []string // request IDs canceled
+		wantErr []string // TLDs in the returned error
+	}{
+		{
+			name: "all canceled",
+			tlds: []string{"com", "NET"},
+			want: []string{"1", "2"},
+		},
+		{
+			name:    "failures are joined",
+			tlds:    []string{"missing", "com", "org", "net"},
+			want:    []string{"1", "2"},
+			wantErr: []string{`"missing"`, `"org"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", requestsHandler(t, list))
+			mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+				var cancel CancelRequestSubmission
+				json.NewDecoder(r.Body).Decode(&cancel)
+				if cancel.RequestID == "3" {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, RequestsInfo{RequestID: cancel.RequestID, Status: RequestCanceled})
+			})
+			_, c := newTestServer(t, mux)
+
+			infos, err := c.CancelTLDs(tt.tlds)
+			got := make([]string, 0, len(infos))
+			for _, info := range infos {
+				got = append(got, info.RequestID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CancelTLDs() canceled %v, want %v", got, tt.want)
+			}
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("CancelTLDs() returned no error")
+			}
+			for _, tld := range tt.wantErr {
+				if !strings.Contains(err.Error(), tld) {
+					t.Errorf("CancelTLDs() error %q does not mention %s", err, tld)
+				}
+			}
+		})
+	}
+}
+
+func TestCancelTLDsWithContext(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestPending},
+		{RequestID: "2", TLD: "net", Status: RequestPending},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []string
+	mux := http.NewServeMux()
+	lookup := requestsHandler(t, list)
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		// ctx is done while looking up the second TLD
+		if len(calls) > 0 {
+			cancel()
+		}
+		lookup(w, r)
+	})
+	mux.HandleFunc("/czds/requests/cancel", func(w http.ResponseWriter, r *http.Request) {
+		var submission CancelRequestSubmission
+		json.NewDecoder(r.Body).Decode(&submission)
+		calls = append(calls, submission.TLDName)
+		writeJSON(t, w, RequestsInfo{RequestID: submission.RequestID, Status: RequestCanceled})
+	})
+	_, c := newTestServer(t, mux)
+
+	infos, err := c.CancelTLDsWithContext(ctx, []string{"com", "net"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CancelTLDsWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if len(infos) != 1 || infos[0].RequestID != "1" {
+		t.Errorf("CancelTLDsWithContext() = %+v, want only request 1", infos)
+	}
+	if !reflect.DeepEqual(calls, []string{"com"}) {
+		t.Errorf("canceled %v, want [com]", calls)
+	}
+}
+
+func TestRequestAllTLDsExceptRateLimited(t *testing.T) {
+	tlds := []TLDStatus{
+		{TLD: "com", CurrentStatus: StatusAvailable},
+		{TLD: "net", CurrentStatus: StatusAvailable},
+		{TLD: "org", CurrentStatus: StatusApproved},
+		{TLD: "xyz", CurrentStatus: StatusAvailable},
+	}
+	tests := []struct {
+		name        string
+		rateLimited int // number of 429 responses after the first batch
+		wantCreates int32
+	}{
+		{"not rate limited", 0, 3},
+		{"paused mid batch", 1, 4},
+		{"paused twice", 2, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var creates atomic.Int32
+			var mu sync.Mutex
+			var requested []string
+			rateLimited := tt.rateLimited
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, tlds)
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				n := creates.Add(1)
+				mu.Lock()
+				defer mu.Unlock()
+				if n > 1 && rateLimited > 0 {
+					rateLimited--
+					w.Header().Set("Retry-After", "1")
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+					return
+				}
+				var request RequestSubmission
+				json.NewDecoder(r.Body).Decode(&request)
+				requested = append(requested, request.TLDNames...)
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+
+			start := time.Now()
+			result, err := c.RequestAllTLDsExceptWithResult("test", nil, &RequestOptions{BatchSize: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed, pause := time.Since(start), time.Duration(tt.rateLimited)*time.Second; elapsed < pause {
+				t.Errorf("batch took %s, want a pause of at least %s", elapsed, pause)
+			}
+			want := []string{"com", "net", "xyz"}
+			if !reflect.DeepEqual(result.Requested, want) || !reflect.DeepEqual(requested, want) {
+				t.Errorf("requested %v (server saw %v), want %v", result.Requested, requested, want)
+			}
+			if len(result.Failed) != 0 {
+				t.Errorf("failed %v, want none", result.Failed)
+			}
+			if n := creates.Load(); n != tt.wantCreates {
+				t.Errorf("create called %d times, want %d", n, tt.wantCreates)
+			}
+		})
+	}
+}
+
+func TestExtendTLDs(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestApproved},
+		{RequestID: "2", TLD: "net", Status: RequestApproved},
+		{RequestID: "3", TLD: "org", Status: RequestApproved},
+	}
+	tests := []struct {
+		name     string
+		fail     string // request ID the extension fails for
+		want     []string
+		wantErr  string // TLD in the returned error
+		wantExts []string
+	}{
+		{
+			name:     "all extended",
+			want:     []string{"com", "net", "org"},
+			wantExts: []string{"1", "2", "3"},
+		},
+		{
+			name:     "middle failure does not stop the others",
+			fail:     "2",
+			want:     []string{"com", "org"},
+			wantErr:  `"net"`,
+			wantExts: []string{"1", "2", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var exts []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", requestsHandler(t, list))
+			mux.HandleFunc("/czds/requests/extension/", func(w http.ResponseWriter, r *http.Request) {
+				id := strings.TrimPrefix(r.URL.Path, "/czds/requests/extension/")
+				mu.Lock()
+				exts = append(exts, id)
+				mu.Unlock()
+				if id == tt.fail {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, RequestsInfo{RequestID: id, ExtensionInProcess: true})
+			})
+			_, c := newTestServer(t, mux)
+
+			extended, err := c.ExtendTLDs([]string{"com", "net", "org"})
+			if !reflect.DeepEqual(extended, tt.want) {
+				t.Errorf("ExtendTLDs() = %v, want %v", extended, tt.want)
+			}
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ExtendTLDs() error = %v, want an error for %s", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(exts, tt.wantExts) {
+				t.Errorf("extension requested for %v, want %v", exts, tt.wantExts)
+			}
+		})
+	}
+}
+
+func TestExtendTLDsWithContext(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "com", Status: RequestApproved},
+		{RequestID: "2", TLD: "net", Status: RequestApproved},
+		{RequestID: "3", TLD: "org", Status: RequestApproved},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var exts []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", requestsHandler(t, list))
+	mux.HandleFunc("/czds/requests/extension/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/czds/requests/extension/")
+		exts = append(exts, id)
+		if id == "2" {
+			// rate limit for much longer than the test and stop while waiting it out
+			cancel()
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		writeJSON(t, w, RequestsInfo{RequestID: id, ExtensionInProcess: true})
+	})
+	_, c := newTestServer(t, mux)
+
+	extended, err := c.ExtendTLDsWithContext(ctx, []string{"com", "net", "org"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ExtendTLDsWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if !reflect.DeepEqual(extended, []string{"com"}) {
+		t.Errorf("ExtendTLDsWithContext() = %v, want [com]", extended)
+	}
+	if !reflect.DeepEqual(exts, []string{"1", "2"}) {
+		t.Errorf("extended request IDs %v, want [1 2]", exts)
+	}
+}
+
+// requestServer serves the TLD status, terms, and request creation endpoints
+// the body of every request submitted is sent on the returned channel
+func requestServer(t *testing.T, tlds []TLDStatus) (*Client, <-chan []byte) {
+	t.Helper()
+	bodies := make(chan []byte, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, tlds)
+	})
+	mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, Terms{Version: "1"})
+	})
+	mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		bodies <- body
+		writeJSON(t, w, emptyStruct)
+	})
+	_, c := newTestServer(t, mux)
+	return c, bodies
+}
+
+// submittedTLDs returns the TLDs of the next request submitted to a requestServer, or nil if none were submitted
+func submittedTLDs(t *testing.T, bodies <-chan []byte) []string {
+	t.Helper()
+	select {
+	case body := <-bodies:
+		var request RequestSubmission
+		err := json.Unmarshal(body, &request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return request.TLDNames
+	default:
+		return nil
+	}
+}
+
+func TestRequestTLDsAdditionalFTPIps(t *testing.T) {
+	tests := []struct {
+		name string
+		ips  []string
+		want string // expected additionalFtfIps JSON, empty if it should be omitted
+	}{
+		{"none", nil, ""},
+		{"ipv4 and ipv6", []string{"192.0.2.1", "2001:db8::1"}, `["192.0.2.1","2001:db8::1"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, bodies := requestServer(t, []TLDStatus{{TLD: "com", CurrentStatus: StatusAvailable}})
+			_, err := c.RequestTLDsWithOptions([]string{"com"}, "research", &RequestOptions{AdditionalFTPIps: tt.ips})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]json.RawMessage
+			err = json.Unmarshal(<-bodies, &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := body["additionalFtfIps"]
+			if tt.want == "" {
+				if ok {
+					t.Errorf("additionalFtfIps = %s, want it omitted", got)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("additionalFtfIps = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTLDsNormalized(t *testing.T) {
+	tests := []struct {
+		name    string
+		tlds    []string
+		want    []string // TLDs submitted, nil if nothing should be submitted
+		wantErr bool
+	}{
+		{"normalized", []string{" COM", "", "xn--P1AI "}, []string{"com", "xn--p1ai"}, false},
+		{"invalid is not submitted", []string{"com", "co m"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, bodies := requestServer(t, []TLDStatus{
+				{TLD: "com", CurrentStatus: StatusAvailable},
+				{TLD: "xn--p1ai", CurrentStatus: StatusAvailable},
+			})
+			got, err := c.RequestTLDsWithOptions(tt.tlds, "research", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequestTLDsWithOptions() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RequestTLDsWithOptions() = %q, want %q", got, tt.want)
+			}
+			if submitted := submittedTLDs(t, bodies); !reflect.DeepEqual(submitted, tt.want) {
+				t.Errorf("submitted %q, want %q", submitted, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestTLDsStatus(t *testing.T) {
+	status := []TLDStatus{
+		{TLD: "com", CurrentStatus: StatusAvailable},
+		{TLD: "net", CurrentStatus: StatusApproved},
+		{TLD: "org", CurrentStatus: StatusExpired},
+		{TLD: "info", CurrentStatus: StatusPending},
+		{TLD: "biz", CurrentStatus: StatusSubmitted},
+	}
+	tests := []struct {
+		name    string
+		tlds    []string
+		opts    RequestOptions
+		want    []string // TLDs submitted, nil if nothing should be submitted
+		wantErr string
+	}{
+		{"approved is skipped", []string{"com", "net", "org"}, RequestOptions{}, []string{"com", "org"}, ""},
+		{"pending and submitted are skipped", []string{"com", "info", "biz"}, RequestOptions{}, []string{"com"}, ""},
+		{"nothing left to request", []string{"net", "info", "biz"}, RequestOptions{}, nil, ""},
+		{"force requests approved", []string{"com", "net"}, RequestOptions{Force: true}, []string{"com", "net"}, ""},
+		{"check status skips approved", []string{"com", "net"}, RequestOptions{CheckStatus: true}, []string{"com"}, ""},
+		{"check status rejects approved", []string{"com", "net"}, RequestOptions{CheckStatus: true, Force: true}, nil, `"net" is approved`},
+		{"check status rejects unknown", []string{"com", "xyz"}, RequestOptions{CheckStatus: true}, nil, `"xyz" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, bodies := requestServer(t, status)
+			got, err := c.RequestTLDsWithOptions(tt.tlds, "research", &tt.opts)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("RequestTLDsWithOptions() error = %v, want %s", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("RequestTLDsWithOptions() = %q, want %q", got, tt.want)
+			}
+			if submitted := submittedTLDs(t, bodies); !slices.Equal(submitted, tt.want) {
+				t.Errorf("submitted %q, want %q", submitted, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRequestsExact(t *testing.T) {
+	list := []Request{
+		{RequestID: "1", TLD: "audible"},
+		{RequestID: "2", TLD: "audi"},
+		{RequestID: "3", TLD: "audio"},
+		{RequestID: "4", TLD: "AUDI"},
+	}
+	tests := []struct {
+		query string
+		want  []string // request IDs
+	}{
+		{"audi", []string{"2", "4"}},
+		{"Audio", []string{"3"}},
+		{"aud", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				// serve one request per page to check that every page is fetched
+				var filter RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				var matches []Request
+				for _, request := range list {
+					if strings.Contains(strings.ToLower(request.TLD), strings.ToLower(filter.Filter)) {
+						matches = append(matches, request)
+					}
+				}
+				resp := RequestsResponse{TotalRequests: int64(len(matches))}
+				if page := filter.Pagination.Page; page < len(matches) {
+					resp.Requests = matches[page : page+1]
+				}
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+
+			requests, err := c.GetRequestsExact(&RequestsFilter{Status: RequestAll, Filter: tt.query})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(requests))
+			for _, request := range requests {
+				got = append(got, request.RequestID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRequestsExact(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRequestHistory(t *testing.T) {
+	history := []HistoryEntry{
+		{Timestamp: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), Action: "Created"},
+		{Timestamp: time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC), Action: "Denied", Comment: "line one\nline two"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+		if id := strings.TrimPrefix(r.URL.Path, "/czds/requests/"); id != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(t, w, RequestsInfo{RequestID: "1", History: history})
+	})
+	_, c := newTestServer(t, mux)
+
+	got, err := c.GetRequestHistory("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, history) {
+		t.Errorf("GetRequestHistory() = %+v, want %+v", got, history)
+	}
+	_, err = c.GetRequestHistory("2")
+	if err == nil {
+		t.Error("GetRequestHistory() of a missing request returned no error")
+	}
+}
+
+func TestGetExpiringRequests(t *testing.T) {
+	now := time.Now()
+	days := func(n int) time.Time { return now.Add(time.Duration(n) * 24 * time.Hour) }
+	// sorted by expiration as requested by getApprovedRequestsExpiringBefore
+	list := []Request{
+		{RequestID: "0", TLD: "none", Status: RequestApproved, Expired: time.Unix(0, 0)},
+		{RequestID: "1", TLD: "com", Status: RequestApproved, Expired: days(5)},
+		{RequestID: "2", TLD: "net", Status: RequestApproved, Expired: days(20)},
+		{RequestID: "3", TLD: "org", Status: RequestApproved, Expired: days(45)},
+		{RequestID: "4", TLD: "xyz", Status: RequestApproved, Expired: days(90)},
+	}
+	tests := []struct {
+		name   string
+		within time.Duration
+		want   []string
+	}{
+		{"none", time.Hour, []string{}},
+		{"30 days", 30 * 24 * time.Hour, []string{"com", "net"}},
+		{"all", 365 * 24 * time.Hour, []string{"com", "net", "org", "xyz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+				var filter RequestsFilter
+				json.NewDecoder(r.Body).Decode(&filter)
+				if filter.Status != RequestApproved || filter.Sort.Field != SortByExpiration || filter.Sort.Direction != SortAsc {
+					t.Errorf("unexpected filter %+v", filter)
+				}
+				// two requests per page to check that paging stops at the deadline
+				resp := RequestsResponse{TotalRequests: int64(len(list))}
+				if start := filter.Pagination.Page * 2; start < len(list) {
+					resp.Requests = list[start:min(start+2, len(list))]
+				}
+				writeJSON(t, w, resp)
+			})
+			_, c := newTestServer(t, mux)
+
+			requests, err := c.GetExpiringRequests(tt.within)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(requests))
+			for _, request := range requests {
+				got = append(got, request.TLD)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetExpiringRequests(%s) = %v, want %v", tt.within, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetExpiringRequestsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var pages atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		// rate limit for much longer than the test and stop while waiting it out
+		pages.Add(1)
+		cancel()
+		w.Header().Set("Retry-After", "3600")
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+	_, c := newTestServer(t, mux)
+
+	_, err := c.GetExpiringRequestsWithContext(ctx, 30*24*time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetExpiringRequestsWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if n := pages.Load(); n != 1 {
+		t.Errorf("requested %d pages, want 1", n)
+	}
+}
+
+// concurrency tracks the peak number of concurrent calls
+type concurrency struct {
+	current, peak atomic.Int32
+}
+
+// start records the start of a call and returns the function to record its end
+func (c *concurrency) start() func() {
+	n := c.current.Add(1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	return func() { c.current.Add(-1) }
+}
+
+func TestFilterExtensible(t *testing.T) {
+	tests := []struct {
+		name    string
+		count   int
+		fail    string // request ID that fails
+		cancel  string // request ID whose check cancels the context
+		wantErr bool
+	}{
+		{"few", 3, "", "", false},
+		{"many", 40, "", "", false},
+		{"error", 40, "17", "", true},
+		{"canceled", 40, "", "3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var inFlight concurrency
+			var probes atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+				defer inFlight.start()()
+				probes.Add(1)
+				time.Sleep(5 * time.Millisecond)
+				id := strings.TrimPrefix(r.URL.Path, "/czds/requests/")
+				if id == tt.cancel {
+					cancel()
+				}
+				if id == tt.fail {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				// even request IDs are extensible
+				i, _ := strconv.Atoi(id)
+				writeJSON(t, w, RequestsInfo{RequestID: id, Extensible: i%2 == 0})
+			})
+			_, c := newTestServer(t, mux)
+
+			requests := make([]Request, 0, tt.count)
+			want := make([]string, 0, tt.count)
+			for i := 0; i < tt.count; i++ {
+				id := strconv.Itoa(i)
+				requests = append(requests, Request{RequestID: id, TLD: "tld" + id})
+				if i%2 == 0 {
+					want = append(want, id)
+				}
+			}
+			extensible, err := c.filterExtensible(ctx, requests)
+			if tt.cancel != "" {
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("filterExtensible() error = %v, want %v", err, context.Canceled)
+				}
+				// the checks already started may finish, but no more are started
+				if n := probes.Load(); n >= int32(tt.count) {
+					t.Errorf("checked %d requests after the context was canceled, want fewer than %d", n, tt.count)
+				}
+				return
+			}
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), `"tld`+tt.fail+`"`) {
+					t.Errorf("filterExtensible() error = %v, want an error for tld%s", err, tt.fail)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(extensible))
+			for _, r := range extensible {
+				got = append(got, r.RequestID)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("filterExtensible() = %v, want %v", got, want)
+			}
+			// the probes run in parallel, but never more than extensibleProbeWorkers at once
+			if peak := inFlight.peak.Load(); peak > extensibleProbeWorkers || peak < 2 {
+				t.Errorf("%d requests in flight at once, want 2 to %d", peak, extensibleProbeWorkers)
+			}
+		})
+	}
+}
+
+func TestGetTLDStatusCache(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		submit      bool // submit a request between the calls
+		wantFetches int32
+	}{
+		{"disabled", 0, false, 2},
+		{"cached", time.Minute, false, 1},
+		{"expired", time.Nanosecond, false, 2},
+		{"invalidated by a request", time.Minute, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				fetches.Add(1)
+				writeJSON(t, w, []TLDStatus{{TLD: "com", CurrentStatus: StatusAvailable}})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+			c.TLDStatusCacheTTL = tt.ttl
+
+			first, err := c.GetTLDStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// changing the returned status must not change the cache
+			first[0].CurrentStatus = StatusApproved
+			if tt.submit {
+				err = c.SubmitRequest(&RequestSubmission{TLDNames: []string{"com"}})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			time.Sleep(time.Millisecond)
+			second, err := c.GetTLDStatus()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second[0].CurrentStatus != StatusAvailable {
+				t.Errorf("status = %q, want %q", second[0].CurrentStatus, StatusAvailable)
+			}
+			if n := fetches.Load(); n != tt.wantFetches {
+				t.Errorf("fetched %d times, want %d", n, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestGetRequestInfos(t *testing.T) {
+	tests := []struct {
+		name     string
+		parallel int
+		fail     string // request ID that fails
+		wantPeak int32
+	}{
+		{"serial", 1, "", 1},
+		{"parallel", 3, "", 3},
+		{"invalid parallel is serial", 0, "", 1},
+		{"error", 3, "4", 3},
+	}
+	ids := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight concurrency
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+				defer inFlight.start()()
+				time.Sleep(5 * time.Millisecond)
+				id := strings.TrimPrefix(r.URL.Path, "/czds/requests/")
+				if id == tt.fail {
+					http.Error(w, "bad request", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, RequestsInfo{RequestID: id, Status: RequestApproved})
+			})
+			_, c := newTestServer(t, mux)
+
+			infos, err := c.GetRequestInfos(ids, tt.parallel)
+			if tt.fail == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.fail != "" && (err == nil || !strings.Contains(err.Error(), `"`+tt.fail+`"`)) {
+				t.Errorf("GetRequestInfos() error = %v, want an error for %q", err, tt.fail)
+			}
+			for _, id := range ids {
+				info, ok := infos[id]
+				if id == tt.fail {
+					if ok {
+						t.Errorf("[%s] failed request is in the result", id)
+					}
+					continue
+				}
+				if !ok || info.RequestID != id {
+					t.Errorf("[%s] info = %+v, want request %s", id, info, id)
+				}
+			}
+			// bounded by parallel, and concurrent when allowed
+			if peak := inFlight.peak.Load(); peak > tt.wantPeak || (tt.wantPeak > 1 && peak < 2) {
+				t.Errorf("%d requests in flight at once, want up to %d", peak, tt.wantPeak)
+			}
+		})
+	}
+}
+
+func TestGetRequestInfosWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var fetched atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/czds/requests/")
+		fetched.Add(1)
+		if id == "2" {
+			cancel()
+		}
+		writeJSON(t, w, RequestsInfo{RequestID: id, Status: RequestApproved})
+	})
+	_, c := newTestServer(t, mux)
+
+	ids := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8"}
+	infos, err := c.GetRequestInfosWithContext(ctx, ids, 1)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetRequestInfosWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	for _, id := range []string{"0", "1"} {
+		if infos[id] == nil {
+			t.Errorf("[%s] request fetched before the context was canceled is missing", id)
+		}
+	}
+	if n := fetched.Load(); n != 3 {
+		t.Errorf("fetched %d requests, want 3", n)
+	}
+}
+
+func TestGetRequestableTLDs(t *testing.T) {
+	tests := []struct {
+		name string
+		tlds []TLDStatus
+		want []string
+	}{
+		{
+			name: "mixed",
+			tlds: []TLDStatus{
+				{TLD: "available", CurrentStatus: StatusAvailable},
+				{TLD: "submitted", CurrentStatus: StatusSubmitted},
+				{TLD: "pending", CurrentStatus: StatusPending},
+				{TLD: "approved", CurrentStatus: StatusApproved},
+				{TLD: "denied", CurrentStatus: StatusDenied},
+				{TLD: "expired", CurrentStatus: StatusExpired},
+				{TLD: "canceled", CurrentStatus: StatusCanceled},
+				{TLD: "revoked", CurrentStatus: StatusRevoked},
+				{TLD: "unknown", CurrentStatus: "unknown"},
+			},
+			want: []string{"available", "denied", "expired", "canceled", "revoked"},
+		},
+		{
+			name: "none requestable",
+			tlds: []TLDStatus{
+				{TLD: "com", CurrentStatus: StatusApproved},
+				{TLD: "net", CurrentStatus: StatusPending},
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := requestServer(t, tt.tlds)
+			requestable, err := c.GetRequestableTLDs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(requestable))
+			for _, tld := range requestable {
+				got = append(got, tld.TLD)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRequestableTLDs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAutoRenew(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		status  int // status of the response, 200 returns the updated request
+		wantErr bool
+	}{
+		{"enable", true, http.StatusOK, false},
+		{"disable", false, http.StatusOK, false},
+		{"server error", true, http.StatusBadRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/autorenew/", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("method = %s, want POST", r.Method)
+				}
+				var payload map[string]interface{}
+				err := json.NewDecoder(r.Body).Decode(&payload)
+				if err != nil {
+					t.Error(err)
+				}
+				if want := map[string]interface{}{"autoRenew": tt.enabled}; !reflect.DeepEqual(payload, want) {
+					t.Errorf("payload = %v, want %v", payload, want)
+				}
+				if tt.status != http.StatusOK {
+					http.Error(w, "auto-renew is not available", tt.status)
+					return
+				}
+				id := strings.TrimPrefix(r.URL.Path, "/czds/requests/autorenew/")
+				writeJSON(t, w, RequestsInfo{RequestID: id, AutoRenew: tt.enabled})
+			})
+			_, c := newTestServer(t, mux)
+			info, err := c.SetAutoRenew("request-1", tt.enabled)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "request-1") {
+					t.Fatalf("SetAutoRenew() error = %v, want an error for request-1", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.RequestID != "request-1" || info.AutoRenew != tt.enabled {
+				t.Errorf("SetAutoRenew() = %+v, want request-1 with AutoRenew %t", info, tt.enabled)
+			}
+		})
+	}
+}
+
+func TestRequestAllTLDsExceptResult(t *testing.T) {
+	status := []TLDStatus{
+		{TLD: "com", CurrentStatus: StatusAvailable},
+		{TLD: "net", CurrentStatus: StatusApproved},
+		{TLD: "org", CurrentStatus: StatusPending},
+		{TLD: "xyz", CurrentStatus: StatusExpired},
+		{TLD: "info", CurrentStatus: StatusSubmitted},
+		{TLD: "biz", CurrentStatus: StatusDenied},
+		{TLD: "app", CurrentStatus: StatusCanceled},
+	}
+	tests := []struct {
+		name          string
+		except        []string
+		fail          bool // the request submission is rejected
+		wantRequested []string
+		wantFailed    []string
+		wantSkipped   []string
+		wantExcluded  []string
+	}{
+		{
+			name:          "no except",
+			wantRequested: []string{"app", "biz", "com", "xyz"},
+			wantFailed:    []string{},
+			wantSkipped:   []string{"info", "net", "org"},
+			wantExcluded:  []string{},
+		},
+		{
+			name:          "except requestable and not",
+			except:        []string{"COM", "net"},
+			wantRequested: []string{"app", "biz", "xyz"},
+			wantFailed:    []string{},
+			wantSkipped:   []string{"info", "org"},
+			wantExcluded:  []string{"com", "net"},
+		},
+		{
+			name:          "nothing to request",
+			except:        []string{"com", "xyz", "biz", "app"},
+			wantRequested: []string{},
+			wantFailed:    []string{},
+			wantSkipped:   []string{"info", "net", "org"},
+			wantExcluded:  []string{"app", "biz", "com", "xyz"},
+		},
+		{
+			name:          "rejected",
+			except:        []string{"app"},
+			fail:          true,
+			wantRequested: []string{},
+			wantFailed:    []string{"biz", "com", "xyz"},
+			wantSkipped:   []string{"info", "net", "org"},
+			wantExcluded:  []string{"app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submitted []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, status)
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				var request RequestSubmission
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					t.Error(err)
+				}
+				submitted = append(submitted, request.TLDNames...)
+				if tt.fail {
+					http.Error(w, "rejected", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+
+			result, err := c.RequestAllTLDsExceptWithResult("research", tt.except, nil)
+			if (err != nil) != tt.fail {
+				t.Fatalf("RequestAllTLDsExceptWithResult() error = %v, want error: %t", err, tt.fail)
+			}
+			got := map[string][]string{
+				"requested": result.Requested,
+				"failed":    result.Failed,
+				"skipped":   result.Skipped,
+				"excluded":  result.Excluded,
+			}
+			want := map[string][]string{
+				"requested": tt.wantRequested,
+				"failed":    tt.wantFailed,
+				"skipped":   tt.wantSkipped,
+				"excluded":  tt.wantExcluded,
+			}
+			for category, tlds := range got {
+				sorted := slices.Clone(tlds)
+				slices.Sort(sorted)
+				if !slices.Equal(sorted, want[category]) {
+					t.Errorf("%s = %v, want %v", category, sorted, want[category])
+				}
+			}
+			slices.Sort(submitted)
+			wantSubmitted := append(slices.Clone(tt.wantRequested), tt.wantFailed...)
+			slices.Sort(wantSubmitted)
+			if !slices.Equal(submitted, wantSubmitted) {
+				t.Errorf("submitted %v, want %v", submitted, wantSubmitted)
+			}
+		})
+	}
+}
+
+func TestRequestAllTLDsExceptBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		tlds      int
+		batchSize int
+		fail      int // submission that fails, 0 for none
+		wantSizes []int
+		wantAll   bool // the single submission is for all TLDs
+	}{
+		{"default batch size", 250, 0, 0, []int{100, 100, 50}, false},
+		{"exact multiple", 200, 100, 0, []int{100, 100}, false},
+		{"single batch", 50, 0, 0, []int{50}, true},
+		{"small batches", 5, 2, 0, []int{2, 2, 1}, false},
+		{"failed batch", 5, 2, 2, []int{2, 2, 1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := make([]TLDStatus, 0, tt.tlds+1)
+			for i := 0; i < tt.tlds; i++ {
+				status = append(status, TLDStatus{TLD: fmt.Sprintf("tld%03d", i), CurrentStatus: StatusAvailable})
+			}
+			status = append(status, TLDStatus{TLD: "approved", CurrentStatus: StatusApproved})
+			var submissions []RequestSubmission
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, status)
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				var request RequestSubmission
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					t.Error(err)
+				}
+				submissions = append(submissions, request)
+				if len(submissions) == tt.fail {
+					http.Error(w, "rejected", http.StatusBadRequest)
+					return
+				}
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+
+			result, err := c.RequestAllTLDsExceptWithResult("research", nil, &RequestOptions{BatchSize: tt.batchSize})
+			if (err != nil) != (tt.fail != 0) {
+				t.Fatalf("RequestAllTLDsExceptWithResult() error = %v, want error: %t", err, tt.fail != 0)
+			}
+			sizes := make([]int, 0, len(submissions))
+			submitted := make(map[string]bool)
+			for _, submission := range submissions {
+				sizes = append(sizes, len(submission.TLDNames))
+				if submission.AllTLDs != tt.wantAll {
+					t.Errorf("submission allTlds = %t, want %t", submission.AllTLDs, tt.wantAll)
+				}
+				for _, tld := range submission.TLDNames {
+					if submitted[tld] {
+						t.Errorf("%s submitted twice", tld)
+					}
+					submitted[tld] = true
+				}
+			}
+			if !slices.Equal(sizes, tt.wantSizes) {
+				t.Errorf("submitted batches of %v, want %v", sizes, tt.wantSizes)
+			}
+			if len(submitted) != tt.tlds {
+				t.Errorf("submitted %d TLDs, want %d", len(submitted), tt.tlds)
+			}
+			wantFailed := 0
+			if tt.fail != 0 {
+				wantFailed = len(submissions[tt.fail-1].TLDNames)
+			}
+			if len(result.Failed) != wantFailed || len(result.Requested) != tt.tlds-wantFailed {
+				t.Errorf("requested %d and failed %d, want %d and %d", len(result.Requested), len(result.Failed), tt.tlds-wantFailed, wantFailed)
+			}
+			if !slices.Equal(result.Skipped, []string{"approved"}) {
+				t.Errorf("skipped %v, want [approved]", result.Skipped)
+			}
+		})
+	}
+}
+
+func TestGetRequestInfoRaw(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"api typo", `{"requestId":"1","tld":{"tld":"xn--p1ai","ulable":"","currentStatus":"approved","sftp":false},"status":"Approved"}`},
+		{"unknown fields", `{"requestId":"2","newField":{"nested":[1,2,3]},"status":"Pending"}`},
+		{"formatting is kept", "{\n  \"requestId\": \"3\",\n  \"status\": \"Denied\"\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body + "\n"))
+			})
+			_, c := newTestServer(t, mux)
+			raw, err := c.GetRequestInfoRaw("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != tt.body {
+				t.Errorf("GetRequestInfoRaw() = %s, want %s", raw, tt.body)
+			}
+		})
+	}
+}
+
+func TestWaitForStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		statuses    []string // status returned by each poll, the last is repeated
+		target      string
+		cancelAfter int  // polls before the context is cancelled, 0 for never
+		notFound    bool // the request does not exist
+		wantPolls   int
+		wantStatus  string // status of the returned request, empty for none
+		wantErr     bool
+	}{
+		{"pending to approved", []string{RequestSubmitted, RequestPending, RequestPending, RequestApproved}, "approved", 0, false, 4, RequestApproved, false},
+		{"already approved", []string{RequestApproved}, RequestApproved, 0, false, 1, RequestApproved, false},
+		{"denied", []string{RequestPending, RequestDenied}, "approved", 0, false, 2, RequestDenied, true},
+		{"revoked", []string{RequestApproved, RequestRevoked}, "expired", 0, false, 2, RequestRevoked, true},
+		{"wait for denied", []string{RequestPending, RequestDenied}, "denied", 0, false, 2, RequestDenied, false},
+		{"cancelled", []string{RequestPending}, "approved", 3, false, 3, "", true},
+		{"not found", []string{RequestPending}, "approved", 0, true, 1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			polls := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/abc", func(w http.ResponseWriter, r *http.Request) {
+				polls++
+				if tt.notFound {
+					http.Error(w, "not found", http.StatusNotFound)
+					return
+				}
+				if polls == tt.cancelAfter {
+					cancel()
+				}
+				status := tt.statuses[min(polls, len(tt.statuses))-1]
+				writeJSON(t, w, RequestsInfo{RequestID: "abc", Status: status})
+			})
+			_, c := newTestServer(t, mux)
+
+			info, err := c.WaitForStatusWithContext(ctx, "abc", tt.target, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WaitForStatusWithContext() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if tt.cancelAfter > 0 && !errors.Is(err, context.Canceled) {
+				t.Errorf("WaitForStatusWithContext() error = %v, want %v", err, context.Canceled)
+			}
+			if polls != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", polls, tt.wantPolls)
+			}
+			status := ""
+			if info != nil {
+				status = info.Status
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTermsCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		changed      bool // the terms version changes after the first submission
+		wantFetches  int
+		wantVersions []string // terms version of every submission
+	}{
+		{"not cached", 0, false, 2, []string{"1", "1"}},
+		{"cached", time.Minute, false, 1, []string{"1", "1"}},
+		{"expired", time.Nanosecond, false, 2, []string{"1", "1"}},
+		{"changed", time.Minute, true, 2, []string{"1", "1", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version := "1"
+			fetches := 0
+			var versions []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, []TLDStatus{{TLD: "com", CurrentStatus: StatusAvailable}, {TLD: "net", CurrentStatus: StatusAvailable}})
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				fetches++
+				writeJSON(t, w, Terms{Version: version})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				var request RequestSubmission
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					t.Error(err)
+				}
+				versions = append(versions, request.TcVersion)
+				if request.TcVersion != version {
+					w.WriteHeader(http.StatusBadRequest)
+					writeJSON(t, w, errorResponse{Message: "invalid tcVersion", HTTPStatus: http.StatusBadRequest})
+					return
+				}
+				if tt.changed {
+					version = "2"
+				}
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+			c.TermsCacheTTL = tt.ttl
+
+			_, err := c.RequestTLDsWithOptions([]string{"com"}, "research", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = c.RequestAllTLDsExcept("research", []string{"com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fetches != tt.wantFetches {
+				t.Errorf("terms fetched %d times, want %d", fetches, tt.wantFetches)
+			}
+			if !slices.Equal(versions, tt.wantVersions) {
+				t.Errorf("submitted terms versions %v, want %v", versions, tt.wantVersions)
+			}
+		})
+	}
+}
+
+func TestGetTermsNotLockedDuringFetch(t *testing.T) {
+	fetching := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		<-release
+		writeJSON(t, w, Terms{Version: "1"})
+	})
+	_, c := newTestServer(t, mux)
+	c.TermsCacheTTL = time.Minute
+
+	done := make(chan error)
+	go func() {
+		_, err := c.GetTerms()
+		done <- err
+	}()
+	<-fetching
+	// the cache can be invalidated while the terms are being fetched
+	invalidated := make(chan struct{})
+	go func() {
+		c.invalidateTerms()
+		close(invalidated)
+	}()
+	select {
+	case <-invalidated:
+	case <-time.After(5 * time.Second):
+		t.Error("invalidating the terms blocked on the fetch")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubmitTermsChanged(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int    // status of the rejected submissions
+		message      string // message of the rejected submissions
+		newVersion   string // terms version after the first submission
+		rejectAll    bool   // every submission is rejected, not only those with an old version
+		wantVersions []string
+		wantErr      bool
+	}{
+		{"terms changed", http.StatusBadRequest, "Terms and conditions version is outdated", "2", false, []string{"1", "2"}, false},
+		{"tcVersion changed", http.StatusConflict, "invalid tcVersion", "2", false, []string{"1", "2"}, false},
+		{"terms unchanged", http.StatusBadRequest, "terms not accepted", "1", true, []string{"1"}, true},
+		{"retry rejected", http.StatusBadRequest, "terms not accepted", "2", true, []string{"1", "2"}, true},
+		{"other error", http.StatusBadRequest, "invalid reason", "2", false, []string{"1"}, true},
+		{"server error", http.StatusInternalServerError, "terms service unavailable", "2", false, []string{"1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version := "1"
+			var versions []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, []TLDStatus{{TLD: "com", CurrentStatus: StatusAvailable}})
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, Terms{Version: version})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				var request RequestSubmission
+				err := json.NewDecoder(r.Body).Decode(&request)
+				if err != nil {
+					t.Error(err)
+				}
+				versions = append(versions, request.TcVersion)
+				// the terms change while the first request is in flight
+				version = tt.newVersion
+				if tt.rejectAll || request.TcVersion != version {
+					w.WriteHeader(tt.status)
+					writeJSON(t, w, errorResponse{Message: tt.message, HTTPStatus: tt.status})
+					return
+				}
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+			c.RetryDelay = time.Millisecond
+
+			requested, err := c.RequestTLDsWithOptions([]string{"com"}, "research", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RequestTLDsWithOptions() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(requested, []string{"com"}) {
+				t.Errorf("requested %v, want [com]", requested)
+			}
+			if !slices.Equal(versions, tt.wantVersions) {
+				t.Errorf("submitted terms versions %v, want %v", versions, tt.wantVersions)
+			}
+		})
+	}
+}
+
+func TestGetInactiveRequests(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	hours := func(n int) time.Time { return now.Add(-time.Duration(n) * time.Hour) }
+	tests := []struct {
+		name string
+		list []Request
+		want []string // IDs of the inactive requests, newest first
+	}{
+		{
+			name: "mixed statuses",
+			list: []Request{
+				{RequestID: "com", TLD: "com", Status: RequestApproved, Created: hours(1)},
+				{RequestID: "net", TLD: "net", Status: RequestExpired, Created: hours(2)},
+				{RequestID: "org", TLD: "org", Status: RequestRevoked, Created: hours(3)},
+				{RequestID: "xyz", TLD: "xyz", Status: RequestDenied, Created: hours(4)},
+				{RequestID: "app", TLD: "app", Status: RequestPending, Created: hours(5)},
+				{RequestID: "biz", TLD: "biz", Status: RequestCanceled, Created: hours(6)},
+				{RequestID: "info", TLD: "info", Status: RequestSubmitted, Created: hours(7)},
+			},
+			want: []string{"net", "org", "xyz"},
+		},
+		{
+			name: "only the newest request of a TLD",
+			list: []Request{
+				{RequestID: "net-old", TLD: "net", Status: RequestExpired, Created: hours(100)},
+				{RequestID: "net-new", TLD: "net", Status: RequestApproved, Created: hours(1)},
+				{RequestID: "org-old", TLD: "org", Status: RequestApproved, Created: hours(100)},
+				{RequestID: "org-new", TLD: "org", Status: RequestRevoked, Created: hours(2)},
+				{RequestID: "xyz-old", TLD: "xyz", Status: RequestDenied, Created: hours(200)},
+				{RequestID: "xyz-new", TLD: "xyz", Status: RequestPending, Created: hours(3)},
+			},
+			want: []string{"org-new"},
+		},
+		{
+			name: "case insensitive",
+			list: []Request{
+				{RequestID: "net", TLD: "net", Status: "expired", Created: hours(1)},
+				{RequestID: "NET", TLD: "NET", Status: RequestApproved, Created: hours(2)},
+				{RequestID: "org", TLD: "org", Status: "REVOKED", Created: hours(3)},
+			},
+			want: []string{"net", "org"},
+		},
+		{
+			name: "none",
+			list: []Request{
+				{RequestID: "com", TLD: "com", Status: RequestApproved, Created: hours(1)},
+				{RequestID: "net", TLD: "net", Status: RequestPending, Created: hours(2)},
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/requests/all", requestsHandler(t, tt.list))
+			_, c := newTestServer(t, mux)
+
+			requests, err := c.GetInactiveRequests()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(requests))
+			for _, request := range requests {
+				got = append(got, request.RequestID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetInactiveRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInactiveRequestsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var pages atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/czds/requests/all", func(w http.ResponseWriter, r *http.Request) {
+		pages.Add(1)
+		writeJSON(t, w, RequestsResponse{})
+	})
+	_, c := newTestServer(t, mux)
+
+	_, err := c.GetInactiveRequestsWithContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetInactiveRequestsWithContext() error = %v, want %v", err, context.Canceled)
+	}
+	if n := pages.Load(); n != 0 {
+		t.Errorf("requested %d pages with a canceled context", n)
+	}
+}
+
+func TestReRequestExpired(t *testing.T) {
+	status := []TLDStatus{
+		{TLD: "com", CurrentStatus: StatusApproved},
+		{TLD: "net", CurrentStatus: StatusExpired},
+		{TLD: "org", CurrentStatus: StatusRevoked},
+		{TLD: "xyz", CurrentStatus: StatusDenied},
+		{TLD: "app", CurrentStatus: StatusCanceled},
+		{TLD: "biz", CurrentStatus: StatusAvailable},
+		{TLD: "info", CurrentStatus: StatusPending},
+		{TLD: "io", CurrentStatus: StatusSubmitted},
+	}
+	tests := []struct {
+		name   string
+		status []TLDStatus
+		except []string
+		want   []string
+	}{
+		{"previously held", status, nil, []string{"net", "org", "xyz", "app"}},
+		{"except is case insensitive", status, []string{"NET", "app"}, []string{"org", "xyz"}},
+		{"all excepted", status, []string{"net", "org", "xyz", "app"}, nil},
+		{"never held", []TLDStatus{{TLD: "com", CurrentStatus: StatusApproved}, {TLD: "biz", CurrentStatus: StatusAvailable}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, bodies := requestServer(t, tt.status)
+
+			requested, err := c.ReRequestExpired("research", tt.except)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(requested, tt.want) {
+				t.Errorf("ReRequestExpired() = %v, want %v", requested, tt.want)
+			}
+			if got := submittedTLDs(t, bodies); !slices.Equal(got, tt.want) {
+				t.Errorf("submitted %v, want %v", got, tt.want)
+			}
+			if extra := submittedTLDs(t, bodies); extra != nil {
+				t.Errorf("submitted again: %v", extra)
+			}
+		})
+	}
+}
+
+func TestReRequestExpiredWithContext(t *testing.T) {
+	status := []TLDStatus{
+		{TLD: "com", CurrentStatus: StatusApproved},
+		{TLD: "net", CurrentStatus: StatusExpired},
+	}
+	tests := []struct {
+		name    string
+		cancel  bool // cancel the context while waiting out the rate limit
+		want    []string
+		wantErr error
+	}{
+		{"rate limit is waited out", false, []string{"net"}, nil},
+		{"canceled while rate limited", true, nil, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var creates atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, status)
+			})
+			mux.HandleFunc("/czds/terms/condition", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(t, w, Terms{Version: "1"})
+			})
+			mux.HandleFunc("/czds/requests/create", func(w http.ResponseWriter, r *http.Request) {
+				if creates.Add(1) == 1 {
+					if tt.cancel {
+						cancel()
+						w.Header().Set("Retry-After", "3600")
+					} else {
+						w.Header().Set("Retry-After", "1")
+					}
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+					return
+				}
+				writeJSON(t, w, emptyStruct)
+			})
+			_, c := newTestServer(t, mux)
+
+			requested, err := c.ReRequestExpiredWithContext(ctx, "research", nil, nil)
+			if tt.wantErr == nil && err != nil {
+				t.Fatal(err)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ReRequestExpiredWithContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(requested, tt.want) {
+				t.Errorf("ReRequestExpiredWithContext() = %v, want %v", requested, tt.want)
+			}
+		})
+	}
+}
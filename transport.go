@@ -0,0 +1,51 @@
+package czds
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// headers that are never logged by debugTransport
+var sensitiveHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Set-Cookie":    true,
+}
+
+// debugTransport is an http.RoundTripper that logs every request and response
+type debugTransport struct {
+	next   http.RoundTripper
+	logger Logger
+}
+
+// RoundTrip logs the request, sends it with the next RoundTripper, and logs the response or error
+// request bodies are never logged as they may contain credentials
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.logger.Printf("HTTP request: %s %s headers: %s", req.Method, req.URL, formatHeaders(req.Header))
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.logger.Printf("HTTP error: %s %s after %s: %s", req.Method, req.URL, elapsed, err)
+		return resp, err
+	}
+	t.logger.Printf("HTTP response: %s %s %s in %s, content-length: %d headers: %s",
+		req.Method, req.URL, resp.Status, elapsed, resp.ContentLength, formatHeaders(resp.Header))
+	return resp, nil
+}
+
+// formatHeaders returns the headers as a sorted list of key=value pairs with the values of sensitiveHeaders redacted
+func formatHeaders(header http.Header) string {
+	pairs := make([]string, 0, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ",")
+		if sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			value = redacted
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return "[" + strings.Join(pairs, " ") + "]"
+}
@@ -0,0 +1,111 @@
+package czds
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		call      func(c *Client) error
+		path      string // path of the logged request
+		method    string
+		wantLines []string // prefixes of the lines logged for the request, after authentication
+	}{
+		{
+			name:   "api request",
+			call:   func(c *Client) error { _, err := c.GetTLDStatus(); return err },
+			path:   "/czds/tlds",
+			method: "GET",
+			wantLines: []string{
+				"HTTP request: GET {url}/czds/tlds headers: [Accept=application/json Authorization=[redacted] User-Agent=",
+				"HTTP response: GET {url}/czds/tlds 200 OK in ",
+			},
+		},
+		{
+			name:   "download info",
+			call:   func(c *Client) error { _, err := c.GetDownloadInfo(c.BaseURL + "/czds/downloads/com.zone"); return err },
+			path:   "/czds/downloads/com.zone",
+			method: "HEAD",
+			wantLines: []string{
+				"HTTP request: HEAD {url}/czds/downloads/com.zone headers: [Accept-Encoding=identity Accept=application/json Authorization=[redacted] User-Agent=",
+				"HTTP response: HEAD {url}/czds/downloads/com.zone 200 OK in ",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/tlds", func(w http.ResponseWriter, r *http.Request) {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-session"})
+				w.Write([]byte("[]"))
+			})
+			mux.HandleFunc("/czds/downloads/", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Disposition", "attachment; filename=com.txt.gz")
+				w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			})
+			ts, c := newTestServer(t, mux)
+			c.Creds.Password = "secret-password"
+			logger := &printfLogger{}
+			c.HTTPClient = NewHTTPClient(&HTTPClientOptions{DebugLogger: logger})
+			err := tt.call(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.authMutex.Lock()
+			token := c.auth.AccessToken
+			c.authMutex.Unlock()
+			var lines []string
+			for _, line := range logger.lines {
+				for _, secret := range []string{token, "secret-password", "secret-session"} {
+					if strings.Contains(line, secret) {
+						t.Errorf("logged a secret: %q", line)
+					}
+				}
+				if strings.Contains(line, tt.path) {
+					lines = append(lines, line)
+				}
+			}
+			if len(lines) != len(tt.wantLines) {
+				t.Fatalf("logged %q, want %d lines for %s", lines, len(tt.wantLines), tt.path)
+			}
+			for i, want := range tt.wantLines {
+				want = strings.ReplaceAll(want, "{url}", ts.URL)
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("line %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+			if tt.path == "/czds/tlds" && !strings.Contains(lines[1], "Set-Cookie=[redacted]") {
+				t.Errorf("response line %q does not redact Set-Cookie", lines[1])
+			}
+		})
+	}
+}
+
+func TestDebugTransportError(t *testing.T) {
+	logger := &printfLogger{}
+	ts, c := newTestServer(t, http.NewServeMux())
+	c.Creds.Password = "secret-password"
+	c.HTTPClient = NewHTTPClient(&HTTPClientOptions{DebugLogger: logger})
+	ts.Close()
+	err := c.Authenticate()
+	if err == nil {
+		t.Fatal("Authenticate() with the server closed succeeded")
+	}
+	var errors int
+	for _, line := range logger.lines {
+		if strings.HasPrefix(line, "HTTP error: POST "+ts.URL+"/api/authenticate after ") {
+			errors++
+		}
+		if strings.Contains(line, "secret-password") {
+			t.Errorf("logged the password: %q", line)
+		}
+	}
+	if errors == 0 {
+		t.Errorf("logged %q, want the connection errors", logger.lines)
+	}
+}
@@ -1,13 +1,69 @@
 package czds
 
-import "strings"
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Jitter returns d randomized by ±50% to spread out retries
+func Jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)+1))
+}
 
 func slice2LowerMap(array []string) map[string]bool {
 	out := make(map[string]bool)
 
 	for _, s := range array {
-		out[strings.ToLower(s)] = true
+		out[toASCIIOrSame(strings.ToLower(s))] = true
 	}
 
 	return out
 }
+
+// normalizeTLDs trims, lowercases, and removes empty and duplicate entries from tlds
+// and returns an error if any of the remaining entries are not valid TLD labels
+func normalizeTLDs(tlds []string) ([]string, error) {
+	out := make([]string, 0, len(tlds))
+	invalid := make([]string, 0)
+	seen := make(map[string]bool, len(tlds))
+	for _, tld := range tlds {
+		tld = toASCIIOrSame(strings.ToLower(strings.TrimSpace(tld)))
+		if len(tld) == 0 || seen[tld] {
+			continue
+		}
+		seen[tld] = true
+		if !validLabel(tld) {
+			invalid = append(invalid, tld)
+			continue
+		}
+		out = append(out, tld)
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid TLD names: %q", invalid)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no TLD names provided")
+	}
+	return out, nil
+}
+
+// validLabel returns true if label is a valid lowercase DNS label, including IDN punycode labels
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package czds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTLDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		tlds    []string
+		want    []string
+		wantErr bool
+	}{
+		{"unchanged", []string{"com", "net"}, []string{"com", "net"}, false},
+		{"empty elements are dropped", []string{"com", "", " ", "net"}, []string{"com", "net"}, false},
+		{"whitespace and case", []string{" COM ", "\tNet\n"}, []string{"com", "net"}, false},
+		{"duplicates are dropped", []string{"com", "COM", " com"}, []string{"com"}, false},
+		{"punycode", []string{"xn--p1ai", "XN--P1AI"}, []string{"xn--p1ai"}, false},
+		{"unicode is converted to punycode", []string{"рф"}, []string{"xn--p1ai"}, false},
+		{"inner space", []string{"co m"}, nil, true},
+		{"invalid characters", []string{"com", "ne_t"}, nil, true},
+		{"leading hyphen", []string{"-com"}, nil, true},
+		{"dotted name", []string{"example.com"}, nil, true},
+		{"only empty elements", []string{"", " "}, nil, true},
+		{"none", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeTLDs(tt.tlds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeTLDs(%q) error = %v, want error: %t", tt.tlds, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeTLDs(%q) = %q, want %q", tt.tlds, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        time.Duration
+		min, max time.Duration
+	}{
+		{"seconds", 15 * time.Second, 7500 * time.Millisecond, 22500 * time.Millisecond},
+		{"milliseconds", 10 * time.Millisecond, 5 * time.Millisecond, 15 * time.Millisecond},
+		{"nanosecond", 1, 0, 1},
+		{"zero", 0, 0, 0},
+		{"negative", -time.Second, -time.Second, -time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lowest, highest := tt.max, tt.min
+			for i := 0; i < 1000; i++ {
+				got := Jitter(tt.d)
+				if got < tt.min || got > tt.max {
+					t.Fatalf("Jitter(%s) = %s, want between %s and %s", tt.d, got, tt.min, tt.max)
+				}
+				lowest, highest = min(lowest, got), max(highest, got)
+			}
+			// the delays must be spread over the range, not all the same
+			if spread := (tt.max - tt.min) / 2; highest-lowest < spread {
+				t.Errorf("Jitter(%s) ranged from %s to %s, want a spread of at least %s", tt.d, lowest, highest, spread)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package czds
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+)
+
+// module path of this library, used to find its version in the build info
+const modulePath = "github.com/lanrat/czds"
+
+// BuildInfo returns a description of the running binary for bug reports:
+// the version of this module, the Go version, and the VCS revision and time when built with -buildvcs
+func BuildInfo() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "build info: unavailable"
+	}
+	return formatBuildInfo(info)
+}
+
+// formatBuildInfo formats info for BuildInfo
+func formatBuildInfo(info *debug.BuildInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Module: %s %s\n", modulePath, moduleVersion(info))
+	fmt.Fprintf(&b, "Go: %s %s/%s\n", info.GoVersion, buildSetting(info, "GOOS"), buildSetting(info, "GOARCH"))
+	if revision := buildSetting(info, "vcs.revision"); len(revision) > 0 {
+		if buildSetting(info, "vcs.modified") == "true" {
+			revision += " (modified)"
+		}
+		fmt.Fprintf(&b, "Revision: %s\n", revision)
+	}
+	if vcsTime := buildSetting(info, "vcs.time"); len(vcsTime) > 0 {
+		fmt.Fprintf(&b, "Revision time: %s\n", vcsTime)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// DefaultUserAgent returns the User-Agent sent by clients without a UserAgent set, ex: czds-go/v1.2.3
+func DefaultUserAgent() string {
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = moduleVersion(info)
+	}
+	// binaries built from a checkout instead of a tagged module have no version
+	if len(version) == 0 || version == "(devel)" {
+		version = "devel"
+	}
+	return "czds-go/" + version
+}
+
+// moduleVersion returns the version of this module from info, whether it is the main module or a dependency
+func moduleVersion(info *debug.BuildInfo) string {
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// buildSetting returns the value of the build setting key, or an empty string if it is not set
+func buildSetting(info *debug.BuildInfo, key string) string {
+	for _, setting := range info.Settings {
+		if setting.Key == key {
+			return setting.Value
+		}
+	}
+	return ""
+}
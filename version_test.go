@@ -0,0 +1,85 @@
+package czds
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestFormatBuildInfo(t *testing.T) {
+	settings := func(kv ...string) []debug.BuildSetting {
+		var s []debug.BuildSetting
+		for i := 0; i+1 < len(kv); i += 2 {
+			s = append(s, debug.BuildSetting{Key: kv[i], Value: kv[i+1]})
+		}
+		return s
+	}
+	tests := []struct {
+		name string
+		info debug.BuildInfo
+		want string
+	}{
+		{
+			name: "main module with vcs",
+			info: debug.BuildInfo{
+				GoVersion: "go1.22.1",
+				Main:      debug.Module{Path: modulePath, Version: "v1.2.3"},
+				Settings:  settings("GOOS", "linux", "GOARCH", "amd64", "vcs.revision", "abc123", "vcs.time", "2024-06-01T12:00:00Z", "vcs.modified", "false"),
+			},
+			want: "Module: github.com/lanrat/czds v1.2.3\nGo: go1.22.1 linux/amd64\nRevision: abc123\nRevision time: 2024-06-01T12:00:00Z",
+		},
+		{
+			name: "modified checkout",
+			info: debug.BuildInfo{
+				GoVersion: "go1.22.1",
+				Main:      debug.Module{Path: modulePath, Version: "(devel)"},
+				Settings:  settings("GOOS", "darwin", "GOARCH", "arm64", "vcs.revision", "abc123", "vcs.modified", "true"),
+			},
+			want: "Module: github.com/lanrat/czds (devel)\nGo: go1.22.1 darwin/arm64\nRevision: abc123 (modified)",
+		},
+		{
+			name: "dependency without vcs",
+			info: debug.BuildInfo{
+				GoVersion: "go1.21.0",
+				Main:      debug.Module{Path: "example.com/tool"},
+				Deps:      []*debug.Module{{Path: modulePath, Version: "v1.0.0"}},
+				Settings:  settings("GOOS", "linux", "GOARCH", "arm64"),
+			},
+			want: "Module: github.com/lanrat/czds v1.0.0\nGo: go1.21.0 linux/arm64",
+		},
+		{
+			name: "replaced dependency",
+			info: debug.BuildInfo{
+				GoVersion: "go1.21.0",
+				Main:      debug.Module{Path: "example.com/tool"},
+				Deps:      []*debug.Module{{Path: modulePath, Version: "v1.0.0", Replace: &debug.Module{Path: "example.com/fork", Version: "v1.0.1"}}},
+				Settings:  settings("GOOS", "linux", "GOARCH", "amd64"),
+			},
+			want: "Module: github.com/lanrat/czds v1.0.1\nGo: go1.21.0 linux/amd64",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatBuildInfo(&tt.info); got != tt.want {
+				t.Errorf("formatBuildInfo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Skip("no build info")
+	}
+	got := BuildInfo()
+	if !strings.HasPrefix(got, "Module: "+modulePath+" ") {
+		t.Errorf("BuildInfo() = %q, want the module version", got)
+	}
+	if !strings.Contains(got, info.GoVersion) {
+		t.Errorf("BuildInfo() = %q, want the Go version %s", got, info.GoVersion)
+	}
+	if revision := buildSetting(info, "vcs.revision"); len(revision) > 0 && !strings.Contains(got, "Revision: "+revision) {
+		t.Errorf("BuildInfo() = %q, want the revision %s", got, revision)
+	}
+}
@@ -1,50 +1,172 @@
 package czds
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
+	"net/http"
+	neturl "net/url"
 	"os"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // DownloadInfo information from the HEAD request from a DownloadLink
 type DownloadInfo struct {
-	ContentLength int64
-	LastModified  time.Time
+	ContentLength int64     // -1 if the server did not send a Content-Length
+	LastModified  time.Time // zero if the server did not send a Last-Modified date
 	Filename      string
 }
 
+// Statuses for ZoneResult.Status
+const (
+	ZoneDownloaded = "downloaded"
+	ZoneSkipped    = "skipped"
+	ZoneFailed     = "failed"
+)
+
+// ZoneResult holds the outcome of a single zone from a batch download
+type ZoneResult struct {
+	Zone     string
+	URL      string
+	Path     string // local path the zone was saved to
+	Bytes    int64
+	Duration time.Duration
+	Status   string // one of the Zone* constants
+	Err      error
+}
+
+// DownloadResult holds the per-zone results of a batch download
+type DownloadResult struct {
+	Zones    []ZoneResult
+	Duration time.Duration
+}
+
+// Count returns the number of zones in the DownloadResult with the provided status
+func (r *DownloadResult) Count(status string) int {
+	count := 0
+	for _, zone := range r.Zones {
+		if zone.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
 // DownloadZoneToWriter is analogous to DownloadZone but instead of writing it to a file, it will
 // write it to a provided io.Writer. It returns the number of bytes written to dest and any error
 // that was encountered.
 func (c *Client) DownloadZoneToWriter(url string, dest io.Writer) (int64, error) {
+	return c.DownloadZoneToWriterWithOptions(context.Background(), url, dest, nil)
+}
+
+// ProgressFunc is called with the number of bytes written so far and the total size of the download
+// total is -1 if the size is unknown
+type ProgressFunc func(written, total int64)
+
+// DownloadOptions holds the optional settings for DownloadZoneToWriterWithOptions()
+type DownloadOptions struct {
+	Progress      ProgressFunc // called after each chunk of the zone is written
+	ModifiedSince time.Time    // only download the zone if it was modified after this time, otherwise return ErrNotModified
+}
+
+// DownloadZoneToWriterWithProgress is the same as DownloadZoneToWriter but calls progress after each chunk
+// of the zone is written to dest, progress may be nil
+func (c *Client) DownloadZoneToWriterWithProgress(url string, dest io.Writer, progress ProgressFunc) (int64, error) {
+	return c.DownloadZoneToWriterWithOptions(context.Background(), url, dest, &DownloadOptions{Progress: progress})
+}
+
+// DownloadZoneToWriterIfModifiedSince is the same as DownloadZoneToWriter but only downloads the zone
+// if it has been modified after since, otherwise ErrNotModified is returned and nothing is written to dest
+func (c *Client) DownloadZoneToWriterIfModifiedSince(url string, dest io.Writer, since time.Time) (int64, error) {
+	return c.DownloadZoneToWriterWithOptions(context.Background(), url, dest, &DownloadOptions{ModifiedSince: since})
+}
+
+// DownloadZoneToWriterWithOptions is the same as DownloadZoneToWriter but with the additional DownloadOptions, opts may be nil
+// the download is aborted when ctx is done
+func (c *Client) DownloadZoneToWriterWithOptions(ctx context.Context, url string, dest io.Writer, opts *DownloadOptions) (int64, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	start := time.Now()
+	w, err := c.downloadZoneToWriter(ctx, url, dest, opts)
+	if errors.Is(err, ErrNotModified) {
+		// nothing was downloaded
+		return w, err
+	}
+	zone := strings.TrimSuffix(urlBase(url), ".zone")
+	c.metrics().ObserveDownload(zone, w, time.Since(start), err)
+	return w, err
+}
+
+// progressWriter calls progress with the running total of bytes written
+type progressWriter struct {
+	progress ProgressFunc
+	written  int64
+	total    int64
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	pw.written += int64(len(b))
+	pw.progress(pw.written, pw.total)
+	return len(b), nil
+}
+
+func (c *Client) downloadZoneToWriter(ctx context.Context, url string, dest io.Writer, opts *DownloadOptions) (int64, error) {
 	c.v("downloading zone from %q", url)
-	resp, err := c.apiRequest(true, "GET", url, nil)
+	header := zoneHeader()
+	if !opts.ModifiedSince.IsZero() {
+		header.Set("If-Modified-Since", opts.ModifiedSince.UTC().Format(http.TimeFormat))
+	}
+	resp, err := c.apiRequestWithHeader(ctx, true, "GET", url, nil, header)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		c.v("zone %q not modified since %s", url, opts.ModifiedSince.Format(time.ANSIC))
+		return 0, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error on request %q: got Status %s", url, resp.Status)
+	}
+	if opts.Progress != nil {
+		dest = io.MultiWriter(dest, &progressWriter{progress: opts.Progress, total: resp.ContentLength})
+	}
 	w, err := io.Copy(dest, resp.Body)
 	if err != nil {
 		return w, err
 	}
 
-	c.v("downloading %d bytes finished from %q", resp.ContentLength, url)
-	if w != resp.ContentLength {
+	c.v("downloading %d bytes finished from %q", w, url)
+	// a negative ContentLength is unknown, such as a chunked response
+	// an uncompressed response was decoded by a transport that requested compression, so its length differs
+	if resp.ContentLength >= 0 && !resp.Uncompressed && w != resp.ContentLength {
 		return w, fmt.Errorf("downloaded bytes: %d, while request content-length is: %d ", w, resp.ContentLength)
 	}
 	return w, nil
 }
 
+// zoneHeader returns the headers for zone HEAD and GET requests
+// zones are already gzip files, so compression is disabled to save the zone exactly as it is stored
+// and to keep the Content-Length of the HEAD and GET requests the same as the saved size
+func zoneHeader() http.Header {
+	header := http.Header{}
+	header.Set("Accept-Encoding", "identity")
+	return header
+}
+
 // DownloadZone provided the zone download URL retrieved from GetLinks() downloads the zone file and
 // saves it to local disk at destinationPath
 func (c *Client) DownloadZone(url, destinationPath string) error {
 	// start the file download
 	file, err := os.Create(destinationPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to create destination %q: %w", destinationPath, err)
 	}
 	defer file.Close()
 
@@ -64,53 +186,86 @@ func (c *Client) DownloadZone(url, destinationPath string) error {
 // GetDownloadInfo Performs a HEAD request to the zone at url and populates a DownloadInfo struct
 // with the information returned by the headers
 func (c *Client) GetDownloadInfo(url string) (*DownloadInfo, error) {
+	return c.GetDownloadInfoWithContext(context.Background(), url)
+}
+
+// GetDownloadInfoWithContext is the same as GetDownloadInfo but the request is aborted when ctx is done
+func (c *Client) GetDownloadInfoWithContext(ctx context.Context, url string) (*DownloadInfo, error) {
 	c.v("GetDownloadInfo for %q", url)
-	resp, err := c.apiRequest(true, "HEAD", url, nil)
+	resp, err := c.apiRequestWithHeader(ctx, true, "HEAD", url, nil, zoneHeader())
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error on HEAD request %q: got Status %s", url, resp.Status)
+	}
 
+	var lastModifiedTime time.Time
 	lastModifiedStr := resp.Header.Get("Last-Modified")
 	if lastModifiedStr == "" {
-		return nil, fmt.Errorf("HEAD request to %s missing 'Last-Modified' header", url)
-	}
-	lastModifiedTime, err := time.Parse(time.RFC1123, lastModifiedStr)
-	if err != nil {
-		return nil, err
+		c.v("HEAD request to %s missing 'Last-Modified' header", url)
+	} else {
+		lastModifiedTime, err = time.Parse(time.RFC1123, lastModifiedStr)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	contentLength := int64(-1)
 	contentLengthStr := resp.Header.Get("Content-Length")
 	if contentLengthStr == "" {
-		return nil, fmt.Errorf("HEAD request to %s missing 'Content-Length' header", url)
-	}
-	contentLength, err := strconv.ParseInt(contentLengthStr, 10, 64)
-	if err != nil {
-		return nil, err
+		c.v("HEAD request to %s missing 'Content-Length' header", url)
+	} else {
+		contentLength, err = strconv.ParseInt(contentLengthStr, 10, 64)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	var filename string
 	contentDisposition := resp.Header.Get("Content-Disposition")
-	_, params, err := mime.ParseMediaType(contentDisposition)
-	if err != nil {
-		return nil, err
+	if contentDisposition != "" {
+		_, params, err := mime.ParseMediaType(contentDisposition)
+		if err != nil {
+			return nil, err
+		}
+		filename = params["filename"]
+	}
+	if filename == "" {
+		// fallback to the name from the url
+		filename = urlBase(url)
+		c.v("HEAD request to %s missing 'Content-Disposition' filename, using %q", url, filename)
 	}
 
 	info := &DownloadInfo{
 		LastModified:  lastModifiedTime,
 		ContentLength: contentLength,
-		Filename:      params["filename"],
+		Filename:      filename,
 	}
 	return info, nil
 }
 
 // GetLinks returns the DownloadLinks available to the authenticated user
+// if LinksCacheTTL is set a cached result newer than the TTL for the same auth token is returned without making a request
 func (c *Client) GetLinks() ([]string, error) {
+	c.linksMutex.Lock()
+	defer c.linksMutex.Unlock()
+	if c.LinksCacheTTL > 0 && c.links != nil && time.Since(c.linksTime) < c.LinksCacheTTL && c.linksToken == c.accessToken() {
+		c.v("GetLinks: using cached links from %s", c.linksTime.Format(time.ANSIC))
+		return append([]string(nil), c.links...), nil
+	}
 	links := make([]string, 0, 10)
 	c.v("GetLinks called")
 	err := c.jsonAPI("GET", "/czds/downloads/links", nil, &links)
 	if err != nil {
 		return nil, err
 	}
+	if c.LinksCacheTTL > 0 {
+		c.links = append([]string(nil), links...)
+		c.linksTime = time.Now()
+		c.linksToken = c.accessToken()
+	}
 
 	dLinks := make([]string, 0, len(links))
 	dLinks = append(dLinks, links...)
@@ -118,3 +273,12 @@ func (c *Client) GetLinks() ([]string, error) {
 
 	return dLinks, nil
 }
+
+// urlBase returns the last element of the path of url, without any query string or fragment
+func urlBase(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return path.Base(url)
+	}
+	return path.Base(u.Path)
+}
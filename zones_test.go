@@ -0,0 +1,360 @@
+package czds
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadZoneDestinationError(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		destination string
+		wantErr     error
+	}{
+		{"missing directory", filepath.Join(dir, "missing", "com.txt.gz"), fs.ErrNotExist},
+		{"destination is a directory", dir, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, c := newTestServer(t, http.NewServeMux())
+			err := c.DownloadZone(ts.URL+"/czds/downloads/com.zone", tt.destination)
+			if err == nil {
+				t.Fatal("DownloadZone() succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), tt.destination) {
+				t.Errorf("error %q does not include the destination %q", err, tt.destination)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %q does not wrap %v", err, tt.wantErr)
+			}
+			if n := ts.auths.Load(); n != 0 {
+				t.Errorf("authenticated %d times before the destination was created, want 0", n)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing directory was created: %v", err)
+	}
+}
+
+func TestDownloadZoneToWriterWithProgress(t *testing.T) {
+	chunk := strings.Repeat("x", 32*1024)
+	tests := []struct {
+		name          string
+		chunks        int
+		contentLength bool
+		wantTotal     int64 // -1 when the size is unknown
+	}{
+		{"known size", 4, true, 4 * int64(len(chunk))},
+		{"unknown size", 4, false, -1},
+		{"single chunk", 1, true, int64(len(chunk))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size := tt.chunks * len(chunk)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/com.zone", func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(size))
+				}
+				for i := 0; i < tt.chunks; i++ {
+					w.Write([]byte(chunk))
+					w.(http.Flusher).Flush()
+				}
+			})
+			ts, c := newTestServer(t, mux)
+
+			var calls []int64
+			var b bytes.Buffer
+			n, err := c.DownloadZoneToWriterWithProgress(ts.URL+"/czds/downloads/com.zone", &b, func(written, total int64) {
+				if total != tt.wantTotal {
+					t.Errorf("total = %d, want %d", total, tt.wantTotal)
+				}
+				calls = append(calls, written)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != int64(size) || b.Len() != size {
+				t.Errorf("downloaded %d bytes and wrote %d, want %d", n, b.Len(), size)
+			}
+			if len(calls) == 0 {
+				t.Fatal("progress was never called")
+			}
+			for i := 1; i < len(calls); i++ {
+				if calls[i] <= calls[i-1] {
+					t.Errorf("written went from %d to %d, want it to increase", calls[i-1], calls[i])
+				}
+			}
+			if last := calls[len(calls)-1]; last != int64(size) {
+				t.Errorf("last written = %d, want %d", last, size)
+			}
+		})
+	}
+}
+
+func TestDownloadZoneIfModifiedSince(t *testing.T) {
+	modified := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		since       time.Time
+		notModified bool // the server answers conditional requests with 304
+		wantSince   string
+		wantErr     error
+	}{
+		{"unconditional", time.Time{}, true, "", nil},
+		{"modified", modified.Add(-time.Hour), false, modified.Add(-time.Hour).Format(http.TimeFormat), nil},
+		{"not modified", modified, true, modified.Format(http.TimeFormat), ErrNotModified},
+		{"local time zone", modified.In(time.FixedZone("test", 3600)), true, modified.Format(http.TimeFormat), ErrNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &zoneHandler{zones: map[string][]byte{"com": []byte("com zone")}, notModified: tt.notModified}
+			_, c, urls := newZoneServer(t, h)
+			var b bytes.Buffer
+			n, err := c.DownloadZoneToWriterIfModifiedSince(urls[0], &b, tt.since)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if since := h.since["com"]; since != tt.wantSince {
+				t.Errorf("If-Modified-Since = %q, want %q", since, tt.wantSince)
+			}
+			want := "com zone"
+			if tt.wantErr != nil {
+				want = ""
+			}
+			if n != int64(len(want)) || b.String() != want {
+				t.Errorf("downloaded %d bytes %q, want %q", n, b.String(), want)
+			}
+		})
+	}
+}
+
+func TestGetLinksCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          time.Duration
+		wait         time.Duration // time between the calls
+		newToken     bool          // authenticate again between the calls
+		wantRequests int32
+	}{
+		{"disabled", 0, 0, false, 2},
+		{"cached", time.Hour, 0, false, 1},
+		{"expired", 10 * time.Millisecond, 20 * time.Millisecond, false, 2},
+		{"new token", time.Hour, 0, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/links", func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				writeJSON(t, w, []string{"https://czds.example/czds/downloads/com.zone"})
+			})
+			_, c := newTestServer(t, mux)
+			c.LinksCacheTTL = tt.ttl
+
+			first, err := c.GetLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// changing the returned links must not change the cache
+			first[0] = "changed"
+			time.Sleep(tt.wait)
+			if tt.newToken {
+				c.authMutex.Lock()
+				c.authExp = time.Now()
+				c.authMutex.Unlock()
+				err = c.EnsureAuthenticated()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			second, err := c.GetLinks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(second) != 1 || second[0] != "https://czds.example/czds/downloads/com.zone" {
+				t.Errorf("second GetLinks() = %v", second)
+			}
+			if n := requests.Load(); n != tt.wantRequests {
+				t.Errorf("requested links %d times, want %d", n, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestGetDownloadInfoMissingHeaders(t *testing.T) {
+	modified := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		lastModified bool
+		length       bool
+		wantModified time.Time
+		wantLength   int64
+	}{
+		{"all headers", true, true, modified, 8},
+		{"missing Last-Modified", false, true, time.Time{}, 8},
+		{"missing Content-Length", true, false, modified, -1},
+		{"missing both", false, false, time.Time{}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/com.zone", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Disposition", "attachment; filename=com.txt.gz")
+				if tt.lastModified {
+					w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+				}
+				if tt.length {
+					w.Header().Set("Content-Length", "8")
+				} else {
+					// a chunked response does not have a length
+					w.Header().Set("Transfer-Encoding", "chunked")
+				}
+				if r.Method == http.MethodGet {
+					w.Write([]byte("com zone"))
+				}
+			})
+			ts, c := newTestServer(t, mux)
+			url := ts.URL + "/czds/downloads/com.zone"
+			info, err := c.GetDownloadInfo(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.LastModified.Equal(tt.wantModified) {
+				t.Errorf("LastModified = %s, want %s", info.LastModified, tt.wantModified)
+			}
+			if info.ContentLength != tt.wantLength {
+				t.Errorf("ContentLength = %d, want %d", info.ContentLength, tt.wantLength)
+			}
+			if info.Filename != "com.txt.gz" {
+				t.Errorf("Filename = %q, want com.txt.gz", info.Filename)
+			}
+
+			// the zone still downloads without the headers
+			dir := t.TempDir()
+			result, err := c.BulkDownload([]string{url}, &BulkDownloadOptions{OutDir: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Zones) != 1 || result.Zones[0].Status != ZoneDownloaded || result.Zones[0].Bytes != 8 {
+				t.Errorf("BulkDownload() = %+v, want com downloaded", result.Zones)
+			}
+		})
+	}
+}
+
+func TestGetDownloadInfoFilename(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string // Content-Disposition header, empty to omit it
+		query       string // appended to the download URL
+		want        string
+	}{
+		{"from header", "attachment; filename=com.txt.gz", "", "com.txt.gz"},
+		{"quoted", `attachment; filename="com.txt.gz"`, "", "com.txt.gz"},
+		{"missing header", "", "", "com.zone"},
+		{"no filename", "attachment", "", "com.zone"},
+		{"empty filename", `attachment; filename=""`, "", "com.zone"},
+		{"query string is not part of the name", "", "?token=abc/def", "com.zone"},
+		{"fragment is not part of the name", "", "#section", "com.zone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/com.zone", func(w http.ResponseWriter, r *http.Request) {
+				if tt.disposition != "" {
+					w.Header().Set("Content-Disposition", tt.disposition)
+				}
+				w.Header().Set("Content-Length", "8")
+			})
+			ts, c := newTestServer(t, mux)
+			info, err := c.GetDownloadInfo(ts.URL + "/czds/downloads/com.zone" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Filename != tt.want {
+				t.Errorf("Filename = %q, want %q", info.Filename, tt.want)
+			}
+		})
+	}
+}
+
+// stripAcceptEncoding is an http.RoundTripper that removes the Accept-Encoding header
+// so that the http.Transport requests compression and transparently decompresses the response
+type stripAcceptEncoding struct{}
+
+func (stripAcceptEncoding) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Del("Accept-Encoding")
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDownloadZoneContentEncoding(t *testing.T) {
+	zone := gzipZone(t, strings.Repeat("com zone\n", 100))
+	tests := []struct {
+		name        string
+		encode      bool // the server gzip encodes the response when the client accepts it
+		force       bool // the server gzip encodes the response even when asked not to
+		transparent bool // the client's transport requests compression and decodes it
+		want        []byte
+	}{
+		{"identity", true, false, false, zone},
+		{"encoded anyway", false, true, false, gzipZone(t, string(zone))},
+		{"transparent decompression", true, false, true, zone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var acceptEncoding []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/czds/downloads/com.zone", func(w http.ResponseWriter, r *http.Request) {
+				acceptEncoding = append(acceptEncoding, r.Header.Get("Accept-Encoding"))
+				data := zone
+				if tt.force || (tt.encode && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip")) {
+					data = gzipZone(t, string(zone))
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				w.Header().Set("Content-Disposition", "attachment; filename=com.txt.gz")
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				if r.Method == http.MethodGet {
+					w.Write(data)
+				}
+			})
+			ts, c := newTestServer(t, mux)
+			if tt.transparent {
+				c.HTTPClient = &http.Client{Transport: stripAcceptEncoding{}}
+			}
+			url := ts.URL + "/czds/downloads/com.zone"
+			_, err := c.GetDownloadInfo(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			n, err := c.DownloadZoneToWriter(url, &b)
+			if err != nil {
+				t.Fatalf("DownloadZoneToWriter() error = %v, want no length mismatch", err)
+			}
+			if n != int64(len(tt.want)) || !bytes.Equal(b.Bytes(), tt.want) {
+				t.Errorf("downloaded %d bytes, want the %d bytes of the zone", n, len(tt.want))
+			}
+			if !tt.transparent {
+				for _, got := range acceptEncoding {
+					if got != "identity" {
+						t.Errorf("Accept-Encoding = %q, want identity", got)
+					}
+				}
+			}
+		})
+	}
+}